@@ -1,6 +1,7 @@
 #!/usr/bin/python
-import traceback, json, sys, socket, os
+import traceback, json, sys, socket, os, types, inspect, time
 import rethinkdb
+import tornado.gen
 import tornado.ioloop
 import tornado.web
 import tornado.httpserver
@@ -40,22 +41,123 @@ def init():
 
     initialized = True
 
+# The HTTP request that invoked a lambda, passed to handlers that take
+# a third argument:
+#
+#   def handler(conn, event, request)
+#
+# method, path (after /runLambda/<name>), query (name => list of
+# values), headers and body (raw) describe the request.  The handler
+# may set the status code and headers of the response.
+#
+# Large bodies are not sent by the worker, but staged to a file under
+# /host.  body is then empty, and body_file is the path of the file.
+#
+# deadline is when the worker gives up on the request and kills the
+# sandbox (seconds since the epoch), or None if the worker did not say.
+class Request(object):
+    def __init__(self, req):
+        self.method = req.method
+        self.path = req.path
+        self.query = dict(req.query_arguments)
+        self.headers = dict(req.headers)
+        self.body = req.body
+        self.body_file = req.headers.get('X-Ol-Body-File')
+        self.deadline = None
+        if req.headers.get('X-Ol-Deadline'):
+            self.deadline = int(req.headers.get('X-Ol-Deadline')) / 1000.0
+        self.status = 200
+        self.response_headers = {}
+
+    # seconds left before the deadline, or None if there is none
+    def remaining(self):
+        if self.deadline is None:
+            return None
+        return max(self.deadline - time.time(), 0)
+
+    def set_status(self, status):
+        self.status = status
+
+    def set_header(self, name, value):
+        self.response_headers[name] = value
+
+# Messages of a WebSocket are passed as JSON if they parse, and as
+# strings otherwise (None for the connect and disconnect events).
+def ws_message(data):
+    if not data:
+        return None
+    try:
+        return json.loads(data)
+    except ValueError:
+        return data
+
+def call_handler(event, request):
+    if len(inspect.getargspec(lambda_func.handler).args) >= 3:
+        return lambda_func.handler(db_conn, event, request)
+    return lambda_func.handler(db_conn, event)
+
 class SockFileHandler(tornado.web.RequestHandler):
-    def post(self):
+    @tornado.gen.coroutine
+    def invoke(self):
         try:
             init()
             data = self.request.body
+            body_file = self.request.headers.get('X-Ol-Body-File')
+            ws_event = self.request.headers.get('X-Ol-Ws-Event')
             try :
-                event = json.loads(data)
+                if body_file:
+                    # too large to send; the event refers to it
+                    event = {'body_file': body_file,
+                             'body_size': int(self.request.headers.get('X-Ol-Body-Size', 0))}
+                elif ws_event:
+                    # WebSocket messages need not be JSON
+                    event = {'ws_event': ws_event,
+                             'ws_id': self.request.headers.get('X-Ol-Ws-Id'),
+                             'message': ws_message(data)}
+                else:
+                    # requests without a body (e.g., GETs) have no event
+                    event = json.loads(data) if data else None
             except:
                 self.set_status(400)
                 self.write('bad POST data: "%s"'%str(data))
                 return
-            self.write(json.dumps(lambda_func.handler(db_conn, event)))
+            request = Request(self.request)
+            result = call_handler(event, request)
+            self.set_status(request.status)
+            for name, value in request.response_headers.items():
+                self.set_header(name, value)
+            if isinstance(result, types.GeneratorType):
+                yield self.stream(result)
+            else:
+                self.write(json.dumps(result))
         except Exception:
+            if self._headers_written:
+                # too late to report the error to the client
+                traceback.print_exc()
+                return
             self.set_status(500) # internal error
             self.write(traceback.format_exc())
 
+    get = post = put = patch = delete = invoke
+
+    # handlers that yield produce progressive output, sent as
+    # Server-Sent Events if the client accepts them, otherwise as one
+    # JSON value per line
+    @tornado.gen.coroutine
+    def stream(self, results):
+        sse = 'text/event-stream' in self.request.headers.get('Accept', '')
+        if sse:
+            self.set_header('Content-Type', 'text/event-stream')
+        else:
+            self.set_header('Content-Type', 'application/x-ndjson')
+
+        for item in results:
+            if sse:
+                self.write('data: %s\n\n' % json.dumps(item))
+            else:
+                self.write(json.dumps(item) + '\n')
+            yield self.flush()
+
 tornado_app = tornado.web.Application([
     (r".*", SockFileHandler),
 ])
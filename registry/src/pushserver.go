@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/grpclog"
@@ -19,7 +20,11 @@ func (s *PushServer) processAndStore(name string, files map[string][]byte) error
 		return err
 	}
 
+	// versions (<name>@<N>) are immutable, so they cannot be pushed twice
 	opts := r.InsertOpts{Conflict: "replace"}
+	if strings.Contains(name, "@") {
+		opts.Conflict = "error"
+	}
 	for _, file := range procfiles {
 		_, err := r.Table(file.Table).Insert(file.Data, opts).RunWrite(s.Conn)
 		if err != nil {
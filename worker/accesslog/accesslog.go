@@ -0,0 +1,115 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry describes one invocation of a lambda.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestId string    `json:"request_id"`
+	Lambda    string    `json:"lambda"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Async     bool      `json:"async,omitempty"`
+	Status    int       `json:"status"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+	Error     string    `json:"error,omitempty"`
+	Cache     string    `json:"cache,omitempty"` // "hit" or "miss", for lambdas with a cache
+
+	// milliseconds spent in the whole invocation, and in each phase
+	// (e.g., pull, create, start, unpause, forward, pause)
+	DurationMs float64            `json:"duration_ms"`
+	PhasesMs   map[string]float64 `json:"phases_ms,omitempty"`
+}
+
+// SetPhases fills in PhasesMs.
+func (e *Entry) SetPhases(durations map[string]time.Duration) {
+	e.PhasesMs = make(map[string]float64, len(durations))
+	for name, d := range durations {
+		e.PhasesMs[name] = millis(d)
+	}
+}
+
+// SetDuration fills in DurationMs.
+func (e *Entry) SetDuration(d time.Duration) {
+	e.DurationMs = millis(d)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Logger writes Entries to a sink, one JSON object per line.  A nil *Logger
+// discards them.
+type Logger struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+// New creates a Logger that writes to out.
+func New(out io.Writer) *Logger {
+	return &Logger{out: out}
+}
+
+// Open creates a Logger for a sink named in the worker config: "" (no
+// logging), "stdout", "stderr", or the path of a file, which is rotated once
+// it grows past max_size bytes, keeping the given number of old files.
+func Open(sink string, max_size int64, backups int) (*Logger, error) {
+	switch sink {
+	case "":
+		return nil, nil
+	case "stdout":
+		return New(os.Stdout), nil
+	case "stderr":
+		return New(os.Stderr), nil
+	}
+
+	f, err := OpenRotatingFile(sink, max_size, backups)
+	if err != nil {
+		return nil, fmt.Errorf("could not open access log (%v): %v", sink, err)
+	}
+	return New(f), nil
+}
+
+// Log writes an Entry.  Failures are reported to the standard logger, as
+// they should not fail the invocation.
+func (l *Logger) Log(e *Entry) {
+	if l == nil {
+		return
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("could not encode access log entry: %v\n", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, err := l.out.Write(line); err != nil {
+		log.Printf("could not write access log: %v\n", err)
+	}
+}
+
+// Close closes the sink, if it is a file.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if f, ok := l.out.(*RotatingFile); ok {
+		return f.Close()
+	}
+	return nil
+}
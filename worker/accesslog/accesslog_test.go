@@ -0,0 +1,131 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+
+	e := &Entry{RequestId: "abc", Lambda: "echo", Status: 200}
+	e.SetDuration(1500 * time.Microsecond)
+	e.SetPhases(map[string]time.Duration{"forward": time.Millisecond})
+	l.Log(e)
+	l.Log(e)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", buf.String())
+	}
+
+	var got Entry
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RequestId != "abc" || got.DurationMs != 1.5 || got.PhasesMs["forward"] != 1 {
+		t.Fatalf("Unexpected entry %+v", got)
+	}
+
+	// a nil Logger discards entries
+	var none *Logger
+	none.Log(e)
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for file, content := range expected {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %q in %s, got %q", content, file, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups")
+	}
+}
+
+func TestRotatingFileRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// a non-empty directory in the way of the backup fails the rotation
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("aaaaaaaa\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("bbbbbbbb\n")); err == nil {
+		t.Fatal("Expected the rotation to fail")
+	}
+
+	// once it is out of the way, writes succeed again
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("cccccccc\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		path:        "cccccccc\n",
+		path + ".1": "aaaaaaaa\n",
+	}
+	for file, content := range expected {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %q in %s, got %q", content, file, data)
+		}
+	}
+
+	f.Close()
+	if _, err := f.Write([]byte("dddddddd\n")); err != os.ErrClosed {
+		t.Fatalf("Expected %v after Close, got %v", os.ErrClosed, err)
+	}
+}
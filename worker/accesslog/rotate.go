@@ -0,0 +1,114 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is a file that is rotated once it reaches a maximum size:
+// path is renamed to path.1, path.1 to path.2, and so on, dropping the
+// oldest beyond the number of backups.
+type RotatingFile struct {
+	mutex    sync.Mutex
+	path     string
+	max_size int64 // 0 means never rotate
+	backups  int
+	file     *os.File // nil after Close, or after a failed rotation
+	size     int64
+	closed   bool
+}
+
+// OpenRotatingFile opens (or creates) the file at path for appending.
+func OpenRotatingFile(path string, max_size int64, backups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, max_size: max_size, backups: backups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it past
+// the maximum size.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	// a failed rotation leaves no file, so try again to open one
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.max_size > 0 && f.size > 0 && f.size+int64(len(p)) > f.max_size {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups, and starts a new file.  The caller must hold
+// the mutex.  If it fails, the next Write opens the file again.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.backups > 0 {
+		for i := f.backups - 1; i > 0; i-- {
+			src := fmt.Sprintf("%s.%d", f.path, i)
+			dst := fmt.Sprintf("%s.%d", f.path, i+1)
+			if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// how long generated certificates are valid
+const CERT_LIFETIME = 365 * 24 * time.Hour
+
+// tlsPath gets the path of a certificate or key file in the cluster
+func tlsPath(cluster string, name string) string {
+	return path.Join(cluster, "tls", name)
+}
+
+// clusterCA loads the CA of the cluster, generating a self-signed one on
+// first use.  The CA is written to tls/ca.pem (and tls/ca-key.pem).
+func clusterCA(cluster string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	cert_path := tlsPath(cluster, "ca.pem")
+	key_path := tlsPath(cluster, "ca-key.pem")
+
+	if _, err := os.Stat(cert_path); err == nil {
+		pair, err := tls.LoadX509KeyPair(cert_path, key_path)
+		if err != nil {
+			return nil, nil, err
+		}
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported key type in %s", key_path)
+		}
+		return ca, key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(tlsPath(cluster, ""), 0700); err != nil {
+		return nil, nil, err
+	}
+
+	template, err := certTemplate("OpenLambda cluster CA")
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeCert(cert_path, key_path, der, key); err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("Generated cluster CA at %s\n", cert_path)
+
+	return ca, key, nil
+}
+
+// issueCert generates a certificate and key signed by the cluster CA,
+// written to tls/<name>.pem and tls/<name>-key.pem.  Server certificates
+// are valid for localhost and this host; others are for client auth.
+func issueCert(cluster string, name string, server bool) (string, string, error) {
+	ca, ca_key, err := clusterCA(cluster)
+	if err != nil {
+		return "", "", err
+	}
+
+	template, err := certTemplate(name)
+	if err != nil {
+		return "", "", err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		if host, err := os.Hostname(); err == nil {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, ca_key)
+	if err != nil {
+		return "", "", err
+	}
+
+	cert_path := tlsPath(cluster, name+".pem")
+	key_path := tlsPath(cluster, name+"-key.pem")
+	if err := writeCert(cert_path, key_path, der, key); err != nil {
+		return "", "", err
+	}
+
+	return cert_path, key_path, nil
+}
+
+// certTemplate returns a certificate template with a random serial number.
+func certTemplate(common_name string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: common_name, Organization: []string{"OpenLambda"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(CERT_LIFETIME),
+	}, nil
+}
+
+// writeCert writes a DER certificate and its key as PEM files.
+func writeCert(cert_path string, key_path string, der []byte, key *ecdsa.PrivateKey) error {
+	key_der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	key_pem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der})
+	if err := ioutil.WriteFile(key_path, key_pem, 0600); err != nil {
+		return err
+	}
+
+	cert_pem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return ioutil.WriteFile(cert_path, cert_pem, 0644)
+}
+
+// clusterClient returns an HTTP client for talking to the workers of the
+// cluster, trusting the cluster CA and presenting the admin client
+// certificate (if they exist).
+func clusterClient(cluster string) (*http.Client, error) {
+	ca_pem, err := ioutil.ReadFile(tlsPath(cluster, "ca.pem"))
+	if os.IsNotExist(err) {
+		return http.DefaultClient, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca_pem)
+	tls_conf := &tls.Config{RootCAs: pool}
+
+	client_cert := tlsPath(cluster, "admin.pem")
+	if _, err := os.Stat(client_cert); err == nil {
+		pair, err := tls.LoadX509KeyPair(client_cert, tlsPath(cluster, "admin-key.pem"))
+		if err != nil {
+			return nil, err
+		}
+		tls_conf.Certificates = []tls.Certificate{pair}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tls_conf}}, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/deadletter"
+	"github.com/open-lambda/open-lambda/worker/server"
+	"github.com/urfave/cli"
+)
+
+// workerUrl gets the URL of a path on a worker
+func workerUrl(c *config.Config, path string) string {
+	scheme := "http"
+	if c.Tls_cert != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%s%s", scheme, c.Worker_port, path)
+}
+
+// adminKey returns the key with the given ID (or else the first admin key)
+// of the auth_file of a worker, or nil if the worker has no auth_file.
+func adminKey(c *config.Config, id string) (*server.AuthKey, error) {
+	if c.Auth_file == "" {
+		return nil, nil
+	}
+
+	keys, err := server.LoadAuthKeys(c.Auth_file)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if (id == "" && key.Admin) || (id != "" && key.Id == id) {
+			return key, nil
+		}
+	}
+	if id != "" {
+		return nil, fmt.Errorf("no key %s in %s", id, c.Auth_file)
+	}
+	return nil, fmt.Errorf("no admin key in %s", c.Auth_file)
+}
+
+// workerRequest sends a request to a worker of the cluster, with the given
+// key of its auth_file (or else its first admin key) if it has one, and
+// returns the body of the response, which must be successful.
+func workerRequest(cluster string, worker string, keyId string, method string, path string) ([]byte, error) {
+	c, err := config.ParseConfig(configPath(cluster, worker))
+	if err != nil {
+		return nil, err
+	}
+	key, err := adminKey(c, keyId)
+	if err != nil {
+		return nil, err
+	}
+	http_client, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	url := workerUrl(c, path)
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		key.Sign(req, nil)
+	}
+	response, err := http_client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, url, response.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// deadletters corresponds to the "deadletters" command of the admin tool.
+func deadletters(ctx *cli.Context) error {
+	cluster := parseCluster(ctx.String("cluster"), true)
+	worker := ctx.String("worker")
+	key := ctx.String("key")
+	args := ctx.Args()
+
+	op := "list"
+	if len(args) > 0 {
+		op = args[0]
+	}
+	if op != "list" && len(args) < 2 {
+		return fmt.Errorf("%s needs the ID of a dead letter", op)
+	}
+
+	switch op {
+	case "list":
+		path := "/deadletters"
+		if len(args) > 1 {
+			path += "?lambda=" + url.QueryEscape(args[1])
+		}
+		body, err := workerRequest(cluster, worker, key, "GET", path)
+		if err != nil {
+			return err
+		}
+		var letters []deadletter.Letter
+		if err := json.Unmarshal(body, &letters); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "ID\tLAMBDA\tTRIGGER\tATTEMPTS\tCODE\tFAILED\tERROR\n")
+		for _, letter := range letters {
+			reason := strings.Join(strings.Fields(letter.Error), " ")
+			if len(reason) > 40 {
+				reason = reason[:40] + "..."
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				letter.ID, letter.Lambda, letter.Trigger, letter.Attempts, letter.Code,
+				letter.Failed.Format(time.RFC3339), reason)
+		}
+		return tw.Flush()
+	case "inspect":
+		body, err := workerRequest(cluster, worker, key, "GET", "/deadletters/"+args[1])
+		if err != nil {
+			return err
+		}
+		var letter deadletter.Letter
+		if err := json.Unmarshal(body, &letter); err != nil {
+			return err
+		}
+
+		fmt.Printf("ID:       %s\n", letter.ID)
+		fmt.Printf("Lambda:   %s (%s)\n", letter.Lambda, letter.Trigger)
+		fmt.Printf("Request:  %s %s\n", letter.Method, letter.Path)
+		for key, values := range letter.Header {
+			fmt.Printf("          %s: %s\n", key, strings.Join(values, ", "))
+		}
+		fmt.Printf("Attempts: %d\n", letter.Attempts)
+		fmt.Printf("Failed:   %s (status %d)\n", letter.Failed.Format(time.RFC3339), letter.Code)
+		fmt.Printf("Error:    %s\n", strings.TrimSpace(letter.Error))
+		fmt.Printf("Event:\n%s\n", letter.Body)
+		return nil
+	case "redrive":
+		body, err := workerRequest(cluster, worker, key, "POST", "/deadletters/"+args[1]+"/redrive")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", body)
+		return nil
+	case "delete":
+		if _, err := workerRequest(cluster, worker, key, "DELETE", "/deadletters/"+args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted dead letter %s\n", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %s (expected list, inspect, redrive or delete)", op)
+	}
+}
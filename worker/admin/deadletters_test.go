@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/worker/server"
+)
+
+func TestWorkerRequestAuth(t *testing.T) {
+	cluster, err := ioutil.TempDir("", "ol-admin-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cluster)
+
+	auth_file := filepath.Join(cluster, "auth.json")
+	keys := `{"keys": [
+		{"id": "web", "type": "api_key", "secret": "s3cret", "lambdas": ["echo"]},
+		{"id": "ops", "type": "hmac", "secret": "4dmin", "admin": true},
+		{"id": "ops2", "type": "api_key", "secret": "4dmin2", "admin": true}
+	]}`
+	if err := ioutil.WriteFile(auth_file, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := server.NewKeyAuthenticator(auth_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a worker that only lets admin keys through
+	var key string
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := auth.AuthenticateAdmin(r, bytes.NewReader(body)); err != nil {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		key = r.Header.Get(server.KEY_ID_HEADER) + r.Header.Get(server.API_KEY_HEADER)
+		w.Write([]byte("ok"))
+	}))
+	defer worker.Close()
+	port := mustPort(t, worker.URL)
+
+	writeConfig := func(auth_file string) {
+		conf := fmt.Sprintf(`{"worker_port": "%s", "auth_file": "%s", "worker_dir": "%s"}`,
+			port, auth_file, filepath.Join(cluster, "worker"))
+		if err := os.MkdirAll(filepath.Join(cluster, "config"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(configPath(cluster, "worker-0"), []byte(conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(auth_file)
+	if _, err := workerRequest(cluster, "worker-0", "", "POST", "/deadletters/x/redrive"); err != nil {
+		t.Fatal(err)
+	} else if key != "ops" {
+		t.Fatalf("Expected the first admin key to be used, got %s", key)
+	}
+	if _, err := workerRequest(cluster, "worker-0", "ops2", "DELETE", "/deadletters/x"); err != nil {
+		t.Fatal(err)
+	} else if key != "4dmin2" {
+		t.Fatalf("Expected the given key to be used, got %s", key)
+	}
+	if _, err := workerRequest(cluster, "worker-0", "web", "GET", "/deadletters"); err == nil {
+		t.Fatalf("Expected a key that is not admin to be denied")
+	}
+	if _, err := workerRequest(cluster, "worker-0", "nope", "GET", "/deadletters"); err == nil {
+		t.Fatalf("Expected an unknown key to be rejected")
+	}
+
+	// without an auth_file, no credentials are sent
+	writeConfig("")
+	if _, err := workerRequest(cluster, "worker-0", "", "GET", "/deadletters"); err == nil {
+		t.Fatalf("Expected a request without credentials to be denied")
+	}
+}
+
+// mustPort returns the port of a URL.
+func mustPort(t *testing.T, raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Port()
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -185,6 +184,11 @@ func status(ctx *cli.Context) error {
 		if err != nil {
 			return err
 		}
+		http_client, err := clusterClient(cluster)
+		if err != nil {
+			return err
+		}
+
 		fmt.Printf("Worker Pings:\n")
 		for _, fi := range logs {
 			if strings.HasSuffix(fi.Name(), ".pid") {
@@ -194,8 +198,12 @@ func status(ctx *cli.Context) error {
 					return err
 				}
 
-				url := fmt.Sprintf("http://localhost:%s/status", c.Worker_port)
-				response, err := http.Get(url)
+				scheme := "http"
+				if c.Tls_cert != "" {
+					scheme = "https"
+				}
+				url := fmt.Sprintf("%s://localhost:%s/status", scheme, c.Worker_port)
+				response, err := http_client.Get(url)
 				if err != nil {
 					fmt.Printf("  Could not send GET to %s\n", url)
 					continue
@@ -327,6 +335,17 @@ func workers(ctx *cli.Context) error {
 	foreach := ctx.Bool("foreach")
 	portbase := ctx.Int("port")
 	n := ctx.Int("num-workers")
+	use_tls := ctx.Bool("tls") || ctx.Bool("mtls")
+	use_mtls := ctx.Bool("mtls")
+
+	// client certificate for talking to workers that require one
+	if use_mtls {
+		cert, _, err := issueCert(cluster, "admin", false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Generated client certificate at %s\n", cert)
+	}
 
 	worker_confs := []*config.Config{}
 	if foreach {
@@ -371,6 +390,17 @@ func workers(ctx *cli.Context) error {
 		if err := os.Mkdir(conf.Worker_dir, 0700); err != nil {
 			return err
 		}
+		if use_tls {
+			cert, key, err := issueCert(cluster, fmt.Sprintf("worker-%d", i), true)
+			if err != nil {
+				return err
+			}
+			conf.Tls_cert = cert
+			conf.Tls_key = key
+		}
+		if use_mtls {
+			conf.Tls_client_ca = tlsPath(cluster, "ca.pem")
+		}
 		if err := conf.Save(conf_path); err != nil {
 			return err
 		}
@@ -792,7 +822,7 @@ OPTIONS:
 		cli.Command{
 			Name:        "workers",
 			Usage:       "Start one or more worker servers",
-			UsageText:   "admin workers --cluster=NAME [--foreach] [-p|--port=PORT] [-n|--num-workers=NUM]",
+			UsageText:   "admin workers --cluster=NAME [--foreach] [-p|--port=PORT] [-n|--num-workers=NUM] [--tls|--mtls]",
 			Description: "Start one or more workers in cluster using the same config template.",
 			Flags: []cli.Flag{
 				clusterFlag,
@@ -810,6 +840,14 @@ OPTIONS:
 					Usage: "To start `NUM` workers",
 					Value: 1,
 				},
+				cli.BoolFlag{
+					Name:  "tls",
+					Usage: "Serve HTTPS with certificates signed by a generated cluster CA",
+				},
+				cli.BoolFlag{
+					Name:  "mtls",
+					Usage: "Like --tls, but also require client certificates signed by the cluster CA",
+				},
 			},
 			Action: workers,
 		},
@@ -926,6 +964,25 @@ OPTIONS:
 			},
 			Action: cgroup_mgr,
 		},
+		cli.Command{
+			Name:        "deadletters",
+			Usage:       "List, inspect, redrive or delete events a worker failed to process",
+			UsageText:   "admin deadletters --cluster=NAME [--worker=NAME] [--key=ID] [list [LAMBDA] | inspect ID | redrive ID | delete ID]",
+			Description: "Manages the events that asynchronous and timed invocations failed to process (after retries), kept in the worker's dead_letter_dir.  Redriven events are queued again as asynchronous invocations.  If the worker has an auth_file, requests carry the credentials of its first admin key, or of the key given by --key.",
+			Flags: []cli.Flag{
+				clusterFlag,
+				cli.StringFlag{
+					Name:  "worker, w",
+					Usage: "`NAME` of the worker (e.g., worker-0)",
+					Value: "worker-0",
+				},
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "`ID` of the admin key in the worker's auth_file (by default, the first admin key)",
+				},
+			},
+			Action: deadletters,
+		},
 		cli.Command{
 			Name:      "kill",
 			Usage:     "Kill containers and processes in a cluster",
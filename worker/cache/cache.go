@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response of a lambda.
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// size estimates the memory used by an entry.
+func (e *Entry) size() int64 {
+	n := int64(len(e.Body))
+	for key, values := range e.Header {
+		for _, value := range values {
+			n += int64(len(key) + len(value))
+		}
+	}
+	return n
+}
+
+// Stats counts the entries of a lambda in a Cache, and the lookups of its
+// responses.
+type Stats struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// item is an Entry in the LRU list of a Cache.
+type item struct {
+	lambda  string
+	key     string
+	entry   *Entry
+	size    int64
+	expires time.Time
+}
+
+// Cache holds responses of lambdas, each for some time, up to a number of
+// bytes in all.  Past it, the least recently used responses are dropped.
+type Cache struct {
+	mutex sync.Mutex
+	max   int64
+	size  int64
+	lru   *list.List // of *item, most recently used first
+	items map[string]*list.Element
+	stats map[string]*Stats
+}
+
+// New creates a Cache holding up to max bytes of responses.
+func New(max int64) *Cache {
+	return &Cache{
+		max:   max,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+		stats: make(map[string]*Stats),
+	}
+}
+
+// Max returns the size of the cache, which is also the size of the largest
+// response it can hold.
+func (c *Cache) Max() int64 {
+	return c.max
+}
+
+// statsOf returns the Stats of a lambda.  The caller must hold the mutex.
+func (c *Cache) statsOf(lambda string) *Stats {
+	stats := c.stats[lambda]
+	if stats == nil {
+		stats = &Stats{}
+		c.stats[lambda] = stats
+	}
+	return stats
+}
+
+// Get returns the response of a lambda cached under key, or nil if there is
+// none (or it has expired), and counts a hit or a miss.
+func (c *Cache) Get(lambda string, key string) *Entry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.statsOf(lambda)
+	if el, ok := c.items[key]; ok {
+		it := el.Value.(*item)
+		if time.Now().Before(it.expires) {
+			c.lru.MoveToFront(el)
+			stats.Hits += 1
+			return it.entry
+		}
+		c.remove(el)
+	}
+
+	stats.Misses += 1
+	return nil
+}
+
+// Put caches a response of a lambda under key for ttl, dropping the least
+// recently used responses to make room.  Responses larger than the cache
+// are not cached.
+func (c *Cache) Put(lambda string, key string, entry *Entry, ttl time.Duration) {
+	it := &item{
+		lambda:  lambda,
+		key:     key,
+		entry:   entry,
+		size:    entry.size(),
+		expires: time.Now().Add(ttl),
+	}
+	if it.size > c.max {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	for c.size+it.size > c.max {
+		c.remove(c.lru.Back())
+	}
+
+	c.items[key] = c.lru.PushFront(it)
+	c.size += it.size
+	stats := c.statsOf(lambda)
+	stats.Entries += 1
+	stats.Bytes += it.size
+}
+
+// remove drops an item.  The caller must hold the mutex.
+func (c *Cache) remove(el *list.Element) {
+	it := el.Value.(*item)
+	c.lru.Remove(el)
+	delete(c.items, it.key)
+	c.size -= it.size
+
+	stats := c.statsOf(it.lambda)
+	stats.Entries -= 1
+	stats.Bytes -= it.size
+}
+
+// Purge drops the responses of a lambda (or of all lambdas, if lambda is
+// empty), and returns how many there were.
+func (c *Cache) Purge(lambda string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n := 0
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if lambda == "" || el.Value.(*item).lambda == lambda {
+			c.remove(el)
+			n += 1
+		}
+		el = next
+	}
+	return n
+}
+
+// Stats returns the Stats of each lambda whose responses were looked up or
+// cached.
+func (c *Cache) Stats() map[string]Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := make(map[string]Stats, len(c.stats))
+	for lambda, s := range c.stats {
+		stats[lambda] = *s
+	}
+	return stats
+}
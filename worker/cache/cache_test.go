@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func entry(body string) *Entry {
+	return &Entry{Status: 200, Body: []byte(body)}
+}
+
+func TestCache(t *testing.T) {
+	c := New(10)
+
+	if c.Get("f", "a") != nil {
+		t.Fatalf("Expected a miss on an empty cache")
+	}
+	c.Put("f", "a", entry("aaaa"), time.Minute)
+	c.Put("g", "b", entry("bbbb"), time.Minute)
+	if e := c.Get("f", "a"); e == nil || string(e.Body) != "aaaa" {
+		t.Fatalf("Expected a hit, got %v", e)
+	}
+
+	// b is the least recently used, so it makes room for c
+	c.Put("f", "c", entry("cccc"), time.Minute)
+	if c.Get("g", "b") != nil {
+		t.Fatalf("Expected b to be dropped")
+	}
+	if c.Get("f", "a") == nil || c.Get("f", "c") == nil {
+		t.Fatalf("Expected a and c to be cached")
+	}
+
+	// too large to cache at all
+	c.Put("f", "d", entry("ddddddddddd"), time.Minute)
+	if c.Get("f", "d") != nil {
+		t.Fatalf("Expected d not to be cached")
+	}
+
+	stats := c.Stats()
+	if f := stats["f"]; f.Entries != 2 || f.Bytes != 8 || f.Hits != 3 || f.Misses != 2 {
+		t.Fatalf("Unexpected stats for f: %+v", f)
+	}
+	if g := stats["g"]; g.Entries != 0 || g.Misses != 1 {
+		t.Fatalf("Unexpected stats for g: %+v", g)
+	}
+
+	if n := c.Purge("f"); n != 2 {
+		t.Fatalf("Expected 2 entries purged, got %d", n)
+	}
+	if c.Get("f", "a") != nil {
+		t.Fatalf("Expected a to be purged")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := New(100)
+	c.Put("f", "a", entry("a"), 10*time.Millisecond)
+	if c.Get("f", "a") == nil {
+		t.Fatalf("Expected a hit before expiry")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if c.Get("f", "a") != nil {
+		t.Fatalf("Expected a miss after expiry")
+	}
+	if f := c.Stats()["f"]; f.Entries != 0 || f.Bytes != 0 {
+		t.Fatalf("Expected expired entry dropped, got %+v", f)
+	}
+}
@@ -35,6 +35,102 @@ type Config struct {
 	Worker_port string `json:"worker_port"`
 	Docker_host string `json:"docker_host"`
 
+	// default for the timeout of lambda-config.json, in seconds
+	Lambda_timeout int `json:"lambda_timeout"`
+
+	// when the code of a lambda is pulled again, once pulled: "never"
+	// (unless refreshed through /handlers), "ttl" (every
+	// Code_refresh_interval seconds), or "mtime" or "digest" (when the
+	// files of its code directory change, checked every
+	// Code_refresh_interval seconds, or on every request if negative)
+	Code_refresh          string `json:"code_refresh"`
+	Code_refresh_interval int    `json:"code_refresh_interval"`
+
+	// concurrent requests per worker (0 means unlimited), and how
+	// many requests over the limits may wait, for how many seconds
+	Max_concurrency int `json:"max_concurrency"`
+	Max_queue_len   int `json:"max_queue_len"`
+	Queue_timeout   int `json:"queue_timeout"`
+
+	// items of a /runBatch request run at once, for lambdas without
+	// a max_concurrency, and how many items a request may have
+	Batch_concurrency int `json:"batch_concurrency"`
+	Batch_max_events  int `json:"batch_max_events"`
+
+	// asynchronous invocations
+	Async_workers   int `json:"async_workers"`
+	Async_queue_len int `json:"async_queue_len"`
+	Job_ttl         int `json:"job_ttl"` // seconds to keep finished jobs
+
+	// bytes in a request or response body (negative means unlimited);
+	// request bodies over Spill_threshold bytes are staged to disk
+	Max_body_size     int `json:"max_body_size"`
+	Max_response_size int `json:"max_response_size"`
+	Spill_threshold   int `json:"spill_threshold"`
+
+	// MB of responses cached for lambdas with a cache in their
+	// lambda-config.json (negative means no cache)
+	Cache_size int `json:"cache_size"`
+
+	// where to write the JSON access log: "stdout", "stderr" or a
+	// file, rotated at Access_log_max_size MB (none if empty)
+	Access_log          string `json:"access_log"`
+	Access_log_max_size int    `json:"access_log_max_size"`
+	Access_log_backups  int    `json:"access_log_backups"`
+
+	// where to export trace spans, as OTLP/JSON: the URL of a
+	// collector, or a file (no tracing if empty)
+	Trace_export string `json:"trace_export"`
+
+	// timed invocations of any lambda (a JSON array, see
+	// ScheduleEntry), in addition to those in lambda-config.json
+	// files, and how many runs of each to remember
+	Schedule_file    string `json:"schedule_file"`
+	Schedule_history int    `json:"schedule_history"`
+
+	// where the directories watched for lambdas (see WatchConfig) are,
+	// unless the lambda-config.json gives an absolute path
+	Drop_dir string `json:"drop_dir"`
+
+	// absolute directories beyond drop_dir that lambdas may watch, along
+	// with their subdirectories (none if empty)
+	Watch_dirs []string `json:"watch_dirs"`
+
+	// where events that asynchronous and timed invocations failed to
+	// process are kept, and how many at most (the oldest are dropped)
+	Dead_letter_dir string `json:"dead_letter_dir"`
+	Dead_letter_max int    `json:"dead_letter_max"`
+
+	// where workflows (DAGs of lambda invocations) are defined, one
+	// <name>.json file each
+	Workflow_dir string `json:"workflow_dir"`
+
+	// where the aliases of lambdas (name@alias, pointing to versions) are
+	// saved
+	Alias_file string `json:"alias_file"`
+
+	// maps hosts, methods and paths to lambdas (a JSON array, see
+	// routes.Route), reloaded when it changes
+	Routes_file string `json:"routes_file"`
+
+	// secrets that lambdas may reference by name (a JSON object mapping
+	// names to values), and a directory on a tmpfs where the secrets
+	// passed as files are written, to be mounted in the sandboxes
+	Secrets_file    string `json:"secrets_file"`
+	Secrets_tmp_dir string `json:"secrets_tmp_dir"`
+
+	// seconds to wait for in-flight requests when shutting down
+	Shutdown_timeout int `json:"shutdown_timeout"`
+
+	// keys allowed to invoke lambdas (no authentication if empty)
+	Auth_file string `json:"auth_file"`
+
+	// serve HTTPS with this certificate and key (PEM files), and
+	// require client certificates signed by Tls_client_ca if set
+	Tls_cert      string `json:"tls_cert"`
+	Tls_key       string `json:"tls_key"`
+	Tls_client_ca string `json:"tls_client_ca"`
+
 	// for unit testing to skip pull path
 	Skip_pull_existing bool `json:"Skip_pull_existing"`
 
@@ -93,6 +189,100 @@ func (c *Config) Defaults() error {
 		c.Num_forkservers = 5
 	}
 
+	if c.Lambda_timeout == 0 {
+		c.Lambda_timeout = 300
+	}
+
+	switch c.Code_refresh {
+	case "":
+		c.Code_refresh = "never"
+	case "never", "ttl":
+	case "mtime", "digest":
+		// only the local registry keeps the code where it is
+		// changed; the others are only seen by pulling again
+		if c.Registry == "docker" || c.Registry == "olregistry" {
+			return fmt.Errorf("code_refresh %s needs the code of lambdas in a local directory; use ttl with the %s registry", c.Code_refresh, c.Registry)
+		}
+	default:
+		return fmt.Errorf("code_refresh must be never, ttl, mtime or digest, not %s", c.Code_refresh)
+	}
+
+	if c.Code_refresh_interval == 0 {
+		if c.Code_refresh == "ttl" {
+			c.Code_refresh_interval = 300
+		} else {
+			c.Code_refresh_interval = 2
+		}
+	}
+
+	if c.Max_queue_len == 0 {
+		c.Max_queue_len = 100
+	}
+
+	if c.Queue_timeout == 0 {
+		c.Queue_timeout = 30
+	}
+
+	if c.Max_body_size == 0 {
+		c.Max_body_size = 32 << 20
+	}
+
+	if c.Max_response_size == 0 {
+		c.Max_response_size = 32 << 20
+	}
+
+	if c.Spill_threshold == 0 {
+		c.Spill_threshold = 1 << 20
+	}
+
+	if c.Access_log_max_size == 0 {
+		c.Access_log_max_size = 100
+	}
+
+	if c.Access_log_backups == 0 {
+		c.Access_log_backups = 5
+	}
+
+	if c.Shutdown_timeout == 0 {
+		c.Shutdown_timeout = 30
+	}
+
+	if c.Cache_size == 0 {
+		c.Cache_size = 64
+	}
+
+	if c.Batch_concurrency == 0 {
+		c.Batch_concurrency = 10
+	} else if c.Batch_concurrency < 0 {
+		return fmt.Errorf("batch_concurrency must not be negative")
+	}
+
+	if c.Batch_max_events == 0 {
+		c.Batch_max_events = 1000
+	}
+
+	if c.Dead_letter_max == 0 {
+		c.Dead_letter_max = 1000
+	}
+
+	if c.Schedule_history == 0 {
+		c.Schedule_history = 20
+	}
+
+	if c.Async_workers == 0 {
+		c.Async_workers = 4
+	}
+
+	if c.Async_queue_len == 0 {
+		c.Async_queue_len = 100
+	}
+
+	if c.Job_ttl == 0 {
+		c.Job_ttl = 600
+	} else if c.Job_ttl < 0 {
+		return fmt.Errorf("job_ttl must not be negative")
+	}
+
 	if c.Registry == "docker" {
 		if c.Registry_host == "" {
 			return fmt.Errorf("must specify registry_host\n")
@@ -136,6 +326,69 @@ func (c *Config) Defaults() error {
 		c.Worker_dir = path
 	}
 
+	if c.Drop_dir == "" {
+		c.Drop_dir = filepath.Join(c.Worker_dir, "drop")
+	}
+	if c.Dead_letter_dir == "" {
+		c.Dead_letter_dir = filepath.Join(c.Worker_dir, "deadletter")
+	}
+	if c.Workflow_dir == "" {
+		c.Workflow_dir = filepath.Join(c.Worker_dir, "workflows")
+	}
+	if c.Alias_file == "" {
+		c.Alias_file = filepath.Join(c.Worker_dir, "aliases.json")
+	}
+	if c.Routes_file == "" {
+		c.Routes_file = filepath.Join(c.Worker_dir, "routes.json")
+	}
+	if c.Secrets_file == "" {
+		c.Secrets_file = filepath.Join(c.Worker_dir, "secrets.json")
+	}
+	if c.Secrets_tmp_dir == "" {
+		c.Secrets_tmp_dir = "/dev/shm/ol-secrets"
+	}
+
+	// auth, TLS, schedule, drop, dead letter, workflow, alias, routes and
+	// secrets files
+	files := map[string]*string{
+		"Auth_file":       &c.Auth_file,
+		"Tls_cert":        &c.Tls_cert,
+		"Tls_key":         &c.Tls_key,
+		"Tls_client_ca":   &c.Tls_client_ca,
+		"Schedule_file":   &c.Schedule_file,
+		"Drop_dir":        &c.Drop_dir,
+		"Workflow_dir":    &c.Workflow_dir,
+		"Dead_letter_dir": &c.Dead_letter_dir,
+		"Alias_file":      &c.Alias_file,
+		"Routes_file":     &c.Routes_file,
+		"Secrets_file":    &c.Secrets_file,
+		"Secrets_tmp_dir": &c.Secrets_tmp_dir,
+	}
+	if c.Access_log != "stdout" && c.Access_log != "stderr" {
+		files["Access_log"] = &c.Access_log
+	}
+	if !strings.HasPrefix(c.Trace_export, "http://") && !strings.HasPrefix(c.Trace_export, "https://") {
+		files["Trace_export"] = &c.Trace_export
+	}
+	for name, file := range files {
+		if err := c.absPath(name, file); err != nil {
+			return err
+		}
+	}
+	for i := range c.Watch_dirs {
+		if err := c.absPath("Watch_dirs", &c.Watch_dirs[i]); err != nil {
+			return err
+		}
+		c.Watch_dirs[i] = filepath.Clean(c.Watch_dirs[i])
+	}
+
+	if (c.Tls_cert == "") != (c.Tls_key == "") {
+		return fmt.Errorf("must specify both tls_cert and tls_key")
+	}
+	if c.Tls_client_ca != "" && c.Tls_cert == "" {
+		return fmt.Errorf("tls_client_ca requires tls_cert and tls_key")
+	}
+
 	// daemon
 	if c.Docker_host == "" {
 		client, err := docker.NewClientFromEnv()
@@ -160,6 +413,25 @@ func (c *Config) Defaults() error {
 	return nil
 }
 
+// absPath makes the (optional) file path of a field absolute, relative to
+// the directory of the config file.
+func (c *Config) absPath(name string, file *string) error {
+	if *file == "" || path.IsAbs(*file) {
+		return nil
+	}
+
+	if c.path == "" {
+		return fmt.Errorf("%s cannot be relative, unless config is loaded from file", name)
+	}
+	abs, err := filepath.Abs(path.Join(path.Dir(c.path), *file))
+	if err != nil {
+		return err
+	}
+	*file = abs
+
+	return nil
+}
+
 // ParseConfig reads a file and tries to parse it as a JSON string to a Config
 // instance.
 func ParseConfig(path string) (*Config, error) {
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LambdaConfigFile is the name of the per-lambda config file, which is
+// shipped alongside the code of the lambda.
+const LambdaConfigFile = "lambda-config.json"
+
+// LambdaConfig represents the configuration of a single lambda.
+type LambdaConfig struct {
+	// seconds a request may run in the sandbox (0 means use the
+	// worker's lambda_timeout)
+	Timeout int `json:"timeout"`
+
+	// concurrent requests in the sandbox (0 means unlimited); requests
+	// over the limit wait in the worker's queue
+	Max_concurrency int `json:"max_concurrency"`
+
+	// bytes in a request or response body (0 means use the worker's
+	// limits, which a lambda can lower but not raise)
+	Max_body_size     int `json:"max_body_size"`
+	Max_response_size int `json:"max_response_size"`
+
+	// sandboxes kept warm (created and started, and paused while idle)
+	// from the start of the worker, and warmed again once evicted while
+	// the worker has room for more paused sandboxes.  A worker runs one
+	// sandbox per lambda, so any value over 0 keeps it warm.
+	Min_warm int `json:"min_warm"`
+
+	// timed invocations of the lambda
+	Schedule []ScheduleEntry `json:"schedule"`
+
+	// a directory whose new files trigger the lambda (nil if none)
+	Watch *WatchConfig `json:"watch"`
+
+	// retries of asynchronous and timed invocations that fail (nil
+	// means no retries)
+	Retry *RetryConfig `json:"retry"`
+
+	// caching of responses, for lambdas whose responses only depend on
+	// their requests (nil if none)
+	Cache *CacheConfig `json:"cache"`
+
+	// environment variables of the sandbox
+	Env map[string]string `json:"env"`
+
+	// secrets of the worker's secrets_file passed to the sandbox
+	Secrets []SecretConfig `json:"secrets"`
+}
+
+// SecretConfig passes a secret, by name, to the sandbox of a lambda: in an
+// environment variable, or in a file of SecretsDir (on a tmpfs), or both.
+// The value of the secret is never written to the code directory.
+type SecretConfig struct {
+	Name string `json:"name"`
+	Env  string `json:"env"`
+	File string `json:"file"`
+}
+
+// CacheConfig tells how long the responses of a lambda are cached.  Only
+// successful (2xx) responses are, unless they have a "Cache-Control:
+// no-store" header.
+type CacheConfig struct {
+	// seconds a response is served from the cache
+	Ttl int `json:"ttl"`
+
+	// request headers the response depends on, besides Accept, which
+	// are part of the cache key
+	Vary []string `json:"vary"`
+}
+
+// WatchConfig is a directory watched for files to pass to a lambda.  Each
+// new file is moved to the sandbox, and then to a done or failed directory
+// within the watched one, depending on the outcome of the invocation.
+type WatchConfig struct {
+	// the directory, relative to (and within) the worker's drop_dir,
+	// or an absolute path within one of the worker's watch_dirs
+	// (<drop_dir>/<lambda> if empty)
+	Dir string `json:"dir"`
+
+	// only files whose names match this pattern (see filepath.Match)
+	// trigger the lambda (all files if empty)
+	Pattern string `json:"pattern"`
+}
+
+// RetryConfig tells how often a failed invocation (a server error or a 429
+// status, or a failure to reach the sandbox) is attempted again.  Events that
+// still fail are kept in the worker's dead_letter_dir.
+type RetryConfig struct {
+	// attempts after the first
+	Max_retries int `json:"max_retries"`
+
+	// seconds before the first retry, doubling for each next one up to
+	// Max_backoff seconds (0 means no maximum)
+	Backoff     float64 `json:"backoff"`
+	Max_backoff float64 `json:"max_backoff"`
+}
+
+// ParseLambdaConfig reads the lambda-config.json in the code directory of a
+// lambda.  Lambdas without the file (or without a code directory) get an
+// empty LambdaConfig.
+func ParseLambdaConfig(code_dir string) (*LambdaConfig, error) {
+	var lconf LambdaConfig
+
+	if code_dir == "" {
+		return &lconf, nil
+	}
+
+	path := filepath.Join(code_dir, LambdaConfigFile)
+	config_raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &lconf, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open lambda config (%v): %v\n", path, err.Error())
+	}
+
+	if err := json.Unmarshal(config_raw, &lconf); err != nil {
+		return nil, fmt.Errorf("could not parse lambda config (%v): %v\n", path, err.Error())
+	}
+
+	return &lconf, nil
+}
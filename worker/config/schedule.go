@@ -0,0 +1,71 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Missed-run policies of a ScheduleEntry
+const (
+	MissedSkip    = "skip"
+	MissedRunOnce = "run_once"
+)
+
+// ScheduleEntry is a timed invocation of a lambda, listed under "schedule"
+// in its lambda-config.json or in the worker's schedule_file.
+type ScheduleEntry struct {
+	// lambda to invoke (only in the schedule_file; entries in a
+	// lambda-config.json invoke that lambda)
+	Lambda string `json:"lambda,omitempty"`
+
+	// when to invoke it, e.g., "*/5 * * * *" or "@every 90s"
+	Cron string `json:"cron"`
+
+	// the event passed to the lambda (null if missing)
+	Event json.RawMessage `json:"event,omitempty"`
+
+	// up to how many seconds to randomly delay each run by
+	Jitter int `json:"jitter"`
+
+	// start a run even if the previous one is still running
+	Allow_overlap bool `json:"allow_overlap"`
+
+	// what to do about runs missed while the worker was down: "skip"
+	// them (the default), or "run_once" to catch up with a single run
+	Missed string `json:"missed"`
+}
+
+// Validate checks the fields of a ScheduleEntry other than Cron, which the
+// scheduler parses.
+func (e *ScheduleEntry) Validate() error {
+	if e.Lambda == "" {
+		return fmt.Errorf("schedule entry %q has no lambda", e.Cron)
+	}
+	if e.Jitter < 0 {
+		return fmt.Errorf("schedule entry %q of %s has negative jitter", e.Cron, e.Lambda)
+	}
+	switch e.Missed {
+	case "", MissedSkip, MissedRunOnce:
+	default:
+		return fmt.Errorf("schedule entry %q of %s has unknown missed policy %q (must be %s or %s)",
+			e.Cron, e.Lambda, e.Missed, MissedSkip, MissedRunOnce)
+	}
+	return nil
+}
+
+// ParseScheduleFile reads a cluster-level schedule: a JSON array of
+// ScheduleEntry, each naming its lambda.
+func ParseScheduleFile(path string) ([]ScheduleEntry, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open schedule file (%v): %v", path, err)
+	}
+
+	var entries []ScheduleEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse schedule file (%v): %v", path, err)
+	}
+
+	return entries, nil
+}
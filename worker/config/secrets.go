@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// SecretsDir is where the secrets passed as files are mounted in a sandbox.
+const SecretsDir = "/run/secrets"
+
+// Secret is a value that only some lambdas may reference.
+type Secret struct {
+	Value string `json:"value"`
+
+	// names of lambdas, or name prefixes ending with "*"
+	Lambdas []string `json:"lambdas"`
+}
+
+// LoadSecrets reads the secrets of the worker, a JSON object mapping names to
+// Secrets, like this:
+//
+// {"db-password": {"value": "...", "lambdas": ["billing*"]}}
+//
+// There are none if the file does not exist.
+func LoadSecrets(path string) (map[string]*Secret, error) {
+	secrets := map[string]*Secret{}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open secrets file (%v): %v", path, err)
+	}
+
+	// the error of Unmarshal may quote the file, so it is not passed on
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return nil, fmt.Errorf("could not parse secrets file (%v): not a JSON object of secrets", path)
+	}
+	for name, secret := range secrets {
+		if secret == nil {
+			return nil, fmt.Errorf("could not parse secrets file (%v): secret %s is null", path, name)
+		}
+	}
+	return secrets, nil
+}
+
+// Allows tells whether the secret is scoped to the named lambda.
+func (s *Secret) Allows(lambda string) bool {
+	for _, scope := range s.Lambdas {
+		if strings.HasSuffix(scope, "*") {
+			if strings.HasPrefix(lambda, scope[:len(scope)-1]) {
+				return true
+			}
+		} else if scope == lambda {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a reference to a secret.
+func (s *SecretConfig) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("secret needs a name")
+	}
+	if s.Env == "" && s.File == "" {
+		return fmt.Errorf("secret %s needs an env or a file", s.Name)
+	}
+	if s.Env != "" && !ValidEnvName(s.Env) {
+		return fmt.Errorf("invalid environment variable %q for secret %s", s.Env, s.Name)
+	}
+	if s.File != "" && (strings.ContainsAny(s.File, "/\x00") || s.File == "." || s.File == "..") {
+		return fmt.Errorf("invalid file %q for secret %s", s.File, s.Name)
+	}
+	return nil
+}
+
+// ValidEnvName tells whether a string may name an environment variable.
+func ValidEnvName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "=\x00")
+}
@@ -0,0 +1,176 @@
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+)
+
+func TestNext(t *testing.T) {
+	// a Saturday
+	base := time.Date(2022, 1, 1, 10, 30, 15, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2022, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2022, 1, 1, 11, 5, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2022, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * mon", time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * mon", time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if next := s.Next(base); !next.Equal(c.next) {
+			t.Errorf("%s: expected %v, got %v", c.expr, c.next, next)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@every -1s", "@every soon"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+// recorder is an Invoker that counts runs, and holds each for a while.
+type recorder struct {
+	mutex sync.Mutex
+	runs  int
+	hold  time.Duration
+}
+
+func (r *recorder) invoke(lambda string, event []byte) (int, error) {
+	r.mutex.Lock()
+	r.runs += 1
+	r.mutex.Unlock()
+	time.Sleep(r.hold)
+	return 200, nil
+}
+
+func (r *recorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.runs
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	rec := &recorder{hold: 250 * time.Millisecond}
+	s := NewScheduler(rec.invoke, 10, "")
+
+	err := s.Update([]config.ScheduleEntry{
+		{Lambda: "slow", Cron: "@every 100ms"},
+		{Lambda: "bad", Cron: "every minute"},
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid entry")
+	}
+
+	time.Sleep(520 * time.Millisecond)
+	s.Close(context.Background())
+
+	infos := s.List("slow")
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(infos))
+	}
+	skipped := 0
+	for _, run := range infos[0].Runs {
+		if run.Skipped == SkipOverlap {
+			skipped += 1
+		}
+	}
+	if rec.count() == 0 || skipped < 2 {
+		t.Fatalf("expected runs and skipped runs, got %d runs, %d skipped", rec.count(), skipped)
+	}
+}
+
+func TestSchedulerMissed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the last runs were handled an hour ago
+	state := map[string]jobState{
+		"once * * * * *": {Last: time.Now().Add(-time.Hour)},
+		"skip * * * * *": {Last: time.Now().Add(-time.Hour)},
+	}
+	path := filepath.Join(dir, "schedule.json")
+	raw, _ := json.Marshal(state)
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	s := NewScheduler(rec.invoke, 10, path)
+	err = s.Update([]config.ScheduleEntry{
+		{Lambda: "once", Cron: "* * * * *", Missed: config.MissedRunOnce},
+		{Lambda: "skip", Cron: "* * * * *"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	s.Close(context.Background())
+
+	if rec.count() != 1 {
+		t.Fatalf("expected 1 catch-up run, got %d", rec.count())
+	}
+	for _, info := range s.List("") {
+		run := info.Runs[0]
+		if run.Missed < 59 {
+			t.Fatalf("expected about 60 missed runs of %s, got %+v", info.Lambda, run)
+		}
+		if (info.Lambda == "skip") != (run.Skipped == SkipMissed) {
+			t.Fatalf("unexpected run of %s: %+v", info.Lambda, run)
+		}
+	}
+
+	// the history survives restarts
+	s = NewScheduler(rec.invoke, 10, path)
+	if len(s.state["once * * * * *"].Runs) != 1 {
+		t.Fatalf("expected saved history, got %+v", s.state)
+	}
+}
+
+func TestSchedulerCloseTimeout(t *testing.T) {
+	rec := &recorder{hold: 5 * time.Second}
+	s := NewScheduler(rec.invoke, 10, "")
+	if err := s.Update([]config.ScheduleEntry{{Lambda: "stuck", Cron: "@every 10ms"}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// a stuck run does not hold up the shutdown past its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	t0 := time.Now()
+	if err := s.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+	if elapsed := time.Since(t0); elapsed > time.Second {
+		t.Fatalf("expected Close to give up at the deadline, took %v", elapsed)
+	}
+}
@@ -0,0 +1,209 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a cron expression fires.
+type Schedule interface {
+	// Next returns the first time the schedule fires after t.
+	Next(t time.Time) time.Time
+}
+
+// fields is a schedule with the usual five fields of crontab(5): each is a
+// bit set of the values the field may take.
+type fields struct {
+	minute, hour, dom, month, dow uint64
+
+	// crontab(5): if both days of month and of week are restricted,
+	// either may match
+	domStar, dowStar bool
+}
+
+// every is a schedule firing at a fixed interval.
+type every time.Duration
+
+type fieldRange struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = fieldRange{name: "minute", min: 0, max: 59}
+	hours   = fieldRange{name: "hour", min: 0, max: 23}
+	doms    = fieldRange{name: "day of month", min: 1, max: 31}
+	months  = fieldRange{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dows = fieldRange{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression: five fields (minute, hour, day of month,
+// month and day of week) as in crontab(5), one of the macros @yearly,
+// @monthly, @weekly, @daily or @hourly, or "@every <duration>" (e.g.,
+// "@every 90s").
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(expr[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("bad cron expression %q: interval must be positive", expr)
+		}
+		return every(d), nil
+	}
+	if macro, ok := macros[expr]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("bad cron expression %q: expected 5 fields, got %d", expr, len(parts))
+	}
+
+	var s fields
+	var err error
+	if s.minute, err = parseField(parts[0], minutes); err != nil {
+		return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+	}
+	if s.hour, err = parseField(parts[1], hours); err != nil {
+		return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+	}
+	if s.dom, err = parseField(parts[2], doms); err != nil {
+		return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+	}
+	if s.month, err = parseField(parts[3], months); err != nil {
+		return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+	}
+	if s.dow, err = parseField(parts[4], dows); err != nil {
+		return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+	}
+
+	// 7 is Sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(parts[2], "*")
+	s.dowStar = strings.HasPrefix(parts[4], "*")
+
+	return &s, nil
+}
+
+// parseField parses one field: a comma-separated list of *, values and
+// ranges, each optionally with a /step.
+func parseField(field string, r fieldRange) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %s %q", r.name, item)
+			}
+			item = item[:i]
+		}
+
+		lo, hi := r.min, r.max
+		if item != "*" {
+			var err error
+			bounds := strings.SplitN(item, "-", 2)
+			if lo, err = r.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = r.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "5/15" means "5-max/15"
+				hi = r.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("bad range in %s %q", r.name, item)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// value parses a number or name within the range of a field.
+func (r fieldRange) value(s string) (int, error) {
+	if v, ok := r.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < r.min || v > r.max {
+		return 0, fmt.Errorf("bad %s %q (must be %d-%d)", r.name, s, r.min, r.max)
+	}
+	return v, nil
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (s *fields) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// schedules such as "0 0 30 2 *" never fire; give up after a
+	// few years of trying
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *fields) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,404 @@
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+)
+
+// Reasons for skipping a run
+const (
+	SkipOverlap = "overlap" // the previous run was still running
+	SkipMissed  = "missed"  // the worker was down at the time
+)
+
+// at most this many missed runs are looked for, when catching up
+const maxMissed = 100000
+
+// Invoker runs a lambda on an event, and returns the status code of the
+// response.
+type Invoker func(lambda string, event []byte) (int, error)
+
+// Run is a (possibly skipped) run of a ScheduleEntry.
+type Run struct {
+	Scheduled time.Time  `json:"scheduled"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Status    int        `json:"status,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Skipped   string     `json:"skipped,omitempty"`
+	Missed    int        `json:"missed,omitempty"` // runs caught up with
+}
+
+// EntryInfo is a snapshot of a ScheduleEntry and its recent runs.
+type EntryInfo struct {
+	config.ScheduleEntry
+	Next    *time.Time `json:"next,omitempty"`
+	Running int        `json:"running"`
+	Runs    []Run      `json:"runs"`
+}
+
+// job is a ScheduleEntry being scheduled.
+type job struct {
+	key      string
+	entry    config.ScheduleEntry
+	schedule Schedule
+	stop     chan bool
+
+	// protected by the Scheduler's mutex
+	last    time.Time // last scheduled time handled
+	next    time.Time
+	running int
+	runs    []Run // most recent last
+}
+
+// jobState is what is saved of a job, so missed runs can be detected and
+// the history survives restarts.
+type jobState struct {
+	Last time.Time `json:"last"`
+	Runs []Run     `json:"runs"`
+}
+
+// Scheduler invokes lambdas according to ScheduleEntries.
+type Scheduler struct {
+	mutex      sync.Mutex
+	jobs       map[string]*job
+	invoke     Invoker
+	history    int
+	state_path string
+	state      map[string]jobState // of jobs not (yet) scheduled
+	runs       sync.WaitGroup
+	closed     bool
+}
+
+// NewScheduler creates a Scheduler with no entries.  It remembers the last
+// history runs of each entry, in a file at state_path (if not "") so that
+// runs missed while the worker is down can be detected.
+func NewScheduler(invoke Invoker, history int, state_path string) *Scheduler {
+	s := &Scheduler{
+		jobs:       make(map[string]*job),
+		invoke:     invoke,
+		history:    history,
+		state_path: state_path,
+		state:      make(map[string]jobState),
+	}
+
+	if state_path != "" {
+		raw, err := ioutil.ReadFile(state_path)
+		if err == nil {
+			err = json.Unmarshal(raw, &s.state)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("could not read schedule state (%v): %v\n", state_path, err)
+		}
+	}
+
+	return s
+}
+
+// entryKey identifies an entry across updates: the nth entry with the same
+// lambda and cron expression.
+func entryKey(entry config.ScheduleEntry, seen map[string]int) string {
+	key := entry.Lambda + " " + strings.TrimSpace(entry.Cron)
+	seen[key] += 1
+	if n := seen[key]; n > 1 {
+		key = fmt.Sprintf("%s #%d", key, n)
+	}
+	return key
+}
+
+// Update replaces the entries of the Scheduler.  Entries that did not change
+// keep their schedule and history.  Invalid entries are left out, and
+// reported in the returned error.
+func (s *Scheduler) Update(entries []config.ScheduleEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	errs := []string{}
+	seen := make(map[string]int)
+	keep := make(map[string]bool)
+	for _, entry := range entries {
+		if err := entry.Validate(); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		schedule, err := Parse(entry.Cron)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", entry.Lambda, err))
+			continue
+		}
+
+		key := entryKey(entry, seen)
+		keep[key] = true
+		if j := s.jobs[key]; j != nil {
+			if entriesEqual(j.entry, entry) {
+				continue
+			}
+			s.unschedule(j)
+		}
+
+		j := &job{key: key, entry: entry, schedule: schedule, stop: make(chan bool)}
+		if state, ok := s.state[key]; ok {
+			j.last = state.Last
+			j.runs = state.Runs
+			delete(s.state, key)
+		}
+		s.jobs[key] = j
+		go s.loop(j)
+	}
+
+	for key, j := range s.jobs {
+		if !keep[key] {
+			s.unschedule(j)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid schedule entries: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func entriesEqual(a config.ScheduleEntry, b config.ScheduleEntry) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// unschedule stops a job, keeping its state in case it comes back.  The
+// caller must hold the mutex.
+func (s *Scheduler) unschedule(j *job) {
+	close(j.stop)
+	delete(s.jobs, j.key)
+	s.state[j.key] = jobState{Last: j.last, Runs: j.runs}
+}
+
+// loop runs a job at its scheduled times, until it is stopped.
+func (s *Scheduler) loop(j *job) {
+	s.mutex.Lock()
+	if j.last.IsZero() {
+		j.last = time.Now()
+	}
+	s.mutex.Unlock()
+
+	for {
+		s.mutex.Lock()
+		now := time.Now()
+		next := j.schedule.Next(j.last)
+		if !next.IsZero() && next.Before(now) {
+			s.catchUp(j, next, now)
+			s.mutex.Unlock()
+			continue
+		}
+		j.next = next
+		s.mutex.Unlock()
+
+		if next.IsZero() {
+			// never fires
+			<-j.stop
+			return
+		}
+
+		delay := next.Sub(now)
+		if j.entry.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(j.entry.Jitter) * int64(time.Second)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-j.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mutex.Lock()
+		select {
+		case <-j.stop:
+			// unscheduled while waiting for the mutex
+			s.mutex.Unlock()
+			return
+		default:
+		}
+		j.last = next
+		s.start(j, Run{Scheduled: next})
+		s.mutex.Unlock()
+	}
+}
+
+// catchUp handles the runs of a job due before now, starting at next,
+// according to its missed-run policy.  The caller must hold the mutex.
+func (s *Scheduler) catchUp(j *job, next time.Time, now time.Time) {
+	missed := 0
+	latest := next
+	for t := next; !t.IsZero() && !t.After(now); t = j.schedule.Next(t) {
+		missed += 1
+		latest = t
+		if missed == maxMissed {
+			// stop counting, and start over from now
+			latest = now
+			break
+		}
+	}
+	j.last = latest
+
+	log.Printf("%d runs of %s (%s) missed since %v\n", missed, j.entry.Lambda, j.entry.Cron, next)
+	if j.entry.Missed == config.MissedRunOnce {
+		s.start(j, Run{Scheduled: latest, Missed: missed})
+	} else {
+		s.record(j, Run{Scheduled: latest, Skipped: SkipMissed, Missed: missed})
+	}
+}
+
+// start starts a run of a job, unless it would overlap with a previous run
+// that is not allowed to.  The caller must hold the mutex.
+func (s *Scheduler) start(j *job, run Run) {
+	if s.closed {
+		return
+	}
+	if j.running > 0 && !j.entry.Allow_overlap {
+		log.Printf("Skip run of %s (%s): previous run still running\n", j.entry.Lambda, j.entry.Cron)
+		run.Skipped = SkipOverlap
+		s.record(j, run)
+		return
+	}
+
+	started := time.Now()
+	run.Started = &started
+	j.running += 1
+	s.runs.Add(1)
+
+	go func() {
+		defer s.runs.Done()
+
+		status, err := s.invoke(j.entry.Lambda, eventBytes(j.entry.Event))
+		finished := time.Now()
+		run.Finished = &finished
+		run.Status = status
+		if err != nil {
+			run.Error = err.Error()
+			log.Printf("Scheduled run of %s (%s) failed: %v\n", j.entry.Lambda, j.entry.Cron, err)
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		j.running -= 1
+		s.record(j, run)
+	}()
+}
+
+func eventBytes(event json.RawMessage) []byte {
+	if len(event) == 0 {
+		return []byte("null")
+	}
+	return event
+}
+
+// record adds a run to the history of a job, and saves the state of the
+// Scheduler.  The caller must hold the mutex.
+func (s *Scheduler) record(j *job, run Run) {
+	j.runs = append(j.runs, run)
+	if len(j.runs) > s.history {
+		j.runs = j.runs[len(j.runs)-s.history:]
+	}
+	s.save()
+}
+
+// save writes the state of every job to the state file.  The caller must
+// hold the mutex.
+func (s *Scheduler) save() {
+	if s.state_path == "" {
+		return
+	}
+
+	state := make(map[string]jobState, len(s.jobs)+len(s.state))
+	for key, st := range s.state {
+		state[key] = st
+	}
+	for key, j := range s.jobs {
+		state[key] = jobState{Last: j.last, Runs: j.runs}
+	}
+
+	raw, err := json.Marshal(state)
+	if err == nil {
+		tmp := s.state_path + ".tmp"
+		if err = ioutil.WriteFile(tmp, raw, 0600); err == nil {
+			err = os.Rename(tmp, s.state_path)
+		}
+	}
+	if err != nil {
+		log.Printf("could not save schedule state (%v): %v\n", s.state_path, err)
+	}
+}
+
+// List returns the entries of the Scheduler and their recent runs, most
+// recent first, optionally only those of one lambda.
+func (s *Scheduler) List(lambda string) []EntryInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	infos := []EntryInfo{}
+	for _, j := range s.jobs {
+		if lambda != "" && j.entry.Lambda != lambda {
+			continue
+		}
+
+		info := EntryInfo{ScheduleEntry: j.entry, Running: j.running, Runs: []Run{}}
+		if !j.next.IsZero() {
+			next := j.next
+			info.Next = &next
+		}
+		for i := len(j.runs) - 1; i >= 0; i-- {
+			info.Runs = append(info.Runs, j.runs[i])
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(a, b int) bool {
+		if infos[a].Lambda != infos[b].Lambda {
+			return infos[a].Lambda < infos[b].Lambda
+		}
+		return infos[a].Cron < infos[b].Cron
+	})
+	return infos
+}
+
+// Close stops scheduling runs, and waits for the running ones to finish,
+// or for ctx to be done.
+func (s *Scheduler) Close(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		for _, j := range s.jobs {
+			close(j.stop)
+		}
+		s.save()
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
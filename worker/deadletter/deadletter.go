@@ -0,0 +1,185 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for letters that are not in the Store.
+var ErrNotFound = errors.New("no such dead letter")
+
+// Letter is an event that a lambda failed to process, with the request it
+// came with and the outcome of the last attempt.
+type Letter struct {
+	ID       string      `json:"id"`
+	Lambda   string      `json:"lambda"`
+	Trigger  string      `json:"trigger"` // e.g., async or cron
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+	Attempts int         `json:"attempts"`
+	Code     int         `json:"code,omitempty"`
+	Error    string      `json:"error"`
+	Failed   time.Time   `json:"failed"`
+}
+
+// Store keeps Letters on disk, one JSON file each, up to a number of
+// letters.  Past it, the oldest letters are dropped.
+type Store struct {
+	mutex sync.Mutex
+	dir   string
+	max   int
+}
+
+// Open opens the Store in dir, creating the directory if needed.
+func Open(dir string, max int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, max: max}, nil
+}
+
+// path returns the file of a letter, or "" if the ID is not valid.
+func (s *Store) path(id string) string {
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return ""
+	}
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Put saves a letter, dropping the oldest letters if the Store is full.
+func (s *Store) Put(letter *Letter) error {
+	path := s.path(letter.ID)
+	if path == "" {
+		return errors.New("invalid dead letter ID " + letter.ID)
+	}
+	raw, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// write to a temporary file, so readers never see half a letter
+	tmp := filepath.Join(s.dir, "."+letter.ID+".tmp")
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return s.trim()
+}
+
+// trim drops the oldest letters past the maximum.  The caller must hold the
+// mutex.
+func (s *Store) trim() error {
+	if s.max <= 0 {
+		return nil
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for len(files) > s.max {
+		if err := os.Remove(filepath.Join(s.dir, files[0].Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// files returns the files of the letters, oldest first.
+func (s *Store) files() ([]os.FileInfo, error) {
+	all, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []os.FileInfo{}
+	for _, file := range all {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") && !strings.HasPrefix(file.Name(), ".") {
+			files = append(files, file)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	return files, nil
+}
+
+// Get returns a letter.
+func (s *Store) Get(id string) (*Letter, error) {
+	path := s.path(id)
+	if path == "" {
+		return nil, ErrNotFound
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var letter Letter
+	if err := json.Unmarshal(raw, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// List returns the letters of a lambda (or of all lambdas, if lambda is
+// empty), oldest first.
+func (s *Store) List(lambda string) ([]*Letter, error) {
+	s.mutex.Lock()
+	files, err := s.files()
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := []*Letter{}
+	for _, file := range files {
+		letter, err := s.Get(strings.TrimSuffix(file.Name(), ".json"))
+		if err == ErrNotFound {
+			continue // deleted since
+		} else if err != nil {
+			return nil, err
+		}
+		if lambda == "" || letter.Lambda == lambda {
+			letters = append(letters, letter)
+		}
+	}
+	return letters, nil
+}
+
+// Delete removes a letter.
+func (s *Store) Delete(id string) error {
+	path := s.path(id)
+	if path == "" {
+		return ErrNotFound
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
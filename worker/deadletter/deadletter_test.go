@@ -0,0 +1,60 @@
+package deadletter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		letter := &Letter{ID: id, Lambda: "f", Body: []byte{0, 1, 2}, Failed: time.Now()}
+		if id == "b" {
+			letter.Lambda = "g"
+		}
+		if err := s.Put(letter); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond) // order by time of failure
+	}
+
+	// a was dropped to keep only 2 letters
+	if _, err := s.Get("a"); err != ErrNotFound {
+		t.Fatalf("Expected a to be dropped, got %v", err)
+	}
+	letters, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 || letters[0].ID != "b" || letters[1].ID != "c" {
+		t.Fatalf("Expected letters b and c, got %+v", letters)
+	}
+	if string(letters[1].Body) != "\x00\x01\x02" {
+		t.Fatalf("Expected the body to survive, got %q", letters[1].Body)
+	}
+	if letters, _ := s.List("g"); len(letters) != 1 || letters[0].ID != "b" {
+		t.Fatalf("Expected letter b for g, got %+v", letters)
+	}
+
+	if err := s.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("b"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Get("../c"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a bad ID, got %v", err)
+	}
+}
@@ -1,15 +1,23 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/open-lambda/open-lambda/worker/config"
 	"github.com/open-lambda/open-lambda/worker/handler/state"
+	"github.com/open-lambda/open-lambda/worker/metrics"
 	"github.com/open-lambda/open-lambda/worker/sandbox"
+	"github.com/open-lambda/open-lambda/worker/versions"
 
 	pmanager "github.com/open-lambda/open-lambda/worker/pool-manager"
 	sbmanager "github.com/open-lambda/open-lambda/worker/sandbox-manager"
@@ -32,54 +40,237 @@ type HandlerSet struct {
 	pm       pmanager.PoolManager
 	config   *config.Config
 	lru      *HandlerLRU
+	limiter  *Limiter
+
+	// Handlers replaced by a refresh, whose sandboxes still run
+	// requests (see drain)
+	drainMutex sync.Mutex
+	draining   map[*Handler]bool
+
+	// pulls by any Handler, numbering the versions of the code
+	pullMutex sync.Mutex
+	pulls     int
 }
 
 // Handler handles requests to run a lambda on a worker server. It handles
 // concurrency and communicates with the sandbox manager to change the
 // state of the container that servers the lambda.
 type Handler struct {
-	mutex    sync.Mutex
-	hset     *HandlerSet
-	name     string
-	sandbox  sandbox.Sandbox
-	lastPull *time.Time
-	state    state.HandlerState
-	runners  int
-	code     []byte
+	mutex       sync.Mutex
+	hset        *HandlerSet
+	name        string
+	sandbox     sandbox.Sandbox
+	sandbox_dir string // mounted at /host, removed with the sandbox
+	lastPull    *time.Time
+	version     int // of the code (see Version)
+	lconf       *config.LambdaConfig
+	limiter     *Limiter
+	state       state.HandlerState
+	runners     int
+	sockets     int
+	code        []byte
+
+	// for the worker's code_refresh policy
+	codeState string
+	lastCheck time.Time
+	draining  bool // replaced by a fresh Handler
+	deleted   bool // dropped from the HandlerSet by Delete
 }
 
+// HandlerInfo is a snapshot of the state of a Handler, suitable for
+// reporting through the worker's management API.
+type HandlerInfo struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Runners   int        `json:"runners"`
+	Queued    int        `json:"queued"`
+	Sockets   int        `json:"sockets"`
+	LastPull  *time.Time `json:"last_pull"`
+	SandboxID string     `json:"sandbox_id"`
+	Draining  bool       `json:"draining,omitempty"`
+}
+
+// ErrHandlerBusy is returned by operations that cannot be performed
+// while requests are running in the handler's sandbox.
+var ErrHandlerBusy = errors.New("handler has running requests")
+
+// ErrHandlerDeleted is returned when running a request with a handler that
+// was deleted after it was looked up.
+var ErrHandlerDeleted = errors.New("handler has been deleted")
+
+// ErrHandlerNotPaused is returned when evicting a handler whose sandbox
+// is not paused.
+var ErrHandlerNotPaused = errors.New("handler is not paused")
+
 // NewHandlerSet creates an empty HandlerSet
 func NewHandlerSet(opts HandlerSetOpts) (handlerSet *HandlerSet) {
 	if opts.Lru == nil {
 		opts.Lru = NewHandlerLRU(0)
 	}
 
-	return &HandlerSet{
+	hset := &HandlerSet{
 		handlers: make(map[string]*Handler),
+		draining: make(map[*Handler]bool),
 		sm:       opts.Sm,
 		pm:       opts.Pm,
 		config:   opts.Config,
 		lru:      opts.Lru,
 	}
+	limit := 0
+	if opts.Config != nil {
+		limit = opts.Config.Max_concurrency
+	}
+	hset.limiter = hset.newLimiter(limit)
+
+	return hset
+}
+
+// newLimiter creates a Limiter with the worker's queue settings.
+func (h *HandlerSet) newLimiter(limit int) *Limiter {
+	if h.config == nil {
+		return NewLimiter(limit, 0, 0)
+	}
+	timeout := time.Duration(h.config.Queue_timeout) * time.Second
+	return NewLimiter(limit, h.config.Max_queue_len, timeout)
+}
+
+// handlerDir returns the directory on the worker of the named lambda, which
+// holds the directories of its sandboxes.
+func (h *HandlerSet) handlerDir(name string) string {
+	return path.Join(h.config.Worker_dir, "handlers", name)
 }
 
-// Get always returns a Handler, creating one if necessarily.
+// StagingDir returns the directory on the worker where files for the
+// sandboxes of the named lambda are staged (see Handler.Share).  Unlike the
+// directory of a sandbox, it outlives the sandboxes.
+func (h *HandlerSet) StagingDir(name string) string {
+	return path.Join(h.handlerDir(name), "staging")
+}
+
+// Get always returns a Handler, creating one if necessarily.  If the code of
+// the lambda is due to be pulled again (see the worker's code_refresh), the
+// Handler is refreshed first.
 func (h *HandlerSet) Get(name string) *Handler {
+	h.mutex.Lock()
+	handler := h.handlers[name]
+	if handler == nil {
+		handler = h.newHandler(name)
+		h.handlers[name] = handler
+	}
+	h.mutex.Unlock()
+
+	if handler.stale() {
+		return h.refresh(handler)
+	}
+	return handler
+}
+
+// newHandler creates a Handler that has not pulled the code yet.
+func (h *HandlerSet) newHandler(name string) *Handler {
+	return &Handler{
+		hset:    h,
+		name:    name,
+		limiter: h.newLimiter(0),
+		state:   state.Unitialized,
+		runners: 0,
+	}
+}
+
+// nextVersion returns the version of the code of a new pull.
+func (h *HandlerSet) nextVersion() int {
+	h.pullMutex.Lock()
+	defer h.pullMutex.Unlock()
+
+	h.pulls += 1
+	return h.pulls
+}
+
+// Crowded tells whether the worker has no room for another paused sandbox,
+// which would only evict another one (see HandlerLRU.Full).
+func (h *HandlerSet) Crowded() bool {
+	return h.lru.Full()
+}
+
+// Lookup returns the Handler of the given name, or nil if the HandlerSet has
+// none.  Unlike Get, it never creates a Handler.
+func (h *HandlerSet) Lookup(name string) *Handler {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.handlers[name]
+}
+
+// List returns a snapshot of every Handler in the HandlerSet, including
+// those still draining after a refresh.
+func (h *HandlerSet) List() []HandlerInfo {
+	h.mutex.Lock()
+	handlers := make([]*Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler)
+	}
+	h.mutex.Unlock()
+	handlers = append(handlers, h.drainingHandlers()...)
+
+	infos := make([]HandlerInfo, 0, len(handlers))
+	for _, handler := range handlers {
+		infos = append(infos, handler.Info())
+	}
+	return infos
+}
+
+// Delete stops and removes the sandbox of the named Handler and drops the
+// Handler from the HandlerSet.  A later Get will create a fresh Handler.
+// Handlers with requests running or queued are not deleted (ErrHandlerBusy),
+// and requests that got the Handler just before fail with ErrHandlerDeleted.
+func (h *HandlerSet) Delete(name string) error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
 	handler := h.handlers[name]
 	if handler == nil {
-		handler = &Handler{
-			hset:    h,
-			name:    name,
-			state:   state.Unitialized,
-			runners: 0,
+		return nil
+	}
+
+	if err := handler.destroy(); err != nil {
+		return err
+	}
+	delete(h.handlers, name)
+
+	return nil
+}
+
+// Load returns the number of requests running on the worker and the number
+// waiting for the concurrency limits of the worker or of their lambda.
+func (h *HandlerSet) Load() (running int, queued int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	queued = h.limiter.Queued()
+	for _, handler := range h.handlers {
+		queued += handler.limiter.Queued()
+	}
+	return h.limiter.Running(), queued
+}
+
+// Cleanup kills and removes the sandboxes of every Handler, even those with
+// running requests, and empties the HandlerSet.
+func (h *HandlerSet) Cleanup() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for name, handler := range h.handlers {
+		if err := handler.Kill(); err != nil {
+			log.Printf("Could not remove sandbox of %v!  Error: %v\n", name, err)
 		}
-		h.handlers[name] = handler
 	}
+	h.handlers = make(map[string]*Handler)
 
-	return handler
+	for _, handler := range h.drainingHandlers() {
+		if err := handler.Kill(); err != nil {
+			log.Printf("Could not remove draining sandbox of %v!  Error: %v\n", handler.name, err)
+		}
+		h.drained(handler)
+	}
 }
 
 // Dump prints the name and state of the Handlers currently in the HandlerSet.
@@ -93,52 +284,68 @@ func (h *HandlerSet) Dump() {
 	}
 }
 
+// Acquire waits until a request may run within the concurrency limits of
+// the lambda and of the worker, or returns ErrQueueFull or ErrQueueTimeout.
+// The code is pulled first if needed, as the lambda's limit is part of its
+// config.  Each successful Acquire must be paired with a Release.
+func (h *Handler) Acquire() error {
+	if _, err := h.Config(); err != nil {
+		return err
+	}
+
+	if err := h.limiter.Acquire(); err != nil {
+		return err
+	}
+	if err := h.hset.limiter.Acquire(); err != nil {
+		h.limiter.Release()
+		return err
+	}
+	return nil
+}
+
+// Release ends a request admitted by Acquire.
+func (h *Handler) Release() {
+	h.hset.limiter.Release()
+	h.limiter.Release()
+}
+
 // RunStart runs the lambda handled by this Handler. It checks if the code has
 // been pulled, sandbox been created, and sandbox been started. The channel of
-// the sandbox of this lambda is returned.
-func (h *Handler) RunStart() (ch *sandbox.SandboxChannel, err error) {
+// the sandbox of this lambda is returned.  The phases the request goes
+// through are recorded in phases, which may be nil.
+func (h *Handler) RunStart(phases *Phases) (ch *sandbox.SandboxChannel, err error) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	// get code if needed
-	if h.lastPull == nil {
-		err = h.hset.sm.Pull(h.name)
-		if err != nil {
-			return nil, err
-		}
-		now := time.Now()
-		h.lastPull = &now
+	if h.deleted {
+		return nil, ErrHandlerDeleted
 	}
 
-	// create sandbox if needed
-	if h.sandbox == nil {
-		sandbox_dir := path.Join(h.hset.config.Worker_dir, "handlers", h.name, "sandbox")
-		if err := os.MkdirAll(sandbox_dir, 0666); err != nil {
-			return nil, err
-		}
+	t0 := time.Now()
+	cold := false
 
-		sandbox, err := h.hset.sm.Create(h.name, sandbox_dir)
-		if err != nil {
-			return nil, err
-		}
+	// get code if needed
+	if err := h.pullIfNeeded(phases); err != nil {
+		return nil, err
+	}
 
-		h.sandbox = sandbox
-		h.state = state.Stopped
+	// create sandbox if needed
+	if err := h.createIfNeeded(phases); err != nil {
+		return nil, err
 	}
 
-	// are we the first?
-	if h.runners == 0 {
+	// are we the first?  (or was the sandbox stopped under us?)
+	if h.state != state.Running {
 		if h.state == state.Stopped {
-			if err := h.sandbox.Start(); err != nil {
+			cold = true
+			if err := h.start(phases); err != nil {
 				return nil, err
 			}
-
-			// forkenter a handler server into sandbox if needed
-			if h.hset.pm != nil {
-				h.hset.pm.ForkEnter(h.sandbox)
-			}
 		} else if h.state == state.Paused {
-			if err := h.sandbox.Unpause(); err != nil {
+			end := phases.Begin(PhaseUnpause)
+			err := h.sandbox.Unpause()
+			end()
+			if err != nil {
 				return nil, err
 			}
 		}
@@ -147,32 +354,110 @@ func (h *Handler) RunStart() (ch *sandbox.SandboxChannel, err error) {
 	}
 
 	h.runners += 1
+	metrics.ObserveStart(h.name, cold, time.Since(t0))
 
 	return h.sandbox.Channel()
 }
 
 // RunFinish notifies that a request to run the lambda has completed. If no
 // request is being run in its sandbox, sandbox will be paused and the handler
-// be added to the HandlerLRU.
-func (h *Handler) RunFinish() {
+// be added to the HandlerLRU.  The pause (if any) is recorded in phases,
+// which may be nil.
+func (h *Handler) RunFinish(phases *Phases) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
 	h.runners -= 1
 
-	// are we the last?
-	if h.runners == 0 {
-		if err := h.sandbox.Pause(); err != nil {
+	// the sandbox of a refreshed Handler is removed after the last
+	// request that was running in it
+	if h.runners == 0 && h.draining {
+		if err := h.remove(); err != nil {
+			log.Printf("Could not remove draining sandbox of %v!  Error: %v\n", h.name, err)
+		}
+		h.hset.drained(h)
+		return
+	}
+
+	// are we the last?  A sandbox stopped by Stop stays stopped.
+	if h.runners == 0 && h.state == state.Running {
+		end := phases.Begin(PhasePause)
+		err := h.sandbox.Pause()
+		end()
+		if err != nil {
 			// TODO(tyler): better way to handle this?  If
 			// we can't pause, the handler gets to keep
 			// running for free...
 			log.Printf("Could not pause %v!  Error: %v\n", h.name, err)
+			metrics.PauseErrors.Inc(h.name)
 		}
 		h.state = state.Paused
-		h.hset.lru.Add(h)
+		h.park()
 	}
 }
 
+// Prewarm pulls the code, and creates and starts the sandbox, if needed,
+// without running a request.  The sandbox is left paused, as after a
+// request, so the next request only has to unpause it.  The phases are
+// recorded in phases, which may be nil.
+func (h *Handler) Prewarm(phases *Phases) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.deleted {
+		return ErrHandlerDeleted
+	}
+
+	if err := h.pullIfNeeded(phases); err != nil {
+		return err
+	}
+	if err := h.createIfNeeded(phases); err != nil {
+		return err
+	}
+
+	// already warm?
+	if h.state != state.Stopped {
+		return nil
+	}
+	if err := h.start(phases); err != nil {
+		return err
+	}
+
+	end := phases.Begin(PhasePause)
+	err := h.sandbox.Pause()
+	end()
+	if err != nil {
+		log.Printf("Could not pause %v!  Error: %v\n", h.name, err)
+		metrics.PauseErrors.Inc(h.name)
+	}
+	h.state = state.Paused
+	h.park()
+	return nil
+}
+
+// Attach keeps the sandbox running while a client holds a connection (e.g.,
+// a WebSocket) open to the lambda, as if a request were running in it.  The
+// sandbox may be paused again once Detach has been called for every Attach.
+func (h *Handler) Attach(phases *Phases) error {
+	if _, err := h.RunStart(phases); err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	h.sockets += 1
+	h.mutex.Unlock()
+	return nil
+}
+
+// Detach undoes an Attach.
+func (h *Handler) Detach(phases *Phases) {
+	h.RunFinish(phases)
+
+	h.mutex.Lock()
+	h.sockets -= 1
+	h.mutex.Unlock()
+}
+
 // StopIfPaused stops the sandbox if it is paused.
 func (h *Handler) StopIfPaused() {
 	h.mutex.Lock()
@@ -193,6 +478,390 @@ func (h *Handler) StopIfPaused() {
 	}
 }
 
+// Info returns a snapshot of the state of this Handler.
+func (h *Handler) Info() HandlerInfo {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	info := HandlerInfo{
+		Name:     h.name,
+		State:    h.state.String(),
+		Runners:  h.runners,
+		Queued:   h.limiter.Queued(),
+		Sockets:  h.sockets,
+		LastPull: h.lastPull,
+		Draining: h.draining,
+	}
+	if h.sandbox != nil {
+		info.SandboxID = h.sandbox.ID()
+	}
+	return info
+}
+
+// Stop stops the sandbox regardless of whether it is paused or running.
+// Requests running in the sandbox will fail; the next request will start
+// it again.
+func (h *Handler) Stop() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.stop()
+}
+
+// Evict stops the sandbox if it is paused, as the evictor of the
+// HandlerLRU would.
+func (h *Handler) Evict() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.state != state.Paused {
+		return ErrHandlerNotPaused
+	}
+	return h.stop()
+}
+
+// Pull discards the sandbox and pulls the code of the lambda again, so that
+// the next request runs the new code in a fresh sandbox.
+func (h *Handler) Pull() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.remove(); err != nil {
+		return err
+	}
+
+	h.lastPull = nil
+	return h.pull()
+}
+
+// Kill stops and removes a sandbox that is stuck (e.g., past the deadline of
+// a request), so that the next request gets a fresh one.  Other requests
+// still running in the old sandbox will fail.
+func (h *Handler) Kill() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.sandbox == nil {
+		return nil
+	}
+
+	if err := h.stop(); err != nil {
+		return err
+	}
+	if err := h.sandbox.Remove(); err != nil {
+		return err
+	}
+	h.sandbox = nil
+	h.state = state.Unitialized
+	h.removeSandboxDir()
+
+	return nil
+}
+
+// Share makes a file staged in the lambda's StagingDir visible in the
+// sandbox, at the same path under /host, until the returned function is
+// called.  It must be called between RunStart and RunFinish, so the sandbox
+// exists.
+func (h *Handler) Share(file string) (func(), error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.sandbox == nil {
+		return nil, fmt.Errorf("no sandbox to share %s with", file)
+	}
+	rel, err := filepath.Rel(h.hset.StagingDir(h.name), file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, fmt.Errorf("%s is not staged for %s", file, h.name)
+	}
+
+	// a hard link, as the staging directory and the sandbox
+	// directory are both in the worker directory
+	link := filepath.Join(h.sandbox_dir, rel)
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Link(file, link); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove %s: %v\n", link, err)
+		}
+	}, nil
+}
+
+// Config returns the lambda config, pulling the code first if needed.
+func (h *Handler) Config() (*config.LambdaConfig, error) {
+	return h.Prepare(nil)
+}
+
+// Prepare is like Config, but records the pull (if any) in phases.
+func (h *Handler) Prepare(phases *Phases) (*config.LambdaConfig, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.pullIfNeeded(phases); err != nil {
+		return nil, err
+	}
+	return h.lconf, nil
+}
+
+// Version returns the version of the lambda's code, which changes every
+// time the code is pulled.  Versions are never reused by a worker, even
+// for a Handler created after another one was deleted.
+func (h *Handler) Version() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.version
+}
+
+// Timeout returns how long a request may run in the sandbox, according to
+// the lambda's config or else the worker's default.
+func (h *Handler) Timeout() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	seconds := h.hset.config.Lambda_timeout
+	if h.lconf != nil && h.lconf.Timeout > 0 {
+		seconds = h.lconf.Timeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// createIfNeeded creates the sandbox if there is none (even for a draining
+// Handler, if a request got it just before the refresh), recording the
+// creation in phases.  The caller must hold the Handler's mutex.
+func (h *Handler) createIfNeeded(phases *Phases) error {
+	if h.sandbox != nil {
+		return nil
+	}
+	if h.draining {
+		h.hset.addDraining(h)
+	}
+
+	opts, err := h.sandboxOpts()
+	if err != nil {
+		return err
+	}
+
+	// every sandbox gets its own directory, so a sandbox still
+	// draining never shares its socket with a fresh one
+	handler_dir := h.hset.handlerDir(h.name)
+	if err := os.MkdirAll(handler_dir, 0755); err != nil {
+		return err
+	}
+	sandbox_dir, err := ioutil.TempDir(handler_dir, "sandbox-")
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(sandbox_dir, 0755); err != nil {
+		os.RemoveAll(sandbox_dir)
+		return err
+	}
+
+	end := phases.Begin(PhaseCreate)
+	sandbox, err := h.hset.sm.Create(h.name, sandbox_dir, opts)
+	end()
+	if err != nil {
+		os.RemoveAll(sandbox_dir)
+		return err
+	}
+
+	h.sandbox = sandbox
+	h.sandbox_dir = sandbox_dir
+	h.state = state.Stopped
+	return nil
+}
+
+// removeSandboxDir deletes the directory of the removed sandbox.  The
+// caller must hold the Handler's mutex.
+func (h *Handler) removeSandboxDir() {
+	if h.sandbox_dir == "" {
+		return
+	}
+	if err := os.RemoveAll(h.sandbox_dir); err != nil {
+		log.Printf("could not remove %s: %v\n", h.sandbox_dir, err)
+	}
+	h.sandbox_dir = ""
+}
+
+// sandboxOpts returns the environment variables and secret files of the
+// sandbox, from the lambda config and the worker's secrets.  Errors never
+// include the values of secrets.  The caller must hold the Handler's mutex.
+func (h *Handler) sandboxOpts() (*sbmanager.SandboxOpts, error) {
+	opts := &sbmanager.SandboxOpts{}
+	if h.lconf == nil {
+		return opts, nil
+	}
+
+	names := make([]string, 0, len(h.lconf.Env))
+	for name := range h.lconf.Env {
+		if !config.ValidEnvName(name) {
+			return nil, fmt.Errorf("invalid environment variable %q in lambda config of %s", name, h.name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		opts.Env = append(opts.Env, name+"="+h.lconf.Env[name])
+	}
+
+	if len(h.lconf.Secrets) == 0 {
+		return opts, nil
+	}
+	secrets, err := config.LoadSecrets(h.hset.config.Secrets_file)
+	if err != nil {
+		return nil, err
+	}
+	opts.Secret_files = make(map[string][]byte)
+	for _, ref := range h.lconf.Secrets {
+		if err := ref.Validate(); err != nil {
+			return nil, fmt.Errorf("lambda config of %s: %v", h.name, err)
+		}
+		secret, ok := secrets[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("no secret %s for %s", ref.Name, h.name)
+		}
+
+		// versions of a lambda share its secrets
+		if name, _ := versions.Split(h.name); !secret.Allows(name) {
+			return nil, fmt.Errorf("secret %s may not be used by %s", ref.Name, h.name)
+		}
+		if ref.Env != "" {
+			opts.Env = append(opts.Env, ref.Env+"="+secret.Value)
+		}
+		if ref.File != "" {
+			opts.Secret_files[ref.File] = []byte(secret.Value)
+		}
+	}
+	return opts, nil
+}
+
+// start starts the stopped sandbox, recording the start in phases.  The
+// caller must hold the Handler's mutex.
+func (h *Handler) start(phases *Phases) error {
+	end := phases.Begin(PhaseStart)
+	defer end()
+	if err := h.sandbox.Start(); err != nil {
+		return err
+	}
+
+	// forkenter a handler server into sandbox if needed
+	if h.hset.pm != nil {
+		endForkEnter := phases.Begin(PhaseForkEnter)
+		h.hset.pm.ForkEnter(h.sandbox)
+		endForkEnter()
+	}
+	return nil
+}
+
+// park adds the paused Handler to the HandlerLRU, to be evicted in time
+// (lambdas with a min_warm are warmed again by the server).  The caller
+// must hold the Handler's mutex.
+func (h *Handler) park() {
+	h.hset.lru.Add(h)
+}
+
+// pull gets the code of the lambda and its lambda config.  The caller must
+// hold the Handler's mutex.
+func (h *Handler) pull() error {
+	if err := h.hset.sm.Pull(h.name); err != nil {
+		return err
+	}
+
+	lconf, err := config.ParseLambdaConfig(h.hset.sm.CodeDir(h.name))
+	if err != nil {
+		return err
+	}
+	codeState, err := h.checkCode()
+	if err != nil {
+		return err
+	}
+	h.lconf = lconf
+	h.limiter.SetLimit(lconf.Max_concurrency)
+	h.version = h.hset.nextVersion()
+	h.codeState = codeState
+
+	now := time.Now()
+	h.lastPull = &now
+	h.lastCheck = now
+	return nil
+}
+
+// pullIfNeeded pulls the code if it has not been yet, recording the pull in
+// phases.  The caller must hold the Handler's mutex.
+func (h *Handler) pullIfNeeded(phases *Phases) error {
+	if h.lastPull != nil {
+		return nil
+	}
+
+	end := phases.Begin(PhasePull)
+	defer end()
+	return h.pull()
+}
+
+// stop kills the sandbox.  The caller must hold the Handler's mutex.
+func (h *Handler) stop() error {
+	switch h.state {
+	case state.Paused:
+		// TODO(tyler): why do we need to unpause in order to kill?
+		if err := h.sandbox.Unpause(); err != nil {
+			return err
+		}
+	case state.Running:
+	default:
+		return nil
+	}
+
+	if err := h.sandbox.Stop(); err != nil {
+		return err
+	}
+	h.state = state.Stopped
+	h.hset.lru.Remove(h)
+
+	return nil
+}
+
+// remove stops and removes the sandbox, returning the Handler to the
+// uninitialized state.  The caller must hold the Handler's mutex.
+func (h *Handler) remove() error {
+	if h.runners > 0 {
+		return ErrHandlerBusy
+	}
+
+	if h.sandbox != nil {
+		if err := h.stop(); err != nil {
+			return err
+		}
+		if err := h.sandbox.Remove(); err != nil {
+			return err
+		}
+		h.sandbox = nil
+		h.removeSandboxDir()
+	}
+	h.state = state.Unitialized
+
+	return nil
+}
+
+// destroy removes the sandbox so the Handler can be dropped from its
+// HandlerSet, unless requests are running or queued.
+func (h *Handler) destroy() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.limiter.Queued() > 0 {
+		return ErrHandlerBusy
+	}
+	if err := h.remove(); err != nil {
+		return err
+	}
+	h.deleted = true
+	return nil
+}
+
 // Sandbox returns the sandbox of this Handler.
 func (h *Handler) Sandbox() sandbox.Sandbox {
 	return h.sandbox
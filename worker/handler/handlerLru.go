@@ -4,6 +4,8 @@ import (
 	"container/list"
 	"fmt"
 	"sync"
+
+	"github.com/open-lambda/open-lambda/worker/metrics"
 )
 
 // HandlerLRU manages a list of stopped Handlers with the LRU policy.
@@ -51,12 +53,22 @@ func (lru *HandlerLRU) Add(handler *Handler) {
 	}
 	entry := lru.hqueue.PushFront(handler)
 	lru.hmap[handler] = entry
+	metrics.LruLength.Set(float64(lru.Len()))
 
 	if lru.Len() > lru.soft_limit {
 		lru.soft_cond.Signal()
 	}
 }
 
+// Full tells whether another Handler would take the LRU list past the soft
+// limit, so that adding it would evict one.
+func (lru *HandlerLRU) Full() bool {
+	lru.mutex.Lock()
+	defer lru.mutex.Unlock()
+
+	return lru.Len() >= lru.soft_limit
+}
+
 // Remove removes a Handler from the LRU list if exists.
 func (lru *HandlerLRU) Remove(handler *Handler) {
 	lru.mutex.Lock()
@@ -69,6 +81,7 @@ func (lru *HandlerLRU) Remove(handler *Handler) {
 			panic("queue entry not found")
 		}
 	}
+	metrics.LruLength.Set(float64(lru.Len()))
 }
 
 // Evictor waits on signal that the number of Handlers in the LRU list exceeds
@@ -87,6 +100,8 @@ func (lru *HandlerLRU) Evictor() {
 		handler := entry.Value.(*Handler)
 		lru.hqueue.Remove(entry)
 		delete(lru.hmap, handler)
+		metrics.LruLength.Set(float64(lru.Len()))
+		metrics.LruEvictions.Inc()
 
 		lru.mutex.Unlock()
 		// depending on interleavings, it could also be
@@ -79,7 +79,7 @@ func TestHandlerHandlerPull(t *testing.T) {
 		t.Fatalf("Get should not pull %s", name)
 	}
 
-	_, err = h.RunStart()
+	_, err = h.RunStart(nil)
 	if err != nil {
 		t.Fatalf("RunStart failed with: %v", err.Error())
 	}
@@ -108,7 +108,7 @@ func TestHandlerRunCountOne(t *testing.T) {
 	handlers := NewHandlerSet(HandlerSetOpts{Sm: sm, Lru: lru, Config: getConf()})
 	h := handlers.Get("hello2")
 
-	_, err := h.RunStart()
+	_, err := h.RunStart(nil)
 	if err != nil {
 		t.Fatalf("RunStart failed with: %v", err.Error())
 	}
@@ -117,7 +117,7 @@ func TestHandlerRunCountOne(t *testing.T) {
 		t.Fatalf("Unexpected state: %v", s.String())
 	}
 
-	h.RunFinish()
+	h.RunFinish(nil)
 	s = GetState(t, h)
 	if !(s == state.Paused) {
 		t.Fatalf("Unexpected state(2): %v", s.String())
@@ -133,7 +133,7 @@ func TestHandlerRunCountMany(t *testing.T) {
 
 	for i := 0; i < count; i++ {
 		log.Printf("Starting %v\n", i+1)
-		_, err := h.RunStart()
+		_, err := h.RunStart(nil)
 		if err != nil {
 			t.Fatalf("RunStart failed with: %v", err.Error())
 		}
@@ -145,7 +145,7 @@ func TestHandlerRunCountMany(t *testing.T) {
 
 	for i := 0; i < count; i++ {
 		log.Printf("Finishing %v\n", i+1)
-		h.RunFinish()
+		h.RunFinish(nil)
 		s := GetState(t, h)
 		if i == count-1 {
 			if !(s == state.Paused) {
@@ -164,11 +164,11 @@ func TestHandlerEvict(t *testing.T) {
 	sm := NewManager()
 	handlers := NewHandlerSet(HandlerSetOpts{Sm: sm, Lru: lru, Config: getConf()})
 	h := handlers.Get("hello2")
-	_, err := h.RunStart()
+	_, err := h.RunStart(nil)
 	if err != nil {
 		t.Fatalf("RunStart failed with: %v", err.Error())
 	}
-	h.RunFinish()
+	h.RunFinish(nil)
 	s := GetState(t, h)
 
 	// wait up to 5 seconds for evictor to evict
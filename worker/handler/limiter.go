@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by Limiter.Acquire when no more callers may wait.
+var ErrQueueFull = errors.New("too many requests queued")
+
+// ErrQueueTimeout is returned by Limiter.Acquire when a caller waited longer
+// than the queue timeout.
+var ErrQueueTimeout = errors.New("timed out waiting in queue")
+
+// Limiter bounds the number of concurrent requests.  Requests over the limit
+// wait in a bounded FIFO queue for up to a timeout.
+type Limiter struct {
+	mutex     sync.Mutex
+	limit     int // 0 means unlimited
+	max_queue int
+	timeout   time.Duration
+	running   int
+	waiters   *list.List // of chan struct{}, front is oldest
+}
+
+// NewLimiter creates a Limiter admitting limit concurrent requests (0 means
+// unlimited), with up to max_queue more waiting for up to timeout each.
+func NewLimiter(limit int, max_queue int, timeout time.Duration) *Limiter {
+	return &Limiter{
+		limit:     limit,
+		max_queue: max_queue,
+		timeout:   timeout,
+		waiters:   list.New(),
+	}
+}
+
+// SetLimit changes the number of concurrent requests admitted.
+func (l *Limiter) SetLimit(limit int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.limit = limit
+	l.grant()
+}
+
+// Acquire blocks until the request may run, or returns ErrQueueFull or
+// ErrQueueTimeout.  Every successful Acquire must be paired with a Release.
+func (l *Limiter) Acquire() error {
+	l.mutex.Lock()
+	if l.waiters.Len() == 0 && l.available() {
+		l.running += 1
+		l.mutex.Unlock()
+		return nil
+	}
+
+	if l.waiters.Len() >= l.max_queue {
+		l.mutex.Unlock()
+		return ErrQueueFull
+	}
+
+	ready := make(chan struct{})
+	entry := l.waiters.PushBack(ready)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		// we may have been admitted while waiting for the lock
+		select {
+		case <-ready:
+			return nil
+		default:
+		}
+		l.waiters.Remove(entry)
+		return ErrQueueTimeout
+	}
+}
+
+// Release ends a request, admitting the oldest waiting one if any.
+func (l *Limiter) Release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.running -= 1
+	l.grant()
+}
+
+// Running returns the number of admitted requests.
+func (l *Limiter) Running() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.running
+}
+
+// Queued returns the number of waiting requests.
+func (l *Limiter) Queued() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.waiters.Len()
+}
+
+// available tells whether one more request may run.  The caller must hold
+// the Limiter's mutex.
+func (l *Limiter) available() bool {
+	return l.limit <= 0 || l.running < l.limit
+}
+
+// grant admits waiting requests while there is room.  The caller must hold
+// the Limiter's mutex.
+func (l *Limiter) grant() {
+	for l.waiters.Len() > 0 && l.available() {
+		entry := l.waiters.Front()
+		l.waiters.Remove(entry)
+		l.running += 1
+		close(entry.Value.(chan struct{}))
+	}
+}
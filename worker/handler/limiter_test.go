@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(0, 0, time.Second)
+	for i := 0; i < 100; i++ {
+		if err := l.Acquire(); err != nil {
+			t.Fatalf("Acquire %v failed with: %v", i, err)
+		}
+	}
+	if l.Running() != 100 {
+		t.Fatalf("Unexpected running: %v", l.Running())
+	}
+}
+
+func TestLimiterQueueFull(t *testing.T) {
+	l := NewLimiter(1, 0, time.Second)
+	if err := l.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Acquire(); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull, got: %v", err)
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := NewLimiter(1, 1, 10*time.Millisecond)
+	if err := l.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Acquire(); err != ErrQueueTimeout {
+		t.Fatalf("Expected ErrQueueTimeout, got: %v", err)
+	}
+	if l.Queued() != 0 {
+		t.Fatalf("Unexpected queued: %v", l.Queued())
+	}
+}
+
+func TestLimiterFifo(t *testing.T) {
+	l := NewLimiter(1, 10, time.Second)
+	if err := l.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			if err := l.Acquire(); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			l.Release()
+		}(i)
+
+		// wait for the goroutine to queue up
+		for l.Queued() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	l.Release()
+	for i := 0; i < 3; i++ {
+		if got := <-order; got != i {
+			t.Fatalf("Expected request %v to run, got %v", i, got)
+		}
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l := NewLimiter(1, 10, time.Second)
+	if err := l.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.Acquire()
+	}()
+	for l.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	l.SetLimit(2)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if l.Running() != 2 {
+		t.Fatalf("Unexpected running: %v", l.Running())
+	}
+}
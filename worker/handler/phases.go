@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// Phases of the Handler lifecycle that a request may go through.
+const (
+	PhasePull      = "pull"
+	PhaseCreate    = "create"
+	PhaseStart     = "start"
+	PhaseForkEnter = "forkenter" // part of start
+	PhaseUnpause   = "unpause"
+	PhasePause     = "pause"
+
+	// recorded by the server, from sending the request to the sandbox
+	// until its response has been read
+	PhaseForward = "forward"
+)
+
+// Span is one phase of a request.
+type Span struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Phases records the phases a request goes through, and how long each
+// takes.  Methods of a nil *Phases do nothing, for callers that do not need
+// the record.
+type Phases struct {
+	mutex sync.Mutex
+	spans []Span
+}
+
+// NewPhases creates an empty record.
+func NewPhases() *Phases {
+	return &Phases{}
+}
+
+// Begin starts a phase, and returns the function that ends it.
+func (p *Phases) Begin(name string) (end func()) {
+	if p == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.spans = append(p.spans, Span{Name: name, Start: start, Duration: time.Since(start)})
+	}
+}
+
+// Spans returns the phases ended so far, in the order they ended.
+func (p *Phases) Spans() []Span {
+	if p == nil {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]Span{}, p.spans...)
+}
+
+// Durations returns the total time spent in each phase.
+func (p *Phases) Durations() map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, span := range p.Spans() {
+		durations[span.Name] += span.Duration
+	}
+	return durations
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhases(t *testing.T) {
+	p := NewPhases()
+
+	end := p.Begin(PhaseCreate)
+	time.Sleep(time.Millisecond)
+	end()
+	p.Begin(PhaseStart)()
+	p.Begin(PhaseStart)()
+
+	spans := p.Spans()
+	if len(spans) != 3 || spans[0].Name != PhaseCreate {
+		t.Fatalf("Unexpected spans %+v", spans)
+	}
+
+	durations := p.Durations()
+	if durations[PhaseCreate] < time.Millisecond {
+		t.Fatalf("Expected create to take at least 1ms, got %v", durations[PhaseCreate])
+	}
+	if _, ok := durations[PhasePull]; ok {
+		t.Fatalf("Expected no pull phase")
+	}
+
+	// a nil Phases records nothing
+	var none *Phases
+	none.Begin(PhasePull)()
+	if len(none.Durations()) != 0 {
+		t.Fatalf("Expected no phases")
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Once pulled, the code of a lambda is pulled again according to the
+// worker's code_refresh policy: after a TTL, or when the files of its code
+// directory change (by modification time or by digest).  Rather than
+// pulling over the code of a running sandbox, a refresh replaces the
+// Handler with a fresh one, which pulls the code for the next request.  The
+// old Handler drains: requests already running in its sandbox finish on the
+// old code, and the sandbox is removed after the last one.
+
+// Refresh replaces the named Handler with a fresh one, which pulls the code
+// again for the next request, and drains the old one.  It returns the new
+// Handler, or nil if there was none.
+func (h *HandlerSet) Refresh(name string) *Handler {
+	old := h.Lookup(name)
+	if old == nil {
+		return nil
+	}
+	return h.refresh(old)
+}
+
+// refresh replaces a Handler, unless another request already did.
+func (h *HandlerSet) refresh(old *Handler) *Handler {
+	h.mutex.Lock()
+	handler := h.handlers[old.name]
+	replaced := handler == old
+	if replaced || handler == nil {
+		handler = h.newHandler(old.name)
+		h.handlers[old.name] = handler
+	}
+	h.mutex.Unlock()
+
+	if replaced {
+		log.Printf("Refreshing the code of %v\n", old.name)
+		old.drain()
+	}
+	return handler
+}
+
+// addDraining tracks a Handler whose sandbox runs requests after a refresh.
+func (h *HandlerSet) addDraining(handler *Handler) {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+
+	h.draining[handler] = true
+}
+
+// drained stops tracking a Handler whose sandbox has been removed.
+func (h *HandlerSet) drained(handler *Handler) {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+
+	delete(h.draining, handler)
+}
+
+// drainingHandlers returns the Handlers that are draining.
+func (h *HandlerSet) drainingHandlers() []*Handler {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+
+	handlers := make([]*Handler, 0, len(h.draining))
+	for handler := range h.draining {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// drain removes the sandbox of a Handler that has been replaced, once no
+// request runs in it anymore.
+func (h *Handler) drain() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.draining = true
+	if h.runners > 0 {
+		// RunFinish removes the sandbox after the last request
+		h.hset.addDraining(h)
+		return
+	}
+	if err := h.remove(); err != nil {
+		log.Printf("Could not remove sandbox of %v!  Error: %v\n", h.name, err)
+	}
+}
+
+// stale tells whether the code of the lambda is due to be pulled again.  It
+// is checked at most every code_refresh_interval seconds.
+func (h *Handler) stale() bool {
+	conf := h.hset.config
+	if conf == nil || conf.Code_refresh == "" || conf.Code_refresh == "never" {
+		return false
+	}
+
+	// versions (name@N) never change
+	if strings.Contains(h.name, "@") {
+		return false
+	}
+
+	h.mutex.Lock()
+	interval := time.Duration(conf.Code_refresh_interval) * time.Second
+	if h.lastPull == nil || h.draining || time.Since(h.lastCheck) < interval {
+		h.mutex.Unlock()
+		return false
+	}
+	h.lastCheck = time.Now()
+	codeState := h.codeState
+	h.mutex.Unlock()
+
+	if conf.Code_refresh == "ttl" {
+		return true
+	}
+
+	// the files are read without holding the mutex
+	current, err := h.checkCode()
+	if err != nil {
+		log.Printf("Could not check the code of %v!  Error: %v\n", h.name, err)
+		return false
+	}
+	return current != codeState
+}
+
+// checkCode returns the state of the code of the lambda, as compared by the
+// code_refresh policy ("" if it does not look at the files).
+func (h *Handler) checkCode() (string, error) {
+	conf := h.hset.config
+	if conf == nil || (conf.Code_refresh != "mtime" && conf.Code_refresh != "digest") {
+		return "", nil
+	}
+	return codeState(h.hset.sm.CodeDir(h.name), conf.Code_refresh == "digest")
+}
+
+// codeState summarizes the files of a code directory: their names, sizes and
+// modification times, or their names and contents (for a digest).  Python
+// bytecode is left out, as the sandbox may write it.
+func codeState(dir string, digest bool) (string, error) {
+	hash := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "__pycache__" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".pyc") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !digest {
+			fmt.Fprintf(hash, "%s\x00%d\x00%d\n", rel, info.Size(), info.ModTime().UnixNano())
+			return nil
+		}
+
+		fmt.Fprintf(hash, "%s\x00%d\n", rel, info.Size())
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
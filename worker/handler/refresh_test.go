@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodeState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, data string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := func(digest bool) string {
+		s, err := codeState(dir, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	write("f.py", "v1")
+	before := state(true)
+	write("__pycache__/f.cpython-36.pyc", "bytecode")
+	if after := state(true); after != before {
+		t.Fatalf("Expected bytecode to be ignored")
+	}
+	write("f.py", "v2")
+	if after := state(true); after == before {
+		t.Fatalf("Expected the digest to change with the code")
+	}
+
+	before = state(false)
+	if err := os.Rename(filepath.Join(dir, "f.py"), filepath.Join(dir, "g.py")); err != nil {
+		t.Fatal(err)
+	}
+	if after := state(false); after == before {
+		t.Fatalf("Expected a renamed file to change the state")
+	}
+}
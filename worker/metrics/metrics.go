@@ -0,0 +1,314 @@
+package metrics
+
+/*
+
+Minimal collectors (counters, gauges and histograms, optionally
+labeled) that can be exposed in the OpenMetrics text format.
+
+*/
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the output of Registry.Write.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// DefaultBuckets are the upper bounds (in seconds) of histograms created
+// without explicit buckets.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a metric family that can write itself as OpenMetrics text.
+type Collector interface {
+	Write(w io.Writer) error
+}
+
+// Registry is an ordered collection of Collectors.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a Collector to the Registry, returning it for convenience.
+func (r *Registry) Register(c Collector) Collector {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectors = append(r.collectors, c)
+	return c
+}
+
+// Write writes every registered Collector followed by the "# EOF" marker.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mutex.Unlock()
+
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// family holds the state shared by every kind of labeled metric.
+type family struct {
+	mutex  sync.Mutex
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", f.name, f.typ, f.name, escape(f.help))
+	return err
+}
+
+// labelStr formats the label pairs of a series, with optional extra pairs
+// (e.g., the "le" label of histogram buckets) appended.
+func (f *family) labelStr(key string, extra ...string) string {
+	pairs := []string{}
+	if len(f.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", f.labels[i], escape(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escape(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func escape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return strings.Replace(s, "\n", "\\n", -1)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// NewCounter creates a Counter.  The "_total" suffix is added to the name of
+// each series.
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{
+		family: family{name: name, help: help, typ: "counter", labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Inc increments the counter of the given label values by one.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increases the counter of the given label values by v.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[c.key(values)] += v
+}
+
+// Write writes the Counter in OpenMetrics text format.
+func (c *Counter) Write(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.header(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(c.values) {
+		line := fmt.Sprintf("%s_total%s %s\n", c.name, c.labelStr(key), formatFloat(c.values[key]))
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge is a value per label combination that can go up and down.
+type Gauge struct {
+	family
+	values map[string]float64
+}
+
+// NewGauge creates a Gauge.
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{
+		family: family{name: name, help: help, typ: "gauge", labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Set sets the gauge of the given label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.values[g.key(values)] = v
+}
+
+// Add adds v (which may be negative) to the gauge of the given label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.values[g.key(values)] += v
+}
+
+// Reset forgets the values of every label combination.
+func (g *Gauge) Reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.values = make(map[string]float64)
+}
+
+// Write writes the Gauge in OpenMetrics text format.
+func (g *Gauge) Write(w io.Writer) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if err := g.header(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(g.values) {
+		line := fmt.Sprintf("%s%s %s\n", g.name, g.labelStr(key), formatFloat(g.values[key]))
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations in buckets per label combination.
+type Histogram struct {
+	family
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+// NewHistogram creates a Histogram with the given bucket upper bounds, or
+// DefaultBuckets if buckets is nil.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	return &Histogram{
+		family:  family{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Observe records v in the histogram of the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := h.key(values)
+	hv := h.values[key]
+	if hv == nil {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i] += 1
+			break
+		}
+	}
+	hv.count += 1
+	hv.sum += v
+}
+
+// Write writes the Histogram in OpenMetrics text format.
+func (h *Histogram) Write(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.header(w); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hv := h.values[key]
+		lines := []string{}
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hv.counts[i]
+			lines = append(lines, fmt.Sprintf("%s_bucket%s %d\n", h.name, h.labelStr(key, "le", formatFloat(upper)), cumulative))
+		}
+		lines = append(lines,
+			fmt.Sprintf("%s_bucket%s %d\n", h.name, h.labelStr(key, "le", "+Inf"), hv.count),
+			fmt.Sprintf("%s_count%s %d\n", h.name, h.labelStr(key), hv.count),
+			fmt.Sprintf("%s_sum%s %s\n", h.name, h.labelStr(key), formatFloat(hv.sum)))
+
+		for _, line := range lines {
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
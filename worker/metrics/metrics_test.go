@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.Register(NewCounter("calls", "Calls made.", "lambda")).(*Counter)
+	g := reg.Register(NewGauge("queued", "Queued \"things\".")).(*Gauge)
+	h := reg.Register(NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "lambda")).(*Histogram)
+
+	c.Inc("b")
+	c.Add(2, "a")
+	g.Set(3)
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(5, "a")
+
+	buf := &bytes.Buffer{}
+	if err := reg.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`# TYPE calls counter`,
+		`# HELP calls Calls made.`,
+		`calls_total{lambda="a"} 2`,
+		`calls_total{lambda="b"} 1`,
+		`# TYPE queued gauge`,
+		`# HELP queued Queued \"things\".`,
+		`queued 3`,
+		`# TYPE latency_seconds histogram`,
+		`# HELP latency_seconds Latency.`,
+		`latency_seconds_bucket{lambda="a",le="0.1"} 1`,
+		`latency_seconds_bucket{lambda="a",le="1"} 2`,
+		`latency_seconds_bucket{lambda="a",le="+Inf"} 3`,
+		`latency_seconds_count{lambda="a"} 3`,
+		`latency_seconds_sum{lambda="a"} 5.55`,
+		`# EOF`,
+		``,
+	}, "\n")
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	c := NewCounter("calls", "Calls made.", "lambda")
+	c.Inc("a\"b\\c\nd")
+
+	buf := &bytes.Buffer{}
+	if err := c.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `calls_total{lambda="a\"b\\c\nd"} 1`
+	if !strings.Contains(buf.String(), expected) {
+		t.Fatalf("Expected '%s' in:\n%s", expected, buf.String())
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on wrong number of label values")
+		}
+	}()
+
+	c := NewCounter("calls", "Calls made.", "lambda")
+	c.Inc()
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Default is the Registry exposed by the worker's /metrics endpoint.
+var Default = NewRegistry()
+
+var (
+	Invocations = Default.Register(NewCounter(
+		"ol_invocations",
+		"Lambda invocations handled by the worker, by response status.",
+		"lambda", "code")).(*Counter)
+
+	InvocationErrors = Default.Register(NewCounter(
+		"ol_invocation_errors",
+		"Lambda invocations that failed in the worker or the sandbox.",
+		"lambda")).(*Counter)
+
+	InvocationLatency = Default.Register(NewHistogram(
+		"ol_invocation_duration_seconds",
+		"Time to handle a lambda invocation, end to end.",
+		nil, "lambda")).(*Histogram)
+
+	HandlerStarts = Default.Register(NewCounter(
+		"ol_handler_starts",
+		"Requests admitted to a sandbox; cold starts had to create or start it, warm starts found it paused or running.",
+		"lambda", "start")).(*Counter)
+
+	HandlerStartLatency = Default.Register(NewHistogram(
+		"ol_handler_start_duration_seconds",
+		"Time spent in Handler.RunStart before a request is forwarded.",
+		nil, "start")).(*Histogram)
+
+	PauseErrors = Default.Register(NewCounter(
+		"ol_pause_errors",
+		"Sandboxes that could not be paused after their last request.",
+		"lambda")).(*Counter)
+
+	LruEvictions = Default.Register(NewCounter(
+		"ol_lru_evictions",
+		"Handlers evicted from the LRU list.")).(*Counter)
+
+	LruLength = Default.Register(NewGauge(
+		"ol_lru_length",
+		"Paused handlers waiting in the LRU list.")).(*Gauge)
+
+	Handlers = Default.Register(NewGauge(
+		"ol_handlers",
+		"Handlers known to the worker, by state.",
+		"state")).(*Gauge)
+
+	WebSockets = Default.Register(NewGauge(
+		"ol_websockets",
+		"Open WebSocket connections, by lambda.",
+		"lambda")).(*Gauge)
+
+	CacheHits = Default.Register(NewCounter(
+		"ol_cache_hits",
+		"Invocations answered from the response cache, without the sandbox.",
+		"lambda")).(*Counter)
+
+	CacheMisses = Default.Register(NewCounter(
+		"ol_cache_misses",
+		"Invocations of lambdas with a response cache that had to run in the sandbox.",
+		"lambda")).(*Counter)
+)
+
+// ObserveInvocation records the outcome of one invocation of a lambda.
+func ObserveInvocation(lambda string, code int, elapsed time.Duration) {
+	Invocations.Inc(lambda, strconv.Itoa(code))
+	if code >= 500 {
+		InvocationErrors.Inc(lambda)
+	}
+	InvocationLatency.Observe(elapsed.Seconds(), lambda)
+}
+
+// ObserveStart records a request being admitted to the sandbox of a lambda.
+func ObserveStart(lambda string, cold bool, elapsed time.Duration) {
+	start := "warm"
+	if cold {
+		start = "cold"
+	}
+	HandlerStarts.Inc(lambda, start)
+	HandlerStartLatency.Observe(elapsed.Seconds(), start)
+}
@@ -15,6 +15,7 @@ Handler code is mapped into the container by attaching a directory
 import (
 	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"os"
 	"os/exec"
@@ -29,6 +30,7 @@ import (
 type ForkServer struct {
 	//packages []string TODO
 	sockPath string
+	cmd      *exec.Cmd
 }
 
 type BasicManager struct {
@@ -36,15 +38,26 @@ type BasicManager struct {
 }
 
 func NewForkServer(sockPath string) (fs *ForkServer, err error) {
-	if err = runLambdaServer(sockPath); err != nil {
+	cmd, err := runLambdaServer(sockPath)
+	if err != nil {
 		return nil, err
 	}
 
-	fs = &ForkServer{sockPath: sockPath}
+	fs = &ForkServer{sockPath: sockPath, cmd: cmd}
 
 	return fs, nil
 }
 
+/* Kill the lambda python server and remove its socket */
+func (fs *ForkServer) Kill() error {
+	if err := fs.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	fs.cmd.Wait()
+
+	return os.Remove(fs.sockPath)
+}
+
 func NewBasicManager(opts *config.Config) (bm *BasicManager, err error) {
 	sockDir := "/var/tmp/olsocks"
 	if err = os.MkdirAll(sockDir, os.ModeDir); err != nil {
@@ -96,6 +109,14 @@ func (bm *BasicManager) ForkEnter(sandbox sb.Sandbox) (err error) {
 	return nil
 }
 
+func (bm *BasicManager) Shutdown() {
+	for _, fs := range bm.servers {
+		if err := fs.Kill(); err != nil {
+			log.Printf("failed to kill fork server at %s: %v\n", fs.sockPath, err)
+		}
+	}
+}
+
 func (bm *BasicManager) chooseRandom() (server *ForkServer) {
 	rand.Seed(time.Now().Unix())
 	k := rand.Int() % len(bm.servers)
@@ -104,15 +125,15 @@ func (bm *BasicManager) chooseRandom() (server *ForkServer) {
 }
 
 /* Start the lambda python server, listening on socket at sockPath */
-func runLambdaServer(sockPath string) (err error) {
+func runLambdaServer(sockPath string) (cmd *exec.Cmd, err error) {
 	_, absPath, _, _ := runtime.Caller(1)
 	relPath := "../../../../../../../../../lambda/server.py" // disgusting path from this file in hack dir to server script
 	serverPath := filepath.Join(absPath, relPath)
 
-	cmd := exec.Command("/usr/bin/python", serverPath, sockPath)
+	cmd = exec.Command("/usr/bin/python", serverPath, sockPath)
 	if err := cmd.Start(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return cmd, nil
 }
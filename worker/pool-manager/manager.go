@@ -17,4 +17,7 @@ import (
 
 type PoolManager interface {
 	ForkEnter(sandbox sb.Sandbox) error
+
+	// Stops the servers of the pool
+	Shutdown()
 }
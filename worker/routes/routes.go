@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// Route maps requests to a lambda, by host, method and path:
+//
+//	{"host": "api.example.com", "method": "GET", "path": "/users/{id}", "lambda": "get-user"}
+//
+// The path is a pattern whose segments are literals, parameters like "{id}"
+// matching any one segment, or, as the last segment, a parameter like
+// "{rest...}" matching the rest of the path (possibly empty).  The host may
+// start with "*." to match any subdomain.  An empty host or method matches
+// any.
+type Route struct {
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path"`
+	Lambda string `json:"lambda"`
+
+	segments []string
+}
+
+// Match is a request matched by a Route, with the values of its
+// parameters.
+type Match struct {
+	Route  *Route
+	Params map[string]string
+}
+
+// Table is a list of Routes, tried in order.
+type Table struct {
+	routes []*Route
+}
+
+// Load reads a Table from a JSON file with an array of Routes.
+func Load(path string) (*Table, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open routes file (%v): %v", path, err)
+	}
+
+	table, err := Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse routes file (%v): %v", path, err)
+	}
+	return table, nil
+}
+
+// Parse reads a Table from a JSON array of Routes, and checks them.
+func Parse(raw []byte) (*Table, error) {
+	var routes []*Route
+	if err := json.Unmarshal(raw, &routes); err != nil {
+		return nil, err
+	}
+
+	for i, route := range routes {
+		if err := route.compile(); err != nil {
+			return nil, fmt.Errorf("route %d (%s): %v", i, route.Path, err)
+		}
+	}
+	return &Table{routes: routes}, nil
+}
+
+// Len returns the number of Routes in the Table.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.routes)
+}
+
+// Match returns the first Route that matches a request.  If none does, it
+// returns the methods of the Routes that match its host and path, if any
+// (for a 405 rather than a 404).
+func (t *Table) Match(host string, method string, path string) (*Match, []string) {
+	if t == nil {
+		return nil, nil
+	}
+
+	allowed := []string{}
+	for _, route := range t.routes {
+		if !route.matchHost(host) {
+			continue
+		}
+		params, ok := route.matchPath(path)
+		if !ok {
+			continue
+		}
+		if route.Method != "" && !strings.EqualFold(route.Method, method) {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+		return &Match{Route: route, Params: params}, nil
+	}
+	return nil, allowed
+}
+
+// compile checks a Route and splits its path pattern.
+func (r *Route) compile() error {
+	if r.Lambda == "" {
+		return fmt.Errorf("missing lambda")
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	r.Method = strings.ToUpper(r.Method)
+
+	r.segments = split(r.Path)
+	names := map[string]bool{}
+	for i, segment := range r.segments {
+		name, param, rest := parseSegment(segment)
+		if !param {
+			if strings.ContainsAny(segment, "{}") {
+				return fmt.Errorf("invalid segment %q", segment)
+			}
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return fmt.Errorf("invalid parameter %q", segment)
+		}
+		if rest && i != len(r.segments)-1 {
+			return fmt.Errorf("%s must be the last segment", segment)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate parameter %s", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// matchHost tells whether a host (with or without a port) matches the Route.
+func (r *Route) matchHost(host string) bool {
+	if r.Host == "" {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	pattern := strings.ToLower(r.Host)
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// matchPath matches a path against the Route's pattern, and returns the
+// values of its parameters.
+func (r *Route) matchPath(path string) (map[string]string, bool) {
+	segments := split(path)
+	params := map[string]string{}
+	for i, pattern := range r.segments {
+		name, param, rest := parseSegment(pattern)
+		if rest {
+			params[name] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if !param {
+			if segments[i] != pattern {
+				return nil, false
+			}
+			continue
+		}
+		params[name] = segments[i]
+	}
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// split returns the segments of a path, ignoring empty ones.
+func split(path string) []string {
+	segments := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// parseSegment tells whether a segment of a pattern is a parameter ("{name}"),
+// and whether it matches the rest of the path ("{name...}").
+func parseSegment(segment string) (name string, param bool, rest bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false, false
+	}
+	name = segment[1 : len(segment)-1]
+	if strings.HasSuffix(name, "...") {
+		return strings.TrimSuffix(name, "..."), true, true
+	}
+	return name, true, false
+}
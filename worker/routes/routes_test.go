@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	table, err := Parse([]byte(`[
+		{"host": "api.example.com", "method": "GET", "path": "/users/{id}", "lambda": "get-user"},
+		{"host": "api.example.com", "method": "put", "path": "/users/{id}", "lambda": "put-user"},
+		{"host": "*.example.com", "path": "/files/{path...}", "lambda": "files"},
+		{"path": "/users/{id}/orders/{order}", "lambda": "orders"},
+		{"path": "/", "lambda": "home"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, method, path string
+		lambda             string
+		params             map[string]string
+	}{
+		{"api.example.com:8080", "GET", "/users/42", "get-user", map[string]string{"id": "42"}},
+		{"API.example.com", "PUT", "/users/42/", "put-user", map[string]string{"id": "42"}},
+		{"cdn.example.com", "GET", "/files/a/b.txt", "files", map[string]string{"path": "a/b.txt"}},
+		{"cdn.example.com", "GET", "/files", "files", map[string]string{"path": ""}},
+		{"localhost", "POST", "/users/7/orders/9", "orders", map[string]string{"id": "7", "order": "9"}},
+		{"localhost", "GET", "/", "home", map[string]string{}},
+	}
+	for _, test := range tests {
+		match, _ := table.Match(test.host, test.method, test.path)
+		if match == nil {
+			t.Fatalf("Expected %s %s%s to match %s", test.method, test.host, test.path, test.lambda)
+		}
+		if match.Route.Lambda != test.lambda || !reflect.DeepEqual(match.Params, test.params) {
+			t.Fatalf("Expected %s %s%s to match %s with %v, got %s with %v",
+				test.method, test.host, test.path, test.lambda, test.params, match.Route.Lambda, match.Params)
+		}
+	}
+
+	if match, allowed := table.Match("api.example.com", "DELETE", "/users/42"); match != nil || !reflect.DeepEqual(allowed, []string{"GET", "PUT"}) {
+		t.Fatalf("Expected no match but GET and PUT allowed, got %v and %v", match, allowed)
+	}
+	if match, allowed := table.Match("other.org", "GET", "/files/a"); match != nil || len(allowed) != 0 {
+		t.Fatalf("Expected no match for another host, got %v and %v", match, allowed)
+	}
+	if match, _ := table.Match("localhost", "GET", "/users/7/orders"); match != nil {
+		t.Fatalf("Expected no match for a shorter path, got %v", match.Route.Lambda)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, raw := range []string{
+		`[{"path": "/x"}]`,
+		`[{"path": "x", "lambda": "f"}]`,
+		`[{"path": "/{rest...}/x", "lambda": "f"}]`,
+		`[{"path": "/{id}/{id}", "lambda": "f"}]`,
+		`[{"path": "/a{id}", "lambda": "f"}]`,
+		`[{"path": "/{}", "lambda": "f"}]`,
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Fatalf("Expected an error for %s", raw)
+		}
+	}
+}
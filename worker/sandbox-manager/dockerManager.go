@@ -5,7 +5,8 @@ package sbmanager
 Manages lambdas using the Docker registry.
 
 Each lambda endpoint must have an associated container image
-in the registry, named with its ID.
+in the registry, named with its ID.  Version N of a lambda
+(<name>@N) is the image tagged N.
 
 */
 
@@ -16,6 +17,7 @@ import (
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/open-lambda/open-lambda/worker/config"
 	sb "github.com/open-lambda/open-lambda/worker/sandbox"
+	"github.com/open-lambda/open-lambda/worker/versions"
 )
 
 type DockerManager struct {
@@ -30,11 +32,12 @@ func NewDockerManager(opts *config.Config) (manager *DockerManager, err error) {
 	return manager, nil
 }
 
-func (dm *DockerManager) Create(name string, sandbox_dir string) (sb.Sandbox, error) {
+func (dm *DockerManager) Create(name string, sandbox_dir string, opts *SandboxOpts) (sb.Sandbox, error) {
 	volumes := []string{
 		fmt.Sprintf("%s:%s", sandbox_dir, "/host/")}
 
-	sandbox, err := dm.create(name, sandbox_dir, name, volumes)
+	repo, tag := dockerImage(name)
+	sandbox, err := dm.create(name, sandbox_dir, repo+":"+tag, volumes, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -42,47 +45,64 @@ func (dm *DockerManager) Create(name string, sandbox_dir string) (sb.Sandbox, er
 	return sandbox, nil
 }
 
+// Handler code lives in the image, so there is no code directory.
+func (dm *DockerManager) CodeDir(name string) string {
+	return ""
+}
+
+// dockerImage returns the repository and tag of the image of a lambda.
+func dockerImage(name string) (repo string, tag string) {
+	repo, qualifier := versions.Split(name)
+	if qualifier == "" {
+		return repo, "latest"
+	}
+	return repo, qualifier
+}
+
 func (dm *DockerManager) Pull(name string) error {
+	repo, tag := dockerImage(name)
+
 	// delete if it exists, so we can pull a new one
-	imgExists, err := dm.DockerImageExists(name)
+	imgExists, err := dm.DockerImageExists(repo + ":" + tag)
 	if err != nil {
 		return err
 	}
 	if imgExists {
-		if dm.opts.Skip_pull_existing {
+		// versions never change
+		if dm.opts.Skip_pull_existing || tag != "latest" {
 			return nil
 		}
 		opts := docker.RemoveImageOptions{Force: true}
-		if err := dm.client().RemoveImageExtended(name, opts); err != nil {
+		if err := dm.client().RemoveImageExtended(repo+":"+tag, opts); err != nil {
 			return err
 		}
 	}
 
 	// pull new code
-	if err := dm.dockerPull(name); err != nil {
+	if err := dm.dockerPull(repo, tag); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (dm *DockerManager) dockerPull(img string) error {
+func (dm *DockerManager) dockerPull(img string, tag string) error {
 	err := dm.client().PullImage(
 		docker.PullImageOptions{
 			Repository: dm.registryName + "/" + img,
 			Registry:   dm.registryName,
-			Tag:        "latest",
+			Tag:        tag,
 		},
 		docker.AuthConfiguration{},
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to pull '%v' from %v registry\n", img, dm.registryName)
+		return fmt.Errorf("failed to pull '%v:%v' from %v registry\n", img, tag, dm.registryName)
 	}
 
 	err = dm.client().TagImage(
-		dm.registryName+"/"+img,
-		docker.TagImageOptions{Repo: img, Force: true})
+		dm.registryName+"/"+img+":"+tag,
+		docker.TagImageOptions{Repo: img, Tag: tag, Force: true})
 	if err != nil {
 		log.Printf("failed to re-tag container: %v\n", err)
 		return fmt.Errorf("failed to re-tag container: %v\n", err)
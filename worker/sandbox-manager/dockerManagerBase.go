@@ -9,7 +9,10 @@ by managers which managing Docker containers.
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/open-lambda/open-lambda/worker/config"
@@ -42,7 +45,7 @@ func (dm *DockerManagerBase) init(opts *config.Config) {
 	dm.opts = opts
 }
 
-func (dm *DockerManagerBase) create(name string, sandbox_dir string, image string, volumes []string) (sb.Sandbox, error) {
+func (dm *DockerManagerBase) create(name string, sandbox_dir string, image string, volumes []string, opts *SandboxOpts) (sb.Sandbox, error) {
 	internalAppPort := map[docker.Port]struct{}{"8080/tcp": {}}
 	portBindings := map[docker.Port][]docker.PortBinding{ //TODO: don't need these with sockets
 		"8080/tcp": {{HostIP: "0.0.0.0", HostPort: "0"}}}
@@ -54,13 +57,28 @@ func (dm *DockerManagerBase) create(name string, sandbox_dir string, image strin
 		cmd = []string{"/init"} // docker kill init doesn't work
 	}
 
+	env := dm.env
+	secrets_dir := ""
+	if opts != nil {
+		env = append(append([]string{}, dm.env...), opts.Env...)
+
+		if len(opts.Secret_files) > 0 {
+			var err error
+			secrets_dir, err = dm.writeSecrets(name, opts.Secret_files)
+			if err != nil {
+				return nil, err
+			}
+			volumes = append(volumes, fmt.Sprintf("%s:%s:ro", secrets_dir, config.SecretsDir))
+		}
+	}
+
 	container, err := dm.client().CreateContainer(
 		docker.CreateContainerOptions{
 			Config: &docker.Config{
 				Image:        image,
 				ExposedPorts: internalAppPort,
 				Labels:       dm.docker_labels(),
-				Env:          dm.env,
+				Env:          env,
 				Cmd:          cmd,
 			},
 			HostConfig: &docker.HostConfig{
@@ -72,14 +90,44 @@ func (dm *DockerManagerBase) create(name string, sandbox_dir string, image strin
 	)
 
 	if err != nil {
+		if secrets_dir != "" {
+			os.RemoveAll(secrets_dir)
+		}
 		return nil, err
 	}
 
 	sandbox := sb.NewDockerSandbox(name, sandbox_dir, container, dm.client(), dm.opts)
+	sandbox.SetSecretsDir(secrets_dir)
 
 	return sandbox, nil
 }
 
+// writeSecrets writes the secrets passed to a sandbox as files to a new
+// directory in the Secrets_tmp_dir (a tmpfs), to be mounted in the sandbox,
+// and returns the directory.
+func (dm *DockerManagerBase) writeSecrets(name string, files map[string][]byte) (string, error) {
+	if err := os.MkdirAll(dm.opts.Secrets_tmp_dir, 0700); err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir(dm.opts.Secrets_tmp_dir, name+"-")
+	if err != nil {
+		return "", err
+	}
+
+	// the parent directory keeps other users of the host out
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	for file, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), data, 0444); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
 func (dm *DockerManagerBase) docker_labels() map[string]string {
 	labels := map[string]string{}
 	labels[DOCKER_LABEL_CLUSTER] = dm.opts.Cluster_name
@@ -39,13 +39,13 @@ func NewLocalManager(opts *config.Config) (manager *LocalManager, err error) {
 	return manager, nil
 }
 
-func (lm *LocalManager) Create(name string, sandbox_dir string) (sb.Sandbox, error) {
+func (lm *LocalManager) Create(name string, sandbox_dir string, opts *SandboxOpts) (sb.Sandbox, error) {
 	handler := filepath.Join(lm.handler_dir, name)
 	volumes := []string{
 		fmt.Sprintf("%s:%s", handler, "/handler"),
 		fmt.Sprintf("%s:%s", sandbox_dir, "/host")}
 
-	sandbox, err := lm.create(name, sandbox_dir, BASE_IMAGE, volumes)
+	sandbox, err := lm.create(name, sandbox_dir, BASE_IMAGE, volumes, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +53,10 @@ func (lm *LocalManager) Create(name string, sandbox_dir string) (sb.Sandbox, err
 	return sandbox, nil
 }
 
+func (lm *LocalManager) CodeDir(name string) string {
+	return filepath.Join(lm.handler_dir, name)
+}
+
 func (lm *LocalManager) Pull(name string) error {
 	path := filepath.Join(lm.handler_dir, name)
 	_, err := os.Stat(path)
@@ -16,13 +16,30 @@ import (
 	sb "github.com/open-lambda/open-lambda/worker/sandbox"
 )
 
+// SandboxOpts are the settings of the sandbox of a lambda, from its
+// lambda-config.json.
+type SandboxOpts struct {
+	// environment variables, as KEY=value
+	Env []string
+
+	// files mounted (read-only, from a tmpfs) in the SecretsDir of the
+	// sandbox, by name
+	Secret_files map[string][]byte
+}
+
 type SandboxManager interface {
-	Create(name string, sandbox_dir string) (sb.Sandbox, error)
+	// Creates the sandbox of a lambda; opts may be nil
+	Create(name string, sandbox_dir string, opts *SandboxOpts) (sb.Sandbox, error)
 	Pull(name string) error
+
+	// Directory of pulled handler code on the host, or "" if the
+	// code is not kept in a directory (e.g., in a Docker image)
+	CodeDir(name string) string
 }
 
 type DockerSandboxManager interface {
-	Create(name string, sandbox_dir string) (sb.Sandbox, error)
+	Create(name string, sandbox_dir string, opts *SandboxOpts) (sb.Sandbox, error)
 	Pull(name string) error
+	CodeDir(name string) string
 	client() *docker.Client
 }
@@ -8,7 +8,10 @@ Creates lambda containers using the generic base image defined in
 dockerManagerBase.go (BASE_IMAGE).
 
 Handler code is mapped into the container by attaching a directory
-(<handler_dir>/<lambda_name>) when the container is started.
+(<handler_dir>/<lambda_name>/<pull>) when the container is started.  Each
+pull gets its own directory, so that a sandbox still running code pulled
+before keeps it; the directory of old code is removed with its last
+sandbox.
 
 */
 
@@ -19,6 +22,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"sync"
 
 	r "github.com/open-lambda/open-lambda/registry/src"
 	"github.com/open-lambda/open-lambda/worker/config"
@@ -29,6 +34,18 @@ type RegistryManager struct {
 	DockerManagerBase
 	pullclient  *r.PullClient
 	handler_dir string
+
+	// the code last pulled for each lambda, under mutex
+	mutex sync.Mutex
+	code  map[string]*pulledCode
+	pulls int
+}
+
+// pulledCode is the directory of a pull of the code of a lambda.
+type pulledCode struct {
+	dir       string
+	sandboxes int  // mounting it
+	current   bool // not replaced by a later pull
 }
 
 func NewRegistryManager(opts *config.Config) (rm *RegistryManager, err error) {
@@ -36,6 +53,7 @@ func NewRegistryManager(opts *config.Config) (rm *RegistryManager, err error) {
 	rm.DockerManagerBase.init(opts)
 	rm.pullclient = r.InitPullClient(opts.Reg_cluster, r.DATABASE, r.TABLE)
 	rm.handler_dir = "/var/tmp/olhandlers/"
+	rm.code = make(map[string]*pulledCode)
 
 	// Initialize a directory for the handler code. This directory is
 	// mapped into the lambda container in RegistryManager.Create
@@ -61,23 +79,65 @@ func NewRegistryManager(opts *config.Config) (rm *RegistryManager, err error) {
 	return rm, nil
 }
 
-func (rm *RegistryManager) Create(name string, sandbox_dir string) (sb.Sandbox, error) {
-	handler := filepath.Join(rm.handler_dir, name)
+func (rm *RegistryManager) Create(name string, sandbox_dir string, opts *SandboxOpts) (sb.Sandbox, error) {
+	rm.mutex.Lock()
+	code := rm.code[name]
+	if code == nil {
+		rm.mutex.Unlock()
+		return nil, fmt.Errorf("code of %s has not been pulled", name)
+	}
+	code.sandboxes += 1
+	rm.mutex.Unlock()
+
 	volumes := []string{
-		fmt.Sprintf("%s:%s", handler, "/handler/"),
+		fmt.Sprintf("%s:%s", code.dir, "/handler/"),
 		fmt.Sprintf("%s:%s", sandbox_dir, "/host/")}
 
-	sandbox, err := rm.create(name, sandbox_dir, BASE_IMAGE, volumes)
+	sandbox, err := rm.create(name, sandbox_dir, BASE_IMAGE, volumes, opts)
 	if err != nil {
+		rm.release(code)
 		return nil, err
 	}
+	if docker_sb, ok := sandbox.(*sb.DockerSandbox); ok {
+		docker_sb.OnRemove(func() { rm.release(code) })
+	}
 
 	return sandbox, nil
 }
 
+// release forgets a sandbox that mounted the given code, which is removed
+// with the last sandbox if a later pull replaced it.
+func (rm *RegistryManager) release(code *pulledCode) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	code.sandboxes -= 1
+	if code.sandboxes == 0 && !code.current {
+		if err := os.RemoveAll(code.dir); err != nil {
+			log.Printf("failed to remove old code in %s: %v", code.dir, err)
+		}
+	}
+}
+
+func (rm *RegistryManager) CodeDir(name string) string {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if code := rm.code[name]; code != nil {
+		return code.dir
+	}
+	return filepath.Join(rm.handler_dir, name)
+}
+
 func (rm *RegistryManager) Pull(name string) error {
-	dir := filepath.Join(rm.handler_dir, name)
-	if err := os.Mkdir(dir, os.ModeDir); err != nil {
+	rm.mutex.Lock()
+	rm.pulls += 1
+	dir := filepath.Join(rm.handler_dir, name, strconv.Itoa(rm.pulls))
+	rm.mutex.Unlock()
+
+	// a fresh directory, as sandboxes may still run the code of a
+	// previous pull
+	if err := os.MkdirAll(dir, os.ModeDir); err != nil {
 		return err
 	}
 
@@ -88,12 +148,29 @@ func (rm *RegistryManager) Pull(name string) error {
 	// TODO: try to uncompress without execing - faster?
 	cmd := exec.Command("tar", "-xvzf", "-", "--directory", dir)
 	cmd.Stdin = r
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
 
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	old := rm.code[name]
+	rm.code[name] = &pulledCode{dir: dir, current: true}
+	if old != nil {
+		old.current = false
+		if old.sandboxes == 0 {
+			if err := os.RemoveAll(old.dir); err != nil {
+				log.Printf("failed to remove old code in %s: %v", old.dir, err)
+			}
+		}
+	}
+	return nil
 }
 
 func (rm *RegistryManager) HandlerPresent(name string) (bool, error) {
-	dir := filepath.Join(rm.handler_dir, name)
+	dir := rm.CodeDir(name)
 	_, err := os.Stat(dir)
 	if err != nil {
 		return false, nil
@@ -17,6 +17,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"os/exec"
 	"path/filepath"
 
@@ -33,6 +34,8 @@ type DockerSandbox struct {
 	client      *docker.Client
 	config      *config.Config
 	controllers string
+	secrets_dir string // of the secret files mounted in the container
+	on_remove   func() // called once the container is removed
 }
 
 func NewDockerSandbox(name string, sandbox_dir string, container *docker.Container, client *docker.Client, config *config.Config) *DockerSandbox {
@@ -49,6 +52,18 @@ func NewDockerSandbox(name string, sandbox_dir string, container *docker.Contain
 	return sandbox
 }
 
+// SetSecretsDir sets the directory of the secret files mounted in the
+// container, which is deleted with the container.
+func (s *DockerSandbox) SetSecretsDir(dir string) {
+	s.secrets_dir = dir
+}
+
+// OnRemove sets a function to call once the container has been removed
+// (e.g., to release what is mounted in it).
+func (s *DockerSandbox) OnRemove(f func()) {
+	s.on_remove = f
+}
+
 func (s *DockerSandbox) dockerError(outer error) (err error) {
 	buf := bytes.NewBufferString(outer.Error() + ".  ")
 
@@ -165,6 +180,13 @@ func (s *DockerSandbox) Unpause() error {
 
 /* Frees all resources associated with the lambda (stops the container if necessary) */
 func (s *DockerSandbox) Remove() error {
+	// the secrets go even if the container cannot
+	if s.secrets_dir != "" {
+		if err := os.RemoveAll(s.secrets_dir); err != nil {
+			log.Printf("failed to rm secrets of %s with err %v", s.name, err)
+		}
+	}
+
 	if err := s.client.RemoveContainer(docker.RemoveContainerOptions{
 		ID: s.container.ID,
 	}); err != nil {
@@ -172,6 +194,9 @@ func (s *DockerSandbox) Remove() error {
 		return s.dockerError(err)
 	}
 
+	if s.on_remove != nil {
+		s.on_remove()
+	}
 	return nil
 }
 
@@ -208,6 +233,11 @@ func (s *DockerSandbox) CGroupEnter(pid string) (err error) {
 	return nil
 }
 
+/* Returns the ID of the container */
+func (s *DockerSandbox) ID() string {
+	return s.container.ID
+}
+
 func (s *DockerSandbox) NSPid() int {
 	return s.nspid
 }
@@ -43,4 +43,7 @@ type Sandbox interface {
 
 	// What port can we use to forward requests?
 	Channel() (*SandboxChannel, error)
+
+	// Unique identifier of the sandbox (e.g., the container ID)
+	ID() string
 }
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/accesslog"
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+// REQUEST_ID_HEADER carries the ID of an invocation, in the response and in
+// the request forwarded to the sandbox.
+const REQUEST_ID_HEADER = "X-Ol-Request-Id"
+
+// IDs set by clients (e.g., a proxy in front of the worker) are kept if they
+// look like this.
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// setRequestId gives a request an ID (unless the client gave it a valid
+// one), to be passed to the sandbox and returned in the response.
+func setRequestId(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(REQUEST_ID_HEADER)
+	if !validRequestId.MatchString(id) {
+		var err error
+		if id, err = newId(); err != nil {
+			id = "unknown"
+		}
+		r.Header.Set(REQUEST_ID_HEADER, id)
+	}
+
+	w.Header().Set(REQUEST_ID_HEADER, id)
+	return id
+}
+
+// newAccessEntry starts the access log entry of an invocation of a lambda.
+func newAccessEntry(r *http.Request, lambda string) *accesslog.Entry {
+	return &accesslog.Entry{
+		Time:      time.Now(),
+		RequestId: r.Header.Get(REQUEST_ID_HEADER),
+		Lambda:    lambda,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}
+}
+
+// logAccess completes an access log entry and writes it.
+func (s *Server) logAccess(entry *accesslog.Entry, status int, t0 time.Time, phases *handler.Phases) {
+	entry.Status = status
+	entry.SetDuration(time.Since(t0))
+	entry.SetPhases(phases.Durations())
+	s.access.Log(entry)
+}
+
+// countingWriter counts the bytes written to the body of a response.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
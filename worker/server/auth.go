@@ -0,0 +1,305 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator decides whether a request may invoke a lambda.
+type Authenticator interface {
+	// Authenticate returns nil if the request (with the given body)
+	// may invoke the named lambda, or else a 401 or 403 httpErr.
+	Authenticate(r *http.Request, lambda string, body io.Reader) *httpErr
+
+	// AuthenticateHeaders is Authenticate before the body is read, so
+	// clients without credentials cannot make the worker read (or
+	// stage) a large body.  The signature of a signed request is only
+	// checked by Authenticate, once the body is read.
+	AuthenticateHeaders(r *http.Request, lambda string) *httpErr
+
+	// AuthenticateAdmin returns nil if the request (with the given
+	// body) may change the state of the worker through its management
+	// endpoints, or else a 401 or 403 httpErr.
+	AuthenticateAdmin(r *http.Request, body io.Reader) *httpErr
+
+	// AuthenticateAdminHeaders is AuthenticateAdmin before the body is
+	// read (see AuthenticateHeaders).
+	AuthenticateAdminHeaders(r *http.Request) *httpErr
+}
+
+const (
+	API_KEY_HEADER   = "X-Api-Key"
+	KEY_ID_HEADER    = "X-Ol-Key-Id"
+	TIMESTAMP_HEADER = "X-Ol-Timestamp"
+	SIGNATURE_HEADER = "X-Ol-Signature"
+
+	// how far the timestamp of a signed request may be from now
+	MAX_SIGNATURE_SKEW = 5 * time.Minute
+)
+
+// credentialHeaders are stripped from the requests forwarded to sandboxes,
+// so lambdas never see the credentials of their clients.
+var credentialHeaders = []string{
+	API_KEY_HEADER,
+	KEY_ID_HEADER,
+	TIMESTAMP_HEADER,
+	SIGNATURE_HEADER,
+}
+
+// AuthKey is a credential that may invoke some lambdas.
+type AuthKey struct {
+	Id     string `json:"id"`
+	Type   string `json:"type"` // "api_key" or "hmac"
+	Secret string `json:"secret"`
+
+	// names of lambdas, or name prefixes ending with "*"
+	Lambdas []string `json:"lambdas"`
+
+	// may the key also change the state of the worker (e.g., delete
+	// handlers or set aliases)?
+	Admin bool `json:"admin"`
+}
+
+// KeyAuthenticator authenticates requests with static API keys, passed in
+// the X-Api-Key header, or with HMAC-SHA256 signatures (see SignRequest).
+type KeyAuthenticator struct {
+	apiKeys  []*AuthKey
+	hmacKeys map[string]*AuthKey // by ID
+}
+
+// NewKeyAuthenticator loads keys from a JSON file like this:
+//
+// {"keys": [{"id": "etl", "type": "hmac", "secret": "...", "lambdas": ["etl-*"]}]}
+func NewKeyAuthenticator(path string) (*KeyAuthenticator, error) {
+	keys, err := LoadAuthKeys(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &KeyAuthenticator{hmacKeys: make(map[string]*AuthKey)}
+	for _, key := range keys {
+		if key.Secret == "" {
+			return nil, fmt.Errorf("key '%s' in auth file has no secret", key.Id)
+		}
+
+		switch key.Type {
+		case "api_key":
+			a.apiKeys = append(a.apiKeys, key)
+		case "hmac":
+			if key.Id == "" {
+				return nil, fmt.Errorf("hmac key in auth file has no id")
+			}
+			a.hmacKeys[key.Id] = key
+		default:
+			return nil, fmt.Errorf("key '%s' in auth file has invalid type '%s'", key.Id, key.Type)
+		}
+	}
+
+	return a, nil
+}
+
+// LoadAuthKeys reads the keys of an auth file (see NewKeyAuthenticator),
+// e.g., for a client to sign its requests with.
+func LoadAuthKeys(path string) ([]*AuthKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open auth file (%v): %v\n", path, err.Error())
+	}
+
+	var file struct {
+		Keys []*AuthKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("could not parse auth file (%v): %v\n", path, err.Error())
+	}
+	return file.Keys, nil
+}
+
+// Sign adds the credentials of the key to a request with the given body:
+// the secret of an api_key, or the signature of an hmac key.
+func (key *AuthKey) Sign(r *http.Request, body []byte) {
+	if key.Type != "hmac" {
+		r.Header.Set(API_KEY_HEADER, key.Secret)
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(KEY_ID_HEADER, key.Id)
+	r.Header.Set(TIMESTAMP_HEADER, timestamp)
+	r.Header.Set(SIGNATURE_HEADER, SignRequest(key.Secret, r.Method, r.URL.RequestURI(), timestamp, body))
+}
+
+func (a *KeyAuthenticator) Authenticate(r *http.Request, lambda string, body io.Reader) *httpErr {
+	key, herr := a.key(r, body)
+	if herr != nil {
+		return herr
+	}
+	return key.mayInvoke(lambda)
+}
+
+func (a *KeyAuthenticator) AuthenticateHeaders(r *http.Request, lambda string) *httpErr {
+	key, herr := a.headerKey(r)
+	if herr != nil {
+		return herr
+	}
+	return key.mayInvoke(lambda)
+}
+
+func (a *KeyAuthenticator) AuthenticateAdmin(r *http.Request, body io.Reader) *httpErr {
+	key, herr := a.key(r, body)
+	if herr != nil {
+		return herr
+	}
+	return key.mayManage()
+}
+
+func (a *KeyAuthenticator) AuthenticateAdminHeaders(r *http.Request) *httpErr {
+	key, herr := a.headerKey(r)
+	if herr != nil {
+		return herr
+	}
+	return key.mayManage()
+}
+
+// key returns the key whose credentials the request carries, checking its
+// signature if any.
+func (a *KeyAuthenticator) key(r *http.Request, body io.Reader) (*AuthKey, *httpErr) {
+	key, herr := a.headerKey(r)
+	if herr != nil {
+		return nil, herr
+	}
+
+	if key.Type == "hmac" {
+		if err := verifySignature(r, key.Secret, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// headerKey returns the key whose credentials the request carries, without
+// checking its signature (only its timestamp).
+func (a *KeyAuthenticator) headerKey(r *http.Request) (*AuthKey, *httpErr) {
+	var key *AuthKey
+
+	if secret := r.Header.Get(API_KEY_HEADER); secret != "" {
+		for _, k := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(k.Secret), []byte(secret)) == 1 {
+				key = k
+				break
+			}
+		}
+		if key == nil {
+			return nil, newHttpErr("Invalid API key", http.StatusUnauthorized)
+		}
+	} else if id := r.Header.Get(KEY_ID_HEADER); id != "" {
+		key = a.hmacKeys[id]
+		if key == nil {
+			return nil, newHttpErr("Invalid key ID", http.StatusUnauthorized)
+		}
+		if err := verifyTimestamp(r); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, newHttpErr("Credentials required", http.StatusUnauthorized)
+	}
+
+	return key, nil
+}
+
+// mayInvoke returns a 403 httpErr unless the key may invoke the named
+// lambda.
+func (key *AuthKey) mayInvoke(lambda string) *httpErr {
+	if !key.allows(lambda) {
+		return newHttpErr(
+			fmt.Sprintf("Key '%s' may not invoke %s", key.Id, lambda),
+			http.StatusForbidden)
+	}
+	return nil
+}
+
+// mayManage returns a 403 httpErr unless the key is an admin key.
+func (key *AuthKey) mayManage() *httpErr {
+	if !key.Admin {
+		return newHttpErr(
+			fmt.Sprintf("Key '%s' may not manage the worker", key.Id),
+			http.StatusForbidden)
+	}
+	return nil
+}
+
+// allows tells whether the key is scoped to the named lambda.
+func (key *AuthKey) allows(lambda string) bool {
+	for _, scope := range key.Lambdas {
+		if strings.HasSuffix(scope, "*") {
+			if strings.HasPrefix(lambda, scope[:len(scope)-1]) {
+				return true
+			}
+		} else if scope == lambda {
+			return true
+		}
+	}
+	return false
+}
+
+// SignRequest computes the signature a client sends in the X-Ol-Signature
+// header: the hex HMAC-SHA256, keyed by the secret, of the method, the
+// request URI (path and query), the timestamp (Unix seconds, also sent in
+// X-Ol-Timestamp) and the body, separated by newlines.
+func SignRequest(secret string, method string, uri string, timestamp string, body []byte) string {
+	mac := newSigner(secret, method, uri, timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newSigner returns the HMAC of SignRequest, before the body is written.
+func newSigner(secret string, method string, uri string, timestamp string) hash.Hash {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n"))
+	return mac
+}
+
+// verifyTimestamp checks that a signed request is recent.  Within the skew,
+// a signed request may be replayed: the worker keeps no record of the
+// signatures it has seen.
+func verifyTimestamp(r *http.Request) *httpErr {
+	seconds, err := strconv.ParseInt(r.Header.Get(TIMESTAMP_HEADER), 10, 64)
+	if err != nil {
+		return newHttpErr("Invalid or missing timestamp", http.StatusUnauthorized)
+	}
+
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > MAX_SIGNATURE_SKEW || skew < -MAX_SIGNATURE_SKEW {
+		return newHttpErr("Timestamp too far from current time", http.StatusUnauthorized)
+	}
+
+	return nil
+}
+
+func verifySignature(r *http.Request, secret string, body io.Reader) *httpErr {
+	timestamp := r.Header.Get(TIMESTAMP_HEADER)
+	mac := newSigner(secret, r.Method, r.URL.RequestURI(), timestamp)
+	if _, err := io.Copy(mac, body); err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(SIGNATURE_HEADER))) {
+		return newHttpErr("Invalid signature", http.StatusUnauthorized)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAuthenticator(t *testing.T) *KeyAuthenticator {
+	dir, err := ioutil.TempDir("", "ol-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.json")
+	keys := `{"keys": [
+		{"id": "web", "type": "api_key", "secret": "s3cret", "lambdas": ["echo"]},
+		{"id": "etl", "type": "hmac", "secret": "hm4c", "lambdas": ["etl-*"]},
+		{"id": "ops", "type": "api_key", "secret": "4dmin", "admin": true}
+	]}`
+	if err := ioutil.WriteFile(path, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewKeyAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func authReq(t *testing.T, url string, body string) *http.Request {
+	r, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func expectCode(t *testing.T, herr *httpErr, code int) {
+	if code == 0 && herr != nil {
+		t.Fatalf("Expected success, got %v: %v", herr.code, herr.msg)
+	} else if code != 0 && (herr == nil || herr.code != code) {
+		t.Fatalf("Expected %v, got %+v", code, herr)
+	}
+}
+
+func TestAuthApiKey(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	r := authReq(t, "http://localhost/runLambda/echo", "{}")
+	expectCode(t, auth.Authenticate(r, "echo", strings.NewReader("{}")), http.StatusUnauthorized)
+
+	r.Header.Set(API_KEY_HEADER, "wrong")
+	expectCode(t, auth.Authenticate(r, "echo", strings.NewReader("{}")), http.StatusUnauthorized)
+
+	r.Header.Set(API_KEY_HEADER, "s3cret")
+	expectCode(t, auth.Authenticate(r, "echo", strings.NewReader("{}")), 0)
+	expectCode(t, auth.Authenticate(r, "hello", strings.NewReader("{}")), http.StatusForbidden)
+}
+
+func TestAuthHmac(t *testing.T) {
+	auth := newTestAuthenticator(t)
+	body := []byte(`{"rows": 10}`)
+	sign := func(r *http.Request, secret string, when time.Time) {
+		timestamp := strconv.FormatInt(when.Unix(), 10)
+		r.Header.Set(KEY_ID_HEADER, "etl")
+		r.Header.Set(TIMESTAMP_HEADER, timestamp)
+		r.Header.Set(SIGNATURE_HEADER, SignRequest(secret, r.Method, r.URL.RequestURI(), timestamp, body))
+	}
+
+	r := authReq(t, "http://localhost/runLambda/etl-load?day=1", string(body))
+	sign(r, "hm4c", time.Now())
+	expectCode(t, auth.Authenticate(r, "etl-load", bytes.NewReader(body)), 0)
+	expectCode(t, auth.Authenticate(r, "echo", bytes.NewReader(body)), http.StatusForbidden)
+
+	// tampered body
+	expectCode(t, auth.Authenticate(r, "etl-load", strings.NewReader(`{"rows": 11}`)), http.StatusUnauthorized)
+
+	sign(r, "wrong", time.Now())
+	expectCode(t, auth.Authenticate(r, "etl-load", bytes.NewReader(body)), http.StatusUnauthorized)
+
+	sign(r, "hm4c", time.Now().Add(-time.Hour))
+	expectCode(t, auth.Authenticate(r, "etl-load", bytes.NewReader(body)), http.StatusUnauthorized)
+	expectCode(t, auth.AuthenticateHeaders(r, "etl-load"), http.StatusUnauthorized)
+
+	// before the body is read, only the key and timestamp are checked
+	sign(r, "wrong", time.Now())
+	expectCode(t, auth.AuthenticateHeaders(r, "etl-load"), 0)
+	expectCode(t, auth.AuthenticateHeaders(r, "echo"), http.StatusForbidden)
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func TestAuthBeforeRead(t *testing.T) {
+	s, _, cleanup := newFakeServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer cleanup()
+	s.auth = newTestAuthenticator(t)
+	s.config.Spill_threshold = 8
+
+	// a large body that would be staged, if it were read
+	for _, key := range []string{"", "wrong", "s3cret"} {
+		body := &countingReader{}
+		r := httptest.NewRequest("POST", "/runLambda/hello", body)
+		if key != "" {
+			r.Header.Set(API_KEY_HEADER, key)
+		}
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		if w.Code != http.StatusUnauthorized && w.Code != http.StatusForbidden {
+			t.Fatalf("Expected 401 or 403 with key %q, got %d", key, w.Code)
+		}
+		if body.n != 0 {
+			t.Fatalf("Expected the body not to be read with key %q, but %d bytes were", key, body.n)
+		}
+	}
+
+	body := &countingReader{}
+	r := httptest.NewRequest("POST", "/handlers/hello/stop", body)
+	w := httptest.NewRecorder()
+	s.Handlers(w, r)
+	if w.Code != http.StatusUnauthorized || body.n != 0 {
+		t.Fatalf("Expected 401 without reading the body, got %d after %d bytes", w.Code, body.n)
+	}
+}
+
+func TestAuthAdmin(t *testing.T) {
+	s, _, cleanup := newFakeServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range credentialHeaders {
+			if r.Header.Get(key) != "" {
+				http.Error(w, key+" forwarded", http.StatusBadRequest)
+				return
+			}
+		}
+	}))
+	defer cleanup()
+	s.auth = newTestAuthenticator(t)
+
+	// only admin keys may manage the worker
+	manage := func(method string, url string, key string) int {
+		r := httptest.NewRequest(method, url, nil)
+		if key != "" {
+			r.Header.Set(API_KEY_HEADER, key)
+		}
+		w := httptest.NewRecorder()
+		s.Handlers(w, r)
+		return w.Code
+	}
+	if code := manage("DELETE", "/handlers/echo", ""); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a key, got %d", code)
+	}
+	if code := manage("POST", "/handlers/echo/stop", "s3cret"); code != http.StatusForbidden {
+		t.Fatalf("Expected 403 with a key that is not admin, got %d", code)
+	}
+	if code := manage("DELETE", "/handlers/echo", "4dmin"); code != http.StatusNotFound {
+		t.Fatalf("Expected the admin key to get through (to a 404), got %d", code)
+	}
+	// reads need an admin key too
+	if code := manage("GET", "/handlers", ""); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for listing handlers without a key, got %d", code)
+	}
+	if code := manage("GET", "/handlers", "4dmin"); code != http.StatusOK {
+		t.Fatalf("Expected handlers to be listed with the admin key, got %d", code)
+	}
+	for _, path := range []string{"/deadletters", "/deadletters/x"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set(API_KEY_HEADER, "s3cret")
+		w := httptest.NewRecorder()
+		s.DeadLetters(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("Expected 403 for %s with a key that is not admin, got %d", path, w.Code)
+		}
+	}
+
+	// the lambda never sees the key
+	r := httptest.NewRequest("POST", "/runLambda/echo", strings.NewReader("{}"))
+	r.Header.Set(API_KEY_HEADER, "s3cret")
+	w := httptest.NewRecorder()
+	s.RunLambda(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuthKeySign(t *testing.T) {
+	auth := newTestAuthenticator(t)
+
+	for _, key := range []*AuthKey{
+		{Id: "web", Type: "api_key", Secret: "s3cret"},
+		{Id: "etl", Type: "hmac", Secret: "hm4c"},
+	} {
+		r := httptest.NewRequest("POST", "/runLambda/etl-load?x=1", strings.NewReader("{}"))
+		key.Sign(r, []byte("{}"))
+		lambda := "echo"
+		if key.Type == "hmac" {
+			lambda = "etl-load"
+		}
+		if err := auth.Authenticate(r, lambda, strings.NewReader("{}")); err != nil {
+			t.Fatalf("Expected the request signed with %s to be authenticated: %s", key.Id, err.msg)
+		}
+	}
+}
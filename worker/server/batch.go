@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/metrics"
+	"github.com/open-lambda/open-lambda/worker/trace"
+)
+
+// batchResult is the outcome of one event of a batch.
+type batchResult struct {
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+func (s *Server) RunBatchErr(w http.ResponseWriter, r *http.Request) (herr *httpErr) {
+	setRequestId(w, r)
+
+	// components represent runBatch[0]/<name_of_sandbox>[1]/<extra_things>...
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of image to run required",
+			http.StatusBadRequest)
+	}
+	img, version, herr := s.resolve(urlParts[1])
+	if herr != nil {
+		return herr
+	}
+	setVersion(w, version)
+
+	t0 := time.Now()
+	code := http.StatusOK
+	phases := handler.NewPhases()
+	entry := newAccessEntry(r, img)
+	tr := s.startTrace(r, img)
+	cw := &countingWriter{ResponseWriter: w}
+	defer func() {
+		if herr != nil {
+			code = herr.code
+			entry.Error = herr.msg
+		}
+		metrics.ObserveInvocation(img, code, time.Since(t0))
+		entry.BytesOut = cw.n
+		s.logAccess(entry, code, t0, phases)
+		s.endTrace(tr, code, entry.Error, phases)
+	}()
+
+	// read request
+	h, input, herr := s.readInput(r, img, phases)
+	if herr != nil {
+		return herr
+	}
+	defer input.Remove()
+	entry.BytesIn = input.size
+
+	body, err := input.Open()
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	var events []json.RawMessage
+	err = json.NewDecoder(body).Decode(&events)
+	body.Close()
+	if err != nil {
+		return newHttpErr(
+			"Batch must be a JSON array of events: "+err.Error(),
+			http.StatusBadRequest)
+	}
+	if max := s.config.Batch_max_events; max > 0 && len(events) > max {
+		return newHttpErr(
+			fmt.Sprintf("Batch of %d events exceeds limit of %d events", len(events), max),
+			http.StatusRequestEntityTooLarge)
+	}
+
+	results := s.runBatch(h, r, events, tr.traceparent(), phases)
+	return writeJson(cw, results)
+}
+
+// runBatch forwards each event to the sandbox of h as its own request,
+// running up to the lambda's max_concurrency (or else the worker's
+// batch_concurrency) at once.  The sandbox is kept running for the whole
+// batch, rather than paused and unpaused between events.  The results
+// together are held to the response size limit of the lambda: past it,
+// events fail with a 413 rather than run.
+func (s *Server) runBatch(h *handler.Handler, r *http.Request, events []json.RawMessage, traceparent string, phases *handler.Phases) []batchResult {
+	results := make([]batchResult, len(events))
+	if len(events) == 0 {
+		return results
+	}
+
+	// the extra runner keeps RunFinish from pausing the sandbox when
+	// no event happens to be running
+	if _, err := h.RunStart(phases); err != nil {
+		for i := range results {
+			results[i] = batchResult{Status: http.StatusInternalServerError, Error: err.Error()}
+		}
+		return results
+	}
+	defer h.RunFinish(phases)
+
+	concurrency := s.config.Batch_concurrency
+	limit := sizeLimit(s.config.Max_response_size, 0)
+	if lconf, err := h.Config(); err == nil {
+		if lconf.Max_concurrency > 0 {
+			concurrency = lconf.Max_concurrency
+		}
+		limit = sizeLimit(s.config.Max_response_size, lconf.Max_response_size)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// bytes of the results so far, under mutex
+	var mutex sync.Mutex
+	size := int64(0)
+	tooLarge := func() batchResult {
+		return batchResult{
+			Status: http.StatusRequestEntityTooLarge,
+			Error:  fmt.Sprintf("Batch response exceeds limit of %d bytes", limit),
+		}
+	}
+
+	slots := make(chan bool, concurrency)
+	var wg sync.WaitGroup
+	for i, event := range events {
+		slots <- true
+		wg.Add(1)
+		go func(i int, event json.RawMessage) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			mutex.Lock()
+			over := limit > 0 && size > limit
+			mutex.Unlock()
+			if over {
+				results[i] = tooLarge()
+				return
+			}
+
+			result := s.forwardEvent(h, subRequest(r, strconv.Itoa(i), traceparent), event, phases)
+			mutex.Lock()
+			size += int64(len(result.Result) + len(result.Error))
+			if limit > 0 && size > limit {
+				result = tooLarge()
+			}
+			mutex.Unlock()
+			results[i] = result
+		}(i, event)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// forwardEvent forwards one event (e.g., of a batch) to the sandbox, and
+// returns its result.
+func (s *Server) forwardEvent(h *handler.Handler, r *http.Request, event json.RawMessage, phases *handler.Phases) batchResult {
+	input := &payload{data: event, size: int64(len(event))}
+	w2, herr := s.ForwardToSandbox(h, r, input, phases)
+	if herr == nil {
+		herr = s.limitResponse(h, w2)
+		if herr != nil {
+			w2.Body.Close()
+		}
+	}
+
+	var wbody []byte
+	if herr == nil {
+		wbody, herr = readResponse(w2)
+	}
+	if herr != nil {
+		log.Printf("could not forward event %s: %s\n", r.Header.Get(REQUEST_ID_HEADER), herr.msg)
+		return batchResult{Status: herr.code, Error: herr.msg}
+	}
+
+	return batchResult{Status: w2.StatusCode, Result: jsonResult(wbody)}
+}
+
+// subRequest returns a request made on behalf of another (e.g., for the i'th
+// event of a batch): a copy with its own request ID, <id>-<suffix>.
+func subRequest(r *http.Request, suffix string, traceparent string) *http.Request {
+	item := new(http.Request)
+	*item = *r
+	item.Header = make(http.Header, len(r.Header))
+	copyHeaders(item.Header, r.Header)
+
+	item.Header.Set(REQUEST_ID_HEADER, r.Header.Get(REQUEST_ID_HEADER)+"-"+suffix)
+	item.Header.Set("Content-Type", "application/json")
+	if traceparent != "" {
+		item.Header.Set(trace.TRACEPARENT_HEADER, traceparent)
+	}
+
+	return item
+}
+
+// RunBatch runs a lambda on each of an array of events, and returns an array
+// with the status and result (or error) of each:
+//
+// curl -X POST localhost:8080/runBatch/<lambda-name> -d '[{"n": 1}, {"n": 2}]'
+func (s *Server) RunBatch(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.RunBatchErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunBatch(t *testing.T) {
+	var mutex sync.Mutex
+	running, peak := 0, 0
+
+	// doubles n, or fails if it is negative
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		running += 1
+		if running > peak {
+			peak = running
+		}
+		mutex.Unlock()
+		defer func() {
+			mutex.Lock()
+			running -= 1
+			mutex.Unlock()
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		var event struct{ N int }
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &event)
+		if event.N < 0 {
+			http.Error(w, "negative", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(event.N * 2)
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "double", `{"max_concurrency": 2}`)
+
+	events := []string{}
+	for i := 0; i < 8; i++ {
+		events = append(events, `{"n": 1}`)
+	}
+	events = append(events, `{"n": -1}`)
+
+	r := httptest.NewRequest("POST", "/runBatch/double", strings.NewReader("["+strings.Join(events, ",")+"]"))
+	w := httptest.NewRecorder()
+	s.RunBatch(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var results []batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 9 {
+		t.Fatalf("Expected 9 results, got %d", len(results))
+	}
+	for _, result := range results[:8] {
+		if result.Status != 200 || strings.TrimSpace(string(result.Result)) != "2" {
+			t.Fatalf("Unexpected result %+v", result)
+		}
+	}
+	if results[8].Status != 500 {
+		t.Fatalf("Expected failed last event, got %+v", results[8])
+	}
+
+	if peak > 2 {
+		t.Fatalf("Expected at most 2 concurrent events, got %d", peak)
+	}
+
+	// one sandbox, started once and paused once after the batch
+	sb := sm.sandboxes[0]
+	if len(sm.sandboxes) != 1 || sb.starts != 1 || sb.pauses != 1 || sb.unpauses != 0 {
+		t.Fatalf("Expected 1 start and 1 pause, got %d sandboxes, %d starts, %d pauses, %d unpauses",
+			len(sm.sandboxes), sb.starts, sb.pauses, sb.unpauses)
+	}
+}
+
+func TestRunBatchInvalid(t *testing.T) {
+	s, _, cleanup := newFakeServer(t, http.NotFoundHandler())
+	defer cleanup()
+
+	r := httptest.NewRequest("POST", "/runBatch/double", strings.NewReader(`{"n": 1}`))
+	w := httptest.NewRecorder()
+	s.RunBatch(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestRunBatchLimits(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"0123456789"`))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "f", `{"max_concurrency": 1, "max_response_size": 50}`)
+	s.config.Batch_max_events = 10
+
+	run := func(n int) *httptest.ResponseRecorder {
+		events := strings.TrimSuffix(strings.Repeat("{},", n), ",")
+		r := httptest.NewRequest("POST", "/runBatch/f", strings.NewReader("["+events+"]"))
+		w := httptest.NewRecorder()
+		s.RunBatch(w, r)
+		return w
+	}
+
+	if w := run(11); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 for too many events, got %d", w.Code)
+	}
+
+	// 12 bytes per result, so the fifth is over 50 bytes
+	w := run(10)
+	var results []batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if expected := http.StatusOK; i >= 4 && result.Status != http.StatusRequestEntityTooLarge ||
+			i < 4 && result.Status != expected {
+			t.Fatalf("Unexpected status of event %d: %+v", i, result)
+		}
+	}
+}
+
+func TestRunBatchNegativeConcurrency(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`1`))
+	})
+	s, _, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	s.config.Batch_concurrency = -1
+
+	// runs one event at a time rather than panicking
+	r := httptest.NewRequest("POST", "/runBatch/f", strings.NewReader(`[{}, {}]`))
+	w := httptest.NewRecorder()
+	s.RunBatch(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
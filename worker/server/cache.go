@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/cache"
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+// CACHE_HEADER tells the client whether a response came from the cache
+// ("hit") or from the sandbox ("miss"), for lambdas with a cache.
+const CACHE_HEADER = "X-Ol-Cache"
+
+// cacheKey returns the key under which the response to a request is cached,
+// and for how long, or "" if the responses of the lambda are not cached.
+// The key depends on the version of the code, the method, the path after
+// the lambda name, the query string, the Accept header and the headers
+// listed in the lambda's vary, and the body of the request.
+func (s *Server) cacheKey(h *handler.Handler, lambda string, r *http.Request, input *payload) (string, time.Duration, *httpErr) {
+	if s.cache == nil {
+		return "", 0, nil
+	}
+
+	lconf, err := h.Config()
+	if err != nil {
+		return "", 0, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	if lconf.Cache == nil || lconf.Cache.Ttl <= 0 {
+		return "", 0, nil
+	}
+
+	body, err := input.Open()
+	if err != nil {
+		return "", 0, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", r.Method, lambdaPath(r), r.URL.RawQuery)
+	for _, name := range append([]string{"Accept"}, lconf.Cache.Vary...) {
+		fmt.Fprintf(hash, "%s: %q\n", http.CanonicalHeaderKey(name), r.Header.Values(name))
+	}
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", 0, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	key := fmt.Sprintf("%s/%d/%x", lambda, h.Version(), hash.Sum(nil))
+	return key, time.Duration(lconf.Cache.Ttl) * time.Second, nil
+}
+
+// purgeCache drops the cached responses of a lambda, if any.
+func (s *Server) purgeCache(lambda string) {
+	if s.cache == nil {
+		return
+	}
+	if n := s.cache.Purge(lambda); n > 0 {
+		log.Printf("purged %d cached responses of %s\n", n, lambda)
+	}
+}
+
+// cacheable tells whether a sandbox response may be cached.
+func cacheable(w2 *http.Response) bool {
+	return w2.StatusCode >= 200 && w2.StatusCode < 300 &&
+		!headerHasToken(w2.Header, "Cache-Control", "no-store")
+}
+
+// writeCached sends a cached response to the client.
+func writeCached(w http.ResponseWriter, entry *cache.Entry) error {
+	copyHeaders(w.Header(), entry.Header)
+	w.Header().Set(CACHE_HEADER, "hit")
+	w.WriteHeader(entry.Status)
+	_, err := w.Write(entry.Body)
+	return err
+}
+
+// cacheBody keeps a copy of a response body as it is streamed to the client,
+// up to max bytes, so that the response can be cached.
+type cacheBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	max  int64
+	over bool // was the body larger than max?
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.over {
+		if int64(b.buf.Len()+n) > b.max {
+			b.over = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// entry returns the cache entry for a response whose body was read through
+// b, or nil if the body was too large.
+func (b *cacheBody) entry(w2 *http.Response) *cache.Entry {
+	if b.over {
+		return nil
+	}
+	return &cache.Entry{
+		Status: w2.StatusCode,
+		Header: w2.Header.Clone(),
+		Body:   b.buf.Bytes(),
+	}
+}
+
+func (s *Server) CacheErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	if herr := s.authenticateAdmin(r); herr != nil {
+		return herr
+	}
+
+	if s.cache == nil {
+		return newHttpErr(
+			"Response cache is disabled",
+			http.StatusNotFound)
+	}
+
+	// components represent cache[0]/<name_of_sandbox>[1]
+	lambda := ""
+	if urlParts := getUrlComponents(r); len(urlParts) >= 2 {
+		lambda = urlParts[1]
+	}
+
+	switch r.Method {
+	case "GET":
+		stats := s.cache.Stats()
+		if lambda != "" {
+			return writeJson(w, stats[lambda])
+		}
+		return writeJson(w, stats)
+	case "DELETE":
+		n := s.cache.Purge(lambda)
+		log.Printf("purged %d cached responses\n", n)
+		return writeJson(w, map[string]int{"purged": n})
+	default:
+		return newHttpErr(
+			"Method not allowed",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// Cache reports the hits and misses of the response cache, by lambda, and
+// purges cached responses of all lambdas (or one):
+//
+// curl localhost:8080/cache[/<lambda-name>]
+// curl -X DELETE localhost:8080/cache[/<lambda-name>]
+func (s *Server) Cache(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.CacheErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/worker/cache"
+)
+
+func TestResponseCache(t *testing.T) {
+	var mutex sync.Mutex
+	calls := 0
+
+	// echoes the body, except for "secret", which must not be stored
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls += 1
+		mutex.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "secret" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	s.cache = cache.New(1 << 20)
+	writeLambdaConfig(t, sm, "echo", `{"cache": {"ttl": 60}}`)
+
+	run := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/runLambda/echo", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != body {
+			t.Fatalf("Expected 200 %q, got %d %q", body, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	if w := run("a"); w.Header().Get(CACHE_HEADER) != "miss" {
+		t.Fatalf("Expected a miss, got %q", w.Header().Get(CACHE_HEADER))
+	}
+	unpauses := sm.sandboxes[0].unpauses
+	w := run("a")
+	if w.Header().Get(CACHE_HEADER) != "hit" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("Expected a hit with the lambda's headers, got %v", w.Header())
+	}
+	if sm.sandboxes[0].unpauses != unpauses {
+		t.Fatalf("Expected a hit not to unpause the sandbox")
+	}
+	run("b")
+	run("secret")
+	run("secret")
+	if calls != 4 {
+		t.Fatalf("Expected 4 calls to the lambda, got %d", calls)
+	}
+
+	// a new version of the code is not served old responses
+	if err := s.handlers.Get("echo").Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if w := run("a"); w.Header().Get(CACHE_HEADER) != "miss" {
+		t.Fatalf("Expected a miss after a pull, got %q", w.Header().Get(CACHE_HEADER))
+	}
+
+	r := httptest.NewRequest("DELETE", "/cache/echo", nil)
+	w = httptest.NewRecorder()
+	s.Cache(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"purged": 3`) {
+		t.Fatalf("Expected 3 responses purged, got %d %s", w.Code, w.Body.String())
+	}
+	if w := run("b"); w.Header().Get(CACHE_HEADER) != "miss" {
+		t.Fatalf("Expected a miss after a purge, got %q", w.Header().Get(CACHE_HEADER))
+	}
+
+	stats := s.cache.Stats()["echo"]
+	if stats.Hits != 1 || stats.Misses != 6 || stats.Entries != 1 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Accept") + " " + r.Header.Get("Accept-Language")))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	s.cache = cache.New(1 << 20)
+	writeLambdaConfig(t, sm, "f", `{"cache": {"ttl": 60, "vary": ["accept-language"]}}`)
+
+	run := func(accept string, language string) string {
+		r := httptest.NewRequest("GET", "/runLambda/f", nil)
+		r.Header.Set("Accept", accept)
+		r.Header.Set("Accept-Language", language)
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != accept+" "+language {
+			t.Fatalf("Expected 200 %q, got %d %q", accept+" "+language, w.Code, w.Body.String())
+		}
+		return w.Header().Get(CACHE_HEADER)
+	}
+
+	run("text/html", "en")
+	for _, headers := range [][]string{{"application/json", "en"}, {"text/html", "fr"}} {
+		if cached := run(headers[0], headers[1]); cached != "miss" {
+			t.Fatalf("Expected a miss for %v, got %q", headers, cached)
+		}
+	}
+	if cached := run("text/html", "en"); cached != "hit" {
+		t.Fatalf("Expected a hit, got %q", cached)
+	}
+
+	// a handler created after a delete may run new code
+	version := s.handlers.Get("f").Version()
+	r := httptest.NewRequest("DELETE", "/handlers/f", nil)
+	w := httptest.NewRecorder()
+	s.Handlers(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := s.cache.Stats()["f"].Entries; n != 0 {
+		t.Fatalf("Expected the responses of a deleted handler to be purged, got %d", n)
+	}
+	if cached := run("text/html", "en"); cached != "miss" {
+		t.Fatalf("Expected a miss after a delete, got %q", cached)
+	}
+	if s.handlers.Get("f").Version() == version {
+		t.Fatalf("Expected a new version of the code after a delete, got %d again", version)
+	}
+}
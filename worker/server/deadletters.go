@@ -0,0 +1,272 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/deadletter"
+)
+
+// retryPolicy returns the retry policy of a lambda.
+func (s *Server) retryPolicy(lambda string) config.RetryConfig {
+	lconf, err := s.handlers.Get(lambda).Config()
+	if err != nil || lconf.Retry == nil {
+		return config.RetryConfig{}
+	}
+	return *lconf.Retry
+}
+
+// retryDelay returns how long to wait before the given retry (1 for the
+// first one).
+func retryDelay(policy config.RetryConfig, retry int) time.Duration {
+	seconds := policy.Backoff
+	for i := 1; i < retry && (policy.Max_backoff == 0 || seconds < policy.Max_backoff); i++ {
+		seconds *= 2
+	}
+	if policy.Max_backoff > 0 && seconds > policy.Max_backoff {
+		seconds = policy.Max_backoff
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// waitRetry waits before a retry, and tells whether to go on with it;
+// retries are given up when the worker shuts down.
+func (s *Server) waitRetry(delay time.Duration) bool {
+	select {
+	case <-time.After(delay):
+		return true
+	case <-s.syncStop:
+		return false
+	}
+}
+
+// retryable tells whether another attempt of a failed Job may succeed.
+func (job *Job) retryable() bool {
+	return job.failed() && (job.Code >= 500 || job.Code == http.StatusTooManyRequests)
+}
+
+// nextRetry tells whether the retry policy of its lambda retries a Job
+// after its last attempt, and how long to wait before.
+func (s *Server) nextRetry(job *Job) (time.Duration, bool) {
+	policy := s.retryPolicy(job.Lambda)
+	if !job.retryable() || job.Attempts > policy.Max_retries {
+		return 0, false
+	}
+
+	delay := retryDelay(policy, job.Attempts)
+	log.Printf("attempt %d of job %s failed (%d %s), retry in %v\n",
+		job.Attempts, job.ID, job.Code, job.Error, delay)
+	return delay, true
+}
+
+// runAsync runs an attempt of an asynchronous Job for the JobQueue, which
+// queues the Job again at its RetryAt if the retry policy of its lambda
+// says so.
+func (s *Server) runAsync(job *Job) {
+	s.runAttempt(job)
+	job.Attempts += 1
+	if delay, ok := s.nextRetry(job); ok {
+		job.RetryAt = time.Now().Add(delay)
+	}
+}
+
+// runJob runs a triggered Job, retrying it as the retry policy of its
+// lambda says, then finishes it.  Retries are given up when the worker
+// shuts down.
+func (s *Server) runJob(job *Job) {
+	for {
+		s.runAttempt(job)
+		job.Attempts += 1
+		delay, ok := s.nextRetry(job)
+		if !ok || !s.waitRetry(delay) {
+			break
+		}
+	}
+	s.finishJob(job)
+}
+
+// finishJob keeps the event of a Job that failed for good in the
+// dead-letter store.
+func (s *Server) finishJob(job *Job) {
+	// failed drops are kept in the failed directory of the watched one
+	// instead, with their file
+	if job.failed() && job.req.Header.Get(TRIGGER_HEADER) != "watch" {
+		if err := s.deadLetter(job); err != nil {
+			log.Printf("could not keep dead letter of job %s: %v\n", job.ID, err)
+		}
+	}
+}
+
+// deadLetter writes the event of a failed Job to the dead-letter store.
+func (s *Server) deadLetter(job *Job) error {
+	if s.deadLetters == nil {
+		return nil
+	}
+
+	body, err := job.input.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	trigger := job.req.Header.Get(TRIGGER_HEADER)
+	if trigger == "" {
+		trigger = "async"
+	}
+	// credentials are not written to disk
+	header := job.req.Header.Clone()
+	for _, key := range credentialHeaders {
+		header.Del(key)
+	}
+	header.Del(REQUEST_ID_HEADER)
+
+	reason := job.Error
+	if reason == "" {
+		reason = string(job.Result)
+	}
+	return s.deadLetters.Put(&deadletter.Letter{
+		ID:       job.ID,
+		Lambda:   job.Lambda,
+		Trigger:  trigger,
+		Method:   job.req.Method,
+		Path:     job.req.URL.RequestURI(),
+		Header:   header,
+		Body:     data,
+		Attempts: job.Attempts,
+		Code:     job.Code,
+		Error:    reason,
+		Failed:   time.Now(),
+	})
+}
+
+// deadLetterErr translates an error from the dead-letter store into an
+// httpErr.
+func deadLetterErr(err error) *httpErr {
+	if err == deadletter.ErrNotFound {
+		return newHttpErr(err.Error(), http.StatusNotFound)
+	}
+	return newHttpErr(err.Error(), http.StatusInternalServerError)
+}
+
+// redrive queues the event of a dead letter as a new asynchronous job, and
+// removes the letter.
+func (s *Server) redrive(w http.ResponseWriter, r *http.Request, letter *deadletter.Letter) *httpErr {
+	req, err := http.NewRequest(letter.Method, letter.Path, nil)
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	copyHeaders(req.Header, letter.Header)
+	req.Header.Set(REQUEST_ID_HEADER, r.Header.Get(REQUEST_ID_HEADER))
+
+	input := &payload{data: letter.Body, size: int64(len(letter.Body))}
+	job, err := s.jobs.Submit(letter.Lambda, req, input)
+	if err == ErrQueueFull || err == ErrQueueClosed {
+		return newHttpErr(
+			err.Error(),
+			http.StatusServiceUnavailable)
+	} else if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	if err := s.deadLetters.Delete(letter.ID); err != nil {
+		log.Printf("could not remove dead letter %s: %v\n", letter.ID, err)
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return writeJson(w, job.toJson())
+}
+
+func (s *Server) DeadLettersErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	if herr := s.authenticateAdmin(r); herr != nil {
+		return herr
+	}
+
+	setRequestId(w, r)
+
+	if s.deadLetters == nil {
+		return newHttpErr(
+			"Dead-letter store is disabled",
+			http.StatusNotFound)
+	}
+
+	// components represent deadletters[0]/<id>[1]/<op>[2]
+	urlParts := getUrlComponents(r)
+
+	if len(urlParts) < 2 {
+		if r.Method != "GET" {
+			return newHttpErr(
+				"Method not allowed",
+				http.StatusMethodNotAllowed)
+		}
+		letters, err := s.deadLetters.List(r.URL.Query().Get("lambda"))
+		if err != nil {
+			return deadLetterErr(err)
+		}
+		for _, letter := range letters {
+			letter.Body = nil
+		}
+		return writeJson(w, letters)
+	}
+
+	letter, err := s.deadLetters.Get(urlParts[1])
+	if err != nil {
+		return deadLetterErr(err)
+	}
+
+	if len(urlParts) == 2 {
+		switch r.Method {
+		case "GET":
+			return writeJson(w, letter)
+		case "DELETE":
+			if err := s.deadLetters.Delete(letter.ID); err != nil {
+				return deadLetterErr(err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		default:
+			return newHttpErr(
+				"Method not allowed",
+				http.StatusMethodNotAllowed)
+		}
+	}
+
+	if r.Method != "POST" {
+		return newHttpErr(
+			"Method not allowed",
+			http.StatusMethodNotAllowed)
+	}
+	if urlParts[2] != "redrive" {
+		return newHttpErr(
+			"Unknown operation "+urlParts[2],
+			http.StatusNotFound)
+	}
+	return s.redrive(w, r, letter)
+}
+
+// DeadLetters lists, inspects, redrives (as asynchronous jobs) and deletes
+// the events that asynchronous and timed invocations failed to process:
+//
+// curl localhost:8080/deadletters[?lambda=<lambda-name>]
+// curl localhost:8080/deadletters/<id>
+// curl -X POST localhost:8080/deadletters/<id>/redrive
+// curl -X DELETE localhost:8080/deadletters/<id>
+func (s *Server) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.DeadLettersErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
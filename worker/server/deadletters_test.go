@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/deadletter"
+)
+
+func TestRetryDelay(t *testing.T) {
+	policy := config.RetryConfig{Backoff: 1, Max_backoff: 5}
+	for retry, expected := range []float64{1, 2, 4, 5, 5} {
+		if delay := retryDelay(policy, retry+1); delay != time.Duration(expected*float64(time.Second)) {
+			t.Fatalf("Expected %vs before retry %d, got %v", expected, retry+1, delay)
+		}
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	var mutex sync.Mutex
+	failures := 2 // of each event, before it succeeds
+	attempts := map[string]int{}
+
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[string(body)] += 1
+		if attempts[string(body)] <= failures {
+			http.Error(w, "not yet", http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	var err error
+	s.deadLetters, err = deadletter.Open(s.config.Dead_letter_dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs = NewJobQueue(1, 10, time.Minute, s.runAsync, s.finishJob)
+	writeLambdaConfig(t, sm, "flaky", `{"retry": {"max_retries": 2, "backoff": 0.01}}`)
+	writeLambdaConfig(t, sm, "flakier", `{"retry": {"max_retries": 1, "backoff": 0.01}}`)
+
+	// waits for an asynchronous invocation to finish
+	invoke := func(lambda string, event string) *Job {
+		r := httptest.NewRequest("POST", "/invokeAsync/"+lambda, strings.NewReader(event))
+		r.Header.Set("X-Custom", "kept")
+		r.Header.Set(API_KEY_HEADER, "s3cret")
+		w := httptest.NewRecorder()
+		s.InvokeAsync(w, r)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+		id := strings.TrimPrefix(w.Header().Get("Location"), "/jobs/")
+		return waitJob(t, s, id)
+	}
+
+	if job := invoke("flaky", "a"); job.Status != JobDone || job.Attempts != 3 {
+		t.Fatalf("Expected success on the third attempt, got %+v", job)
+	}
+	job := invoke("flakier", "b")
+	if job.Status != JobFailed || job.Attempts != 2 {
+		t.Fatalf("Expected failure after 2 attempts, got %+v", job)
+	}
+
+	r := httptest.NewRequest("GET", "/deadletters?lambda=flakier", nil)
+	w := httptest.NewRecorder()
+	s.DeadLetters(w, r)
+	var letters []deadletter.Letter
+	if err := json.Unmarshal(w.Body.Bytes(), &letters); err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].ID != job.ID || letters[0].Trigger != "async" || letters[0].Attempts != 2 {
+		t.Fatalf("Expected a dead letter for job %s, got %+v", job.ID, letters)
+	}
+
+	r = httptest.NewRequest("GET", "/deadletters/"+job.ID, nil)
+	w = httptest.NewRecorder()
+	s.DeadLetters(w, r)
+	var letter deadletter.Letter
+	if err := json.Unmarshal(w.Body.Bytes(), &letter); err != nil {
+		t.Fatal(err)
+	}
+	if string(letter.Body) != "b" || letter.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected the event and status, got %+v", letter)
+	}
+	if letter.Header.Get("X-Custom") != "kept" || letter.Header.Get(API_KEY_HEADER) != "" {
+		t.Fatalf("Expected the headers without credentials, got %v", letter.Header)
+	}
+
+	// the third attempt succeeds
+	r = httptest.NewRequest("POST", "/deadletters/"+job.ID+"/redrive", nil)
+	w = httptest.NewRecorder()
+	s.DeadLetters(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/jobs/")
+	if redriven := waitJob(t, s, id); redriven.Status != JobDone || string(redriven.Result) != "b" {
+		t.Fatalf("Expected the redriven job to succeed, got %+v", redriven)
+	}
+	if _, err := s.deadLetters.Get(job.ID); err != deadletter.ErrNotFound {
+		t.Fatalf("Expected the dead letter to be removed, got %v", err)
+	}
+}
+
+// waitJob waits for a job to finish.
+func waitJob(t *testing.T, s *Server, id string) *Job {
+	for i := 0; i < 200; i++ {
+		if job := s.jobs.Get(id); job != nil && !job.Finished.IsZero() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return nil
+}
@@ -0,0 +1,378 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/watch"
+)
+
+// DROP_DIR is where files dropped for a lambda are processed, in its
+// staging directory (shared as /host/drop in the sandbox)
+const DROP_DIR = "drop"
+
+// Where files end up, in the watched directory, once processed
+const (
+	DROP_DONE_DIR   = "done"
+	DROP_FAILED_DIR = "failed"
+)
+
+// dropTarget is the lambda triggered by the files of a watched directory.
+type dropTarget struct {
+	lambda  string
+	pattern string
+}
+
+// dropFile is a file that landed in a watched directory.
+type dropFile struct {
+	dir  string
+	name string
+}
+
+// dropEvent is the event passed to a lambda for a file.
+type dropEvent struct {
+	File     string    `json:"file"` // path in the sandbox
+	Name     string    `json:"name"`
+	Dir      string    `json:"dir"` // watched directory, on the worker
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// dropBox watches directories, and processes the files landing in them on a
+// bounded pool of workers.  Files not processed yet stay where they landed,
+// and are found again when the worker restarts (as are those being
+// processed, see recoverDrops).
+type dropBox struct {
+	mutex   sync.Mutex
+	watcher *watch.Watcher // nil if inotify is unavailable
+	targets map[string]dropTarget
+	queue   chan dropFile
+	stop    chan bool
+	workers sync.WaitGroup
+	process func(target dropTarget, file dropFile)
+}
+
+// newDropBox creates a dropBox watching no directories, whose workers call
+// process for each file.
+func newDropBox(workers int, queueLen int, process func(target dropTarget, file dropFile)) *dropBox {
+	d := &dropBox{
+		targets: make(map[string]dropTarget),
+		queue:   make(chan dropFile, queueLen),
+		stop:    make(chan bool),
+		process: process,
+	}
+
+	watcher, err := watch.NewWatcher(d.enqueue)
+	if err != nil {
+		log.Printf("Directories will not be watched: %v\n", err)
+	}
+	d.watcher = watcher
+
+	d.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.worker()
+	}
+
+	return d
+}
+
+// dropTargets returns the watched directories of the given lambda configs.
+func (s *Server) dropTargets(lconfs map[string]*config.LambdaConfig) map[string]dropTarget {
+	targets := make(map[string]dropTarget)
+	for name, lconf := range lconfs {
+		if lconf.Watch == nil {
+			continue
+		}
+
+		dir, err := s.watchDir(name, lconf.Watch.Dir)
+		if err != nil {
+			log.Printf("not watching a directory for %s: %v\n", name, err)
+			continue
+		}
+
+		if other, ok := targets[dir]; ok {
+			log.Printf("%s is watched for both %s and %s, ignoring %s\n", dir, other.lambda, name, name)
+			continue
+		}
+		targets[dir] = dropTarget{lambda: name, pattern: lconf.Watch.Pattern}
+	}
+	return targets
+}
+
+// watchDir returns the directory a lambda's config asks to watch, which
+// must be within the worker's drop_dir or, if absolute, within one of the
+// worker's watch_dirs.
+func (s *Server) watchDir(lambda string, dir string) (string, error) {
+	if dir == "" {
+		dir = lambda
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.config.Drop_dir, dir)
+		if !withinDir(dir, s.config.Drop_dir) || dir == filepath.Clean(s.config.Drop_dir) {
+			return "", fmt.Errorf("%s is not within the drop_dir", dir)
+		}
+		return dir, nil
+	}
+
+	dir = filepath.Clean(dir)
+	for _, allowed := range s.config.Watch_dirs {
+		if withinDir(dir, allowed) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not within the watch_dirs of the worker", dir)
+}
+
+// withinDir tells whether a path is dir or within it.
+func withinDir(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// recoverDrops moves the files that were being processed for the given
+// targets when the worker stopped back to their watched directories, to be
+// processed again once watched.
+func (s *Server) recoverDrops(targets map[string]dropTarget) {
+	for dir, target := range targets {
+		proc_dir := filepath.Join(s.handlers.StagingDir(target.lambda), DROP_DIR)
+		files, err := ioutil.ReadDir(proc_dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Printf("could not recover files of %s: %v\n", target.lambda, err)
+			continue
+		}
+
+		for _, file := range files {
+			if !file.Mode().IsRegular() {
+				continue
+			}
+
+			// files are processed as <id>-<name>
+			name := file.Name()
+			if parts := strings.SplitN(name, "-", 2); len(parts) == 2 {
+				name = parts[1]
+			}
+			dest := filepath.Join(dir, name)
+			if _, err := os.Stat(dest); err == nil {
+				dest = filepath.Join(dir, file.Name())
+			}
+
+			src := filepath.Join(proc_dir, file.Name())
+			log.Printf("Recover %s to %s\n", src, dest)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Printf("could not recover %s: %v\n", src, err)
+			} else if err := moveFile(src, dest); err != nil {
+				log.Printf("could not recover %s: %v\n", src, err)
+			}
+		}
+	}
+}
+
+// Update replaces the watched directories.
+func (d *dropBox) Update(targets map[string]dropTarget) {
+	if d.watcher == nil {
+		return
+	}
+
+	// the watcher may report files right away, so the mutex
+	// cannot be held while adding directories
+	d.mutex.Lock()
+	d.targets = targets
+	d.mutex.Unlock()
+
+	for _, dir := range d.watcher.Dirs() {
+		if _, ok := targets[dir]; !ok {
+			log.Printf("Stop watching %s\n", dir)
+			if err := d.watcher.Remove(dir); err != nil {
+				log.Printf("%v\n", err)
+			}
+		}
+	}
+	for dir, target := range targets {
+		if err := d.watcher.Add(dir); err != nil {
+			log.Printf("could not watch %s for %s: %v\n", dir, target.lambda, err)
+		}
+	}
+}
+
+// enqueue queues a file for the workers, unless the dropBox is closed.
+func (d *dropBox) enqueue(dir string, name string) {
+	select {
+	case d.queue <- dropFile{dir: dir, name: name}:
+	case <-d.stop:
+	}
+}
+
+func (d *dropBox) worker() {
+	defer d.workers.Done()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case file := <-d.queue:
+			d.mutex.Lock()
+			target, ok := d.targets[file.dir]
+			d.mutex.Unlock()
+
+			if !ok {
+				continue
+			}
+			if target.pattern != "" {
+				if match, _ := filepath.Match(target.pattern, file.name); !match {
+					continue
+				}
+			}
+			d.process(target, file)
+		}
+	}
+}
+
+// Close stops watching directories, and waits for the files being processed,
+// or for ctx to be done.
+func (d *dropBox) Close(ctx context.Context) error {
+	close(d.stop)
+	if d.watcher != nil {
+		if err := d.watcher.Close(); err != nil {
+			log.Printf("could not close watcher: %v\n", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processDrop moves a dropped file to the staging directory of a lambda,
+// invokes the lambda with it, and moves it to the done or failed directory
+// next to where it landed.
+func (s *Server) processDrop(target dropTarget, file dropFile) {
+	src := filepath.Join(file.dir, file.name)
+	info, err := os.Stat(src)
+	if os.IsNotExist(err) {
+		// already processed (files may be reported twice)
+		return
+	} else if err != nil {
+		log.Printf("could not process %s: %v\n", src, err)
+		return
+	} else if !info.Mode().IsRegular() {
+		return
+	}
+
+	id, err := newId()
+	if err != nil {
+		log.Printf("could not process %s: %v\n", src, err)
+		return
+	}
+	proc_dir := filepath.Join(s.handlers.StagingDir(target.lambda), DROP_DIR)
+	if err := os.MkdirAll(proc_dir, 0755); err != nil {
+		log.Printf("could not process %s: %v\n", src, err)
+		return
+	}
+	proc := filepath.Join(proc_dir, id+"-"+file.name)
+	if err := moveFile(src, proc); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("could not process %s: %v\n", src, err)
+		}
+		return
+	}
+
+	event, err := json.Marshal(dropEvent{
+		File:     path.Join("/host", DROP_DIR, filepath.Base(proc)),
+		Name:     file.name,
+		Dir:      file.dir,
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+	})
+	if err != nil {
+		log.Printf("could not process %s: %v\n", src, err)
+		return
+	}
+
+	log.Printf("Invoke %s on %s\n", target.lambda, src)
+	code, result, err := s.invokeTriggered(target.lambda, "watch", event, proc)
+
+	failed := err != nil || code >= 400
+	dest_dir := filepath.Join(file.dir, DROP_DONE_DIR)
+	if failed {
+		dest_dir = filepath.Join(file.dir, DROP_FAILED_DIR)
+	}
+	dest := filepath.Join(dest_dir, file.name)
+	if _, err := os.Stat(dest); err == nil {
+		dest += "." + id
+	}
+
+	moveErr := os.MkdirAll(dest_dir, 0755)
+	if moveErr == nil {
+		moveErr = moveFile(proc, dest)
+	}
+	if moveErr != nil {
+		log.Printf("could not move %s to %s: %v\n", proc, dest_dir, moveErr)
+		return
+	}
+
+	// say why, next to the failed file
+	if failed {
+		reason := result
+		if err != nil {
+			reason = []byte(err.Error())
+		}
+		if err := ioutil.WriteFile(dest+".error", reason, 0644); err != nil {
+			log.Printf("could not save error of %s: %v\n", dest, err)
+		}
+	}
+}
+
+// moveFile renames a file, or copies and removes it if the destination is
+// on another file system.
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if lerr, ok := err.(*os.LinkError); !ok || lerr.Err != syscall.EXDEV {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrops(t *testing.T) {
+	// succeeds on files containing "ok", reading them through the
+	// path in the sandbox (i.e., the worker_dir here)
+	var s *Server
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event dropEvent
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &event)
+		if r.Header.Get(TRIGGER_HEADER) != "watch" {
+			http.Error(w, "not triggered by watch", http.StatusBadRequest)
+			return
+		}
+
+		path := filepath.Join(s.handlers.StagingDir("upper"), strings.TrimPrefix(event.File, "/host/"))
+		data, err := ioutil.ReadFile(path)
+		if err != nil || string(data) != "ok" {
+			http.Error(w, "bad file "+event.Name, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("done"))
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "upper", `{"watch": {"pattern": "*.txt"}}`)
+	writeLambdaConfig(t, sm, "idle", `{}`)
+
+	s.drops = newDropBox(2, 10, s.processDrop)
+	defer s.drops.Close(context.Background())
+	if s.drops.watcher == nil {
+		t.Skip("inotify is not available")
+	}
+
+	lconfs, err := s.lambdaConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := s.dropTargets(lconfs)
+	dir := filepath.Join(s.config.Drop_dir, "upper")
+	if len(targets) != 1 || targets[dir].lambda != "upper" {
+		t.Fatalf("Expected %s to be watched for upper, got %+v", dir, targets)
+	}
+
+	// one file is there before the watch starts
+	os.MkdirAll(dir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("ok"), 0644)
+	s.drops.Update(targets)
+	ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("bad"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "c.bin"), []byte("ok"), 0644)
+
+	expected := []string{
+		filepath.Join(dir, DROP_DONE_DIR, "a.txt"),
+		filepath.Join(dir, DROP_FAILED_DIR, "b.txt"),
+		filepath.Join(dir, DROP_FAILED_DIR, "b.txt.error"),
+	}
+	for _, path := range expected {
+		for i := 0; ; i++ {
+			if _, err := os.Stat(path); err == nil {
+				break
+			}
+			if i == 500 {
+				t.Fatalf("%s does not exist", path)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// files not matching the pattern are left alone
+	if _, err := os.Stat(filepath.Join(dir, "c.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if reason, _ := ioutil.ReadFile(expected[2]); !strings.Contains(string(reason), "bad file b.txt") {
+		t.Fatalf("Unexpected error %q", reason)
+	}
+}
+
+func TestDropTargetsOutsideDropDir(t *testing.T) {
+	s, sm, cleanup := newFakeServer(t, http.NotFoundHandler())
+	defer cleanup()
+	allowed := filepath.Join(filepath.Dir(s.config.Worker_dir), "incoming")
+	s.config.Watch_dirs = []string{allowed}
+
+	writeLambdaConfig(t, sm, "up", `{"watch": {"dir": "../secrets"}}`)
+	writeLambdaConfig(t, sm, "root", `{"watch": {"dir": "."}}`)
+	writeLambdaConfig(t, sm, "abs", `{"watch": {"dir": "/etc"}}`)
+	writeLambdaConfig(t, sm, "escape", `{"watch": {"dir": "`+allowed+`/../etc"}}`)
+	writeLambdaConfig(t, sm, "ok", `{"watch": {"dir": "`+allowed+`/images"}}`)
+
+	lconfs, err := s.lambdaConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := s.dropTargets(lconfs)
+	dir := filepath.Join(allowed, "images")
+	if len(targets) != 1 || targets[dir].lambda != "ok" {
+		t.Fatalf("Expected only %s to be watched, got %+v", dir, targets)
+	}
+}
+
+func TestRecoverDrops(t *testing.T) {
+	s, _, cleanup := newFakeServer(t, http.NotFoundHandler())
+	defer cleanup()
+
+	// a worker died while processing a.txt, and b.txt landed since
+	dir := filepath.Join(s.config.Drop_dir, "f")
+	proc_dir := filepath.Join(s.handlers.StagingDir("f"), DROP_DIR)
+	os.MkdirAll(dir, 0755)
+	os.MkdirAll(proc_dir, 0755)
+	ioutil.WriteFile(filepath.Join(proc_dir, "0123abcd-a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(proc_dir, "4567abcd-b.txt"), []byte("b"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("new b"), 0644)
+
+	s.recoverDrops(map[string]dropTarget{dir: {lambda: "f"}})
+	for name, data := range map[string]string{"a.txt": "a", "b.txt": "new b", "4567abcd-b.txt": "b"} {
+		if got, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(got) != data {
+			t.Fatalf("Expected %s to hold %q, got %q (%v)", name, data, got, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(proc_dir); len(files) != 0 {
+		t.Fatalf("Expected no files left in %s, got %d", proc_dir, len(files))
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/handler/state"
+	"github.com/open-lambda/open-lambda/worker/sandbox"
+	sbmanager "github.com/open-lambda/open-lambda/worker/sandbox-manager"
+	"github.com/open-lambda/open-lambda/worker/versions"
+)
+
+// fakeSandbox is a Sandbox served by an httptest.Server, for tests that do
+// not need Docker.
+type fakeSandbox struct {
+	mutex    sync.Mutex
+	srv      *httptest.Server
+	starts   int
+	pauses   int
+	unpauses int
+	removed  bool
+	dir      string
+	opts     *sbmanager.SandboxOpts
+}
+
+func (s *fakeSandbox) count(n *int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	*n += 1
+	return nil
+}
+
+func (s *fakeSandbox) Start() error   { return s.count(&s.starts) }
+func (s *fakeSandbox) Stop() error    { return nil }
+func (s *fakeSandbox) Pause() error   { return s.count(&s.pauses) }
+func (s *fakeSandbox) Unpause() error { return s.count(&s.unpauses) }
+func (s *fakeSandbox) ID() string     { return s.srv.URL }
+
+func (s *fakeSandbox) Remove() error {
+	s.mutex.Lock()
+	s.removed = true
+	s.mutex.Unlock()
+	s.srv.Close()
+	return nil
+}
+
+func (s *fakeSandbox) Logs() (string, error) {
+	return "", nil
+}
+
+func (s *fakeSandbox) State() (state.HandlerState, error) {
+	return state.Running, nil
+}
+
+func (s *fakeSandbox) Channel() (*sandbox.SandboxChannel, error) {
+	return &sandbox.SandboxChannel{Url: s.srv.URL}, nil
+}
+
+// fakeManager creates fakeSandboxes that serve requests with a test
+// handler.  The code of lambda <name> is in <code_dir>/<name>.
+type fakeManager struct {
+	mutex     sync.Mutex
+	lambda    http.Handler
+	code_dir  string
+	sandboxes []*fakeSandbox
+}
+
+func (m *fakeManager) Create(name string, sandbox_dir string, opts *sbmanager.SandboxOpts) (sandbox.Sandbox, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sb := &fakeSandbox{srv: httptest.NewServer(m.lambda), dir: sandbox_dir, opts: opts}
+	m.sandboxes = append(m.sandboxes, sb)
+	return sb, nil
+}
+
+func (m *fakeManager) Pull(name string) error {
+	return os.MkdirAll(m.CodeDir(name), 0700)
+}
+
+func (m *fakeManager) CodeDir(name string) string {
+	return filepath.Join(m.code_dir, name)
+}
+
+// newFakeServer creates a Server whose lambdas run in fakeSandboxes.  The
+// returned function cleans up.
+func newFakeServer(t *testing.T, lambda http.Handler) (*Server, *fakeManager, func()) {
+	dir, err := ioutil.TempDir("", "ol-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.Config{
+		Registry:   "local",
+		Reg_dir:    filepath.Join(dir, "registry"),
+		Worker_dir: filepath.Join(dir, "worker"),
+	}
+	if err := conf.Defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := &fakeManager{lambda: lambda, code_dir: conf.Reg_dir}
+	opts := handler.HandlerSetOpts{
+		Sm:     sm,
+		Config: conf,
+		Lru:    handler.NewHandlerLRU(100),
+	}
+	aliases, err := versions.LoadAliases(conf.Alias_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		sbmanager: sm,
+		config:    conf,
+		handlers:  handler.NewHandlerSet(opts),
+		aliases:   aliases,
+	}
+
+	cleanup := func() {
+		s.handlers.Cleanup()
+		os.RemoveAll(dir)
+	}
+	return s, sm, cleanup
+}
+
+// writeLambdaConfig writes the lambda-config.json of a lambda.
+func writeLambdaConfig(t *testing.T, sm *fakeManager, name string, lconf string) {
+	if err := os.MkdirAll(sm.CodeDir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(sm.CodeDir(name), config.LambdaConfigFile)
+	if err := ioutil.WriteFile(path, []byte(lconf), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
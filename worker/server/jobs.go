@@ -0,0 +1,486 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/metrics"
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// the reaper checks for expired Jobs every tenth of the TTL, but no more
+// often than this
+const JOB_REAP_INTERVAL_MIN = 100 * time.Millisecond
+
+// ErrQueueFull is returned when submitting to a JobQueue at capacity.
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrQueueClosed is returned when submitting to a JobQueue being drained.
+var ErrQueueClosed = errors.New("job queue is closed")
+
+// Job is one asynchronous invocation of a lambda.
+type Job struct {
+	ID       string
+	Lambda   string
+	Status   JobStatus
+	Code     int // status code returned by the sandbox
+	Attempts int
+	Result   []byte
+	Error    string
+	Created  time.Time
+	Finished time.Time
+	RetryAt  time.Time // of the next attempt, if queued for a retry
+
+	req   *http.Request
+	input *payload
+}
+
+// jobJson is the representation of a Job returned by /jobs/<id>.
+type jobJson struct {
+	ID       string          `json:"id"`
+	Lambda   string          `json:"lambda"`
+	Status   JobStatus       `json:"status"`
+	Code     int             `json:"code,omitempty"`
+	Attempts int             `json:"attempts,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	RetryAt  *time.Time      `json:"retry_at,omitempty"`
+}
+
+// JobQueue runs Jobs on a bounded pool of workers and remembers finished
+// Jobs for a fixed time.  Jobs to be retried wait off the queue, without
+// holding a worker.
+type JobQueue struct {
+	mutex   sync.Mutex
+	jobs    map[string]*Job
+	queue   chan *Job
+	retries map[*Job]*time.Timer // Jobs waiting for their RetryAt
+	closed  bool
+	stop    chan bool // closed by Drain, stopping the reaper
+	workers sync.WaitGroup
+	ttl     time.Duration
+	run     func(job *Job)
+	done    func(job *Job)
+}
+
+// NewJobQueue creates a JobQueue that holds up to queueLen pending Jobs and
+// runs them with the given number of workers.  run must set the outcome
+// fields (Code, Result and Error) of the Job it is given, and may set its
+// RetryAt to have it queued again then.  done (if not nil) is called once
+// a Job has run for the last time, including Jobs whose retry is given up
+// as the JobQueue is drained.
+func NewJobQueue(workers int, queueLen int, ttl time.Duration, run func(job *Job), done func(job *Job)) *JobQueue {
+	q := &JobQueue{
+		jobs:    make(map[string]*Job),
+		queue:   make(chan *Job, queueLen),
+		retries: make(map[*Job]*time.Timer),
+		stop:    make(chan bool),
+		ttl:     ttl,
+		run:     run,
+		done:    done,
+	}
+
+	q.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	go q.reaper()
+
+	return q
+}
+
+// Submit queues a new Job for the named lambda and returns it.  The Job
+// keeps a copy of the method, URL and headers of r, whose body is passed as
+// input instead.
+func (q *JobQueue) Submit(lambda string, r *http.Request, input *payload) (*Job, error) {
+	id, err := newId()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:      id,
+		Lambda:  lambda,
+		Status:  JobQueued,
+		Created: time.Now(),
+		req:     detach(r),
+		input:   input,
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	select {
+	case q.queue <- job:
+	default:
+		return nil, ErrQueueFull
+	}
+	q.jobs[id] = job
+
+	return job, nil
+}
+
+// Get returns a copy of the Job with the given ID, or nil if it does not
+// exist or has expired.
+func (q *JobQueue) Get(id string) *Job {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job := q.jobs[id]
+	if job == nil {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+// Len returns the number of Jobs waiting for a worker.
+func (q *JobQueue) Len() int {
+	return len(q.queue)
+}
+
+// Drain stops accepting Jobs and waits until the queued and running Jobs
+// have finished, or ctx is done.  Jobs waiting for a retry are given up,
+// and finish with the outcome of their last attempt.
+func (q *JobQueue) Drain(ctx context.Context) error {
+	givenUp := []*Job{}
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		for job, timer := range q.retries {
+			timer.Stop()
+			givenUp = append(givenUp, job)
+		}
+		q.retries = make(map[*Job]*time.Timer)
+		close(q.queue)
+		close(q.stop)
+	}
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		for _, job := range givenUp {
+			q.finish(job)
+		}
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *JobQueue) worker() {
+	defer q.workers.Done()
+
+	for job := range q.queue {
+		q.mutex.Lock()
+		job.Status = JobRunning
+		q.mutex.Unlock()
+
+		// run works on a private copy, so pollers never see a
+		// partially filled-in result
+		result := *job
+		result.RetryAt = time.Time{}
+		q.run(&result)
+
+		q.mutex.Lock()
+		job.Code = result.Code
+		job.Attempts = result.Attempts
+		job.Result = result.Result
+		job.Error = result.Error
+		job.RetryAt = time.Time{}
+		if !result.RetryAt.IsZero() && !q.closed {
+			job.Status = JobQueued
+			job.RetryAt = result.RetryAt
+			q.retryLater(job, time.Until(job.RetryAt))
+			q.mutex.Unlock()
+			continue
+		}
+		q.mutex.Unlock()
+
+		q.finish(job)
+	}
+}
+
+// retryLater queues a Job again after the given delay.  The caller must
+// hold the JobQueue's mutex.
+func (q *JobQueue) retryLater(job *Job, delay time.Duration) {
+	q.retries[job] = time.AfterFunc(delay, func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+
+		// given up by Drain?
+		if _, ok := q.retries[job]; !ok {
+			return
+		}
+
+		select {
+		case q.queue <- job:
+			delete(q.retries, job)
+		default:
+			// no room yet
+			q.retryLater(job, time.Second)
+		}
+	})
+}
+
+// finish calls done for a Job that has run for the last time, and records
+// that it is finished.
+func (q *JobQueue) finish(job *Job) {
+	if q.done != nil {
+		q.done(job)
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if job.failed() {
+		job.Status = JobFailed
+	} else {
+		job.Status = JobDone
+	}
+	job.Finished = time.Now()
+	job.RetryAt = time.Time{}
+	job.req = nil
+	job.input.Remove()
+	job.input = nil
+}
+
+// reaper forgets finished Jobs once they are older than the TTL, until the
+// JobQueue is drained.
+func (q *JobQueue) reaper() {
+	interval := q.ttl / 10
+	if interval < JOB_REAP_INTERVAL_MIN {
+		interval = JOB_REAP_INTERVAL_MIN
+	}
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-time.After(interval):
+		}
+
+		q.mutex.Lock()
+		for id, job := range q.jobs {
+			if !job.Finished.IsZero() && time.Since(job.Finished) > q.ttl {
+				delete(q.jobs, id)
+			}
+		}
+		q.mutex.Unlock()
+	}
+}
+
+// detach copies the method, URL and headers of a request, for a Job to run
+// after the client (and its connection) may be gone.
+func detach(r *http.Request) *http.Request {
+	url := *r.URL
+	return &http.Request{
+		Method: r.Method,
+		URL:    &url,
+		Host:   r.Host,
+		Header: r.Header.Clone(),
+	}
+}
+
+// newId returns a random ID, for Jobs and requests.
+func newId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (job *Job) toJson() jobJson {
+	j := jobJson{
+		ID:       job.ID,
+		Lambda:   job.Lambda,
+		Status:   job.Status,
+		Code:     job.Code,
+		Attempts: job.Attempts,
+		Error:    job.Error,
+		Created:  job.Created,
+	}
+
+	j.Result = jsonResult(job.Result)
+
+	if !job.Finished.IsZero() {
+		finished := job.Finished
+		j.Finished = &finished
+	}
+	if !job.RetryAt.IsZero() {
+		retryAt := job.RetryAt
+		j.RetryAt = &retryAt
+	}
+
+	return j
+}
+
+// jsonResult returns the body of a sandbox response for embedding in JSON:
+// as is if it is JSON, or else as a string.
+func jsonResult(body []byte) json.RawMessage {
+	if body == nil {
+		return nil
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	if s, err := json.Marshal(string(body)); err == nil {
+		return json.RawMessage(s)
+	}
+	return nil
+}
+
+// failed tells whether a finished Job failed, in the worker or the sandbox.
+func (job *Job) failed() bool {
+	return job.Error != "" || job.Code >= 500
+}
+
+// runAttempt forwards the input of an asynchronous Job to the sandbox of its
+// lambda, just as RunLambda would.
+func (s *Server) runAttempt(job *Job) {
+	job.Code = 0
+	job.Result = nil
+	job.Error = ""
+
+	t0 := time.Now()
+	phases := handler.NewPhases()
+	entry := newAccessEntry(job.req, job.Lambda)
+	entry.Async = true
+	entry.BytesIn = job.input.size
+	tr := s.startTrace(job.req, job.Lambda)
+	defer func() {
+		metrics.ObserveInvocation(job.Lambda, job.Code, time.Since(t0))
+		entry.Error = job.Error
+		entry.BytesOut = int64(len(job.Result))
+		s.logAccess(entry, job.Code, t0, phases)
+		s.endTrace(tr, job.Code, job.Error, phases)
+	}()
+
+	handler := s.handlers.Get(job.Lambda)
+	w2, err := s.ForwardToSandbox(handler, job.req, job.input, phases)
+	if err != nil {
+		job.Code = err.code
+		job.Error = err.msg
+		return
+	}
+
+	if err := s.limitResponse(handler, w2); err != nil {
+		w2.Body.Close()
+		job.Code = err.code
+		job.Error = err.msg
+		return
+	}
+
+	wbody, err := readResponse(w2)
+	if err != nil {
+		job.Code = err.code
+		job.Error = err.msg
+		return
+	}
+
+	job.Code = w2.StatusCode
+	job.Result = wbody
+}
+
+func (s *Server) InvokeAsyncErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	setRequestId(w, r)
+
+	// components represent invokeAsync[0]/<name_of_sandbox>[1]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of image to run required",
+			http.StatusBadRequest)
+	}
+	img, _, herr := s.resolve(urlParts[1])
+	if herr != nil {
+		return herr
+	}
+
+	_, input, herr := s.readInput(r, img, nil)
+	if herr != nil {
+		return herr
+	}
+
+	job, err := s.jobs.Submit(img, r, input)
+	if err != nil {
+		input.Remove()
+	}
+	if err == ErrQueueFull || err == ErrQueueClosed {
+		return newHttpErr(
+			err.Error(),
+			http.StatusServiceUnavailable)
+	} else if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return writeJson(w, job.toJson())
+}
+
+// InvokeAsync queues a lambda invocation and returns its job ID right away:
+//
+// curl -X POST localhost:8080/invokeAsync/<lambda-name> -d '{}'
+func (s *Server) InvokeAsync(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.InvokeAsyncErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
+
+// Jobs reports the status and, once finished, the result of a job:
+//
+// curl localhost:8080/jobs/<job-id>
+func (s *Server) Jobs(w http.ResponseWriter, r *http.Request) {
+	// components represent jobs[0]/<job_id>[1]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		http.Error(w, "Job ID required", http.StatusBadRequest)
+		return
+	}
+
+	job := s.jobs.Get(urlParts[1])
+	if job == nil {
+		http.Error(w, "No job with ID "+urlParts[1], http.StatusNotFound)
+		return
+	}
+
+	if err := writeJson(w, job.toJson()); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+	}
+}
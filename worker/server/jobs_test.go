@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPayload returns the payload of a small request body.
+func testPayload() *payload {
+	return &payload{data: []byte("{}"), size: 2}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	// no workers, so jobs stay queued
+	q := NewJobQueue(0, 1, time.Minute, func(job *Job) {}, nil)
+	defer q.Drain(context.Background())
+
+	r := httptest.NewRequest("POST", "/invokeAsync/f", nil)
+	if _, err := q.Submit("f", r, testPayload()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("f", r, testPayload()); err != ErrQueueFull {
+		t.Fatalf("Expected %v, got %v", ErrQueueFull, err)
+	}
+	if q.Len() != 1 {
+		t.Fatalf("Expected 1 queued job, got %d", q.Len())
+	}
+}
+
+func TestJobQueueDetach(t *testing.T) {
+	run := make(chan *Job, 1)
+	q := NewJobQueue(1, 1, time.Minute, func(job *Job) { run <- job }, nil)
+	defer q.Drain(context.Background())
+
+	r := httptest.NewRequest("POST", "/invokeAsync/f?x=1", strings.NewReader("{}"))
+	r.Header.Set("X-Test", "before")
+	if _, err := q.Submit("f", r, testPayload()); err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-Test", "after")
+	r.URL.RawQuery = "x=2"
+
+	job := <-run
+	if job.req == r || job.req.Body != nil {
+		t.Fatalf("Expected a copy of the request without its body")
+	}
+	if job.req.Method != "POST" || job.req.URL.RequestURI() != "/invokeAsync/f?x=1" || job.req.Header.Get("X-Test") != "before" {
+		t.Fatalf("Unexpected copy of the request: %s %s %v", job.req.Method, job.req.URL, job.req.Header)
+	}
+}
+
+func TestJobQueueExpiry(t *testing.T) {
+	q := NewJobQueue(1, 1, 50*time.Millisecond, func(job *Job) { job.Code = 200 }, nil)
+	defer q.Drain(context.Background())
+
+	r := httptest.NewRequest("POST", "/invokeAsync/f", nil)
+	job, err := q.Submit("f", r, testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// finished jobs are kept for the TTL, then forgotten
+	for tries := 0; ; tries++ {
+		snapshot := q.Get(job.ID)
+		if snapshot == nil {
+			break
+		} else if tries == 300 {
+			t.Fatalf("Expected job to expire, got %+v", snapshot)
+		} else if snapshot.Finished.IsZero() && tries > 50 {
+			t.Fatalf("Expected job to finish, got %+v", snapshot)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobQueueDrain(t *testing.T) {
+	release := make(chan bool)
+	q := NewJobQueue(1, 1, time.Minute, func(job *Job) { <-release }, nil)
+
+	r := httptest.NewRequest("POST", "/invokeAsync/f", nil)
+	job, err := q.Submit("f", r, testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the job runs until released, so draining times out
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if _, err := q.Submit("f", r, testPayload()); err != ErrQueueClosed {
+		t.Fatalf("Expected %v, got %v", ErrQueueClosed, err)
+	}
+
+	close(release)
+	if err := q.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot := q.Get(job.ID); snapshot.Status != JobDone {
+		t.Fatalf("Expected the job to be done, got %+v", snapshot)
+	}
+}
+
+func TestJobQueueRetry(t *testing.T) {
+	var mutex sync.Mutex
+	runs := []string{}
+	run := func(job *Job) {
+		mutex.Lock()
+		runs = append(runs, job.Lambda)
+		mutex.Unlock()
+
+		job.Attempts += 1
+		if job.Lambda == "retried" && job.Attempts == 1 {
+			job.Code = 500
+			job.RetryAt = time.Now().Add(100 * time.Millisecond)
+		} else {
+			job.Code = 200
+		}
+	}
+	finished := make(chan string, 2)
+	q := NewJobQueue(1, 2, time.Minute, run, func(job *Job) { finished <- job.Lambda })
+
+	r := httptest.NewRequest("POST", "/invokeAsync/f", nil)
+	retried, err := q.Submit("retried", r, testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tries := 0; q.Get(retried.ID).RetryAt.IsZero(); tries++ {
+		if tries == 100 {
+			t.Fatalf("Expected a retry to be planned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if job := q.Get(retried.ID); job.Status != JobQueued || job.Code != 500 {
+		t.Fatalf("Expected the job to be queued again, got %+v", job)
+	}
+
+	// the only worker is free for other jobs while the retry waits
+	if _, err := q.Submit("other", r, testPayload()); err != nil {
+		t.Fatal(err)
+	}
+	if first, second := <-finished, <-finished; first != "other" || second != "retried" {
+		t.Fatalf("Expected other to finish before retried, got %s and %s", first, second)
+	}
+	if job := q.Get(retried.ID); job.Status != JobDone || job.Attempts != 2 {
+		t.Fatalf("Expected the retry to succeed, got %+v", job)
+	}
+}
+
+func TestJobQueueDrainRetry(t *testing.T) {
+	run := func(job *Job) {
+		job.Attempts += 1
+		job.Code = 500
+		job.RetryAt = time.Now().Add(time.Hour)
+	}
+	finished := make(chan *Job, 1)
+	q := NewJobQueue(1, 1, time.Minute, run, func(job *Job) { finished <- job })
+
+	r := httptest.NewRequest("POST", "/invokeAsync/f", nil)
+	job, err := q.Submit("f", r, testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tries := 0; q.Get(job.ID).RetryAt.IsZero(); tries++ {
+		if tries == 100 {
+			t.Fatalf("Expected a retry to be planned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the retry is given up, and the job finishes as it failed
+	if err := q.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if done := <-finished; done.ID != job.ID {
+		t.Fatalf("Expected job %s to be done, got %s", job.ID, done.ID)
+	}
+	if snapshot := q.Get(job.ID); snapshot.Status != JobFailed || snapshot.Attempts != 1 {
+		t.Fatalf("Expected the job to fail after 1 attempt, got %+v", snapshot)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+// writeJson marshals v as indented JSON into the response.
+func writeJson(w http.ResponseWriter, v interface{}) *httpErr {
+	wbody, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(wbody); err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// handlerOpErr translates an error from a Handler operation into an httpErr.
+func handlerOpErr(err error) *httpErr {
+	switch err {
+	case nil:
+		return nil
+	case handler.ErrHandlerBusy, handler.ErrHandlerNotPaused:
+		return newHttpErr(err.Error(), http.StatusConflict)
+	default:
+		return newHttpErr(err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) HandlersErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	if herr := s.authenticateAdmin(r); herr != nil {
+		return herr
+	}
+
+	// components represent handlers[0]/<name>[1]/<op>[2]
+	urlParts := getUrlComponents(r)
+
+	if len(urlParts) < 2 {
+		if r.Method != "GET" {
+			return newHttpErr(
+				"Method not allowed",
+				http.StatusMethodNotAllowed)
+		}
+		return writeJson(w, s.handlers.List())
+	}
+
+	name := urlParts[1]
+	h := s.handlers.Lookup(name)
+	if h == nil {
+		return newHttpErr(
+			"No handler named "+name,
+			http.StatusNotFound)
+	}
+
+	if len(urlParts) == 2 {
+		switch r.Method {
+		case "GET":
+			return writeJson(w, h.Info())
+		case "DELETE":
+			if err := handlerOpErr(s.handlers.Delete(name)); err != nil {
+				return err
+			}
+			s.purgeCache(name)
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		default:
+			return newHttpErr(
+				"Method not allowed",
+				http.StatusMethodNotAllowed)
+		}
+	}
+
+	if r.Method != "POST" {
+		return newHttpErr(
+			"Method not allowed",
+			http.StatusMethodNotAllowed)
+	}
+
+	var err error
+	switch urlParts[2] {
+	case "stop":
+		err = h.Stop()
+	case "evict":
+		err = h.Evict()
+	case "pull":
+		err = h.Pull()
+	case "refresh":
+		// unlike pull, running requests finish on the old code
+		h = s.handlers.Refresh(name)
+	default:
+		return newHttpErr(
+			"Unknown operation "+urlParts[2],
+			http.StatusNotFound)
+	}
+	if err := handlerOpErr(err); err != nil {
+		return err
+	}
+
+	// responses of the old code are never served again
+	if urlParts[2] == "pull" || urlParts[2] == "refresh" {
+		s.purgeCache(name)
+	}
+
+	return writeJson(w, h.Info())
+}
+
+// Handlers lists and manages the handlers of the worker:
+//
+// curl localhost:8080/handlers
+// curl localhost:8080/handlers/<lambda-name>
+// curl -X POST localhost:8080/handlers/<lambda-name>/{stop,evict,pull,refresh}
+// curl -X DELETE localhost:8080/handlers/<lambda-name>
+func (s *Server) Handlers(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.HandlersErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
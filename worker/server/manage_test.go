@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+func TestDeleteBusyHandler(t *testing.T) {
+	release := make(chan bool)
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("wait") != "" {
+			<-release
+		}
+		w.Write([]byte("ok"))
+	})
+	s, _, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+
+	run := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		return w
+	}
+	del := func() int {
+		r := httptest.NewRequest("DELETE", "/handlers/f", nil)
+		w := httptest.NewRecorder()
+		s.Handlers(w, r)
+		return w.Code
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- run("/runLambda/f?wait=1") }()
+	for tries := 0; ; tries++ {
+		if h := s.handlers.Lookup("f"); h != nil && h.Info().Runners == 1 {
+			break
+		} else if tries == 500 {
+			t.Fatalf("Expected a running request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the handler is kept while it runs a request
+	if code := del(); code != http.StatusConflict {
+		t.Fatalf("Expected 409, got %d", code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	h := s.handlers.Lookup("f")
+	if code := del(); code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", code)
+	}
+
+	// the deleted handler cannot run requests any more, unlike the
+	// next one
+	if _, err := h.RunStart(nil); err != handler.ErrHandlerDeleted {
+		t.Fatalf("Expected %v, got %v", handler.ErrHandlerDeleted, err)
+	}
+	if w := run("/runLambda/f"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if s.handlers.Lookup("f") == h {
+		t.Fatalf("Expected a fresh handler")
+	}
+}
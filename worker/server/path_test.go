@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLambdaPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/runLambda/f":                 "/",
+		"/runLambda/f/":                "/",
+		"/runLambda/f/a/b":             "/a/b",
+		"/runLambda/f/a%2Fb/c%20d":     "/a%2Fb/c%20d",
+		"/runLambda/f/%3Fq=1/x?y=2":    "/%3Fq=1/x",
+		"/runLambda/f/caf%C3%A9/%25":   "/caf%C3%A9/%25",
+		"/runLambda/f/a/b/?trailing=1": "/a/b",
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		if actual := lambdaPath(r); actual != expected {
+			t.Fatalf("Expected %s for %s, got %s", expected, path, actual)
+		}
+	}
+}
+
+func TestEscapedPathForwarded(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.EscapedPath()))
+	})
+	s, _, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+
+	r := httptest.NewRequest("POST", "/runLambda/f/files/a%2Fb", strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+	s.RunLambda(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "/files/a%2Fb" {
+		t.Fatalf("Expected the escaped path, got %d: %s", w.Code, w.Body.String())
+	}
+}
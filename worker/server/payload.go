@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+const (
+	// headers that hand the lambda a request body staged to disk, in
+	// place of the body itself
+	BODY_FILE_HEADER = "X-Ol-Body-File"
+	BODY_SIZE_HEADER = "X-Ol-Body-Size"
+
+	// header that tells the lambda when its timeout is up, in
+	// milliseconds since the epoch
+	DEADLINE_HEADER = "X-Ol-Deadline"
+
+	// directory (in the sandbox directory) of staged request bodies
+	PAYLOAD_DIR = "payloads"
+)
+
+// payload is the body of a request.  Small bodies are kept in memory; larger
+// ones are staged to a file in the staging directory of the lambda, and the
+// lambda is given the path of the file under /host instead.
+type payload struct {
+	data []byte
+	file string // path on the worker of a staged body, if any
+	size int64
+
+	// other files in the staging directory of the lambda that the
+	// body refers to, shared with the sandbox like a staged body
+	shared []string
+}
+
+// errTooLarge returns a 413 httpErr for a body over limit bytes.
+func errTooLarge(what string, limit int64) *httpErr {
+	return newHttpErr(
+		fmt.Sprintf("%s exceeds limit of %d bytes", what, limit),
+		http.StatusRequestEntityTooLarge)
+}
+
+// sizeLimit combines the limit of the worker (negative means unlimited) with
+// that of a lambda (0 means none), which may only be lower.  It returns 0 if
+// there is no limit.
+func sizeLimit(worker int, lambda int) int64 {
+	limit := int64(worker)
+	if limit < 0 {
+		limit = 0
+	}
+	if lambda > 0 && (limit == 0 || int64(lambda) < limit) {
+		limit = int64(lambda)
+	}
+	return limit
+}
+
+// readPayload reads the body of a request, failing with a 413 if it is
+// over limit bytes (0 means unlimited).  Bodies over threshold bytes (0
+// means never) are staged to spill_dir.
+func readPayload(r *http.Request, limit int64, threshold int64, spill_dir string) (*payload, *httpErr) {
+	p := &payload{}
+	if r.Body == nil {
+		return p, nil
+	}
+	defer r.Body.Close()
+
+	if limit > 0 && r.ContentLength > limit {
+		return nil, errTooLarge("Request body", limit)
+	}
+
+	// read one byte past the limits, to tell when they are exceeded
+	body := io.Reader(r.Body)
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	head := body
+	if threshold > 0 {
+		head = io.LimitReader(body, threshold+1)
+	}
+
+	data, err := ioutil.ReadAll(head)
+	if err != nil {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	p.size = int64(len(data))
+
+	if threshold == 0 || p.size <= threshold {
+		if limit > 0 && p.size > limit {
+			return nil, errTooLarge("Request body", limit)
+		}
+		p.data = data
+		return p, nil
+	}
+
+	// too large to keep in memory
+	if err := p.spill(data, body, spill_dir); err != nil {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	if limit > 0 && p.size > limit {
+		p.Remove()
+		return nil, errTooLarge("Request body", limit)
+	}
+
+	return p, nil
+}
+
+// spill writes head, then the rest of the body, to a new file in spill_dir.
+func (p *payload) spill(head []byte, rest io.Reader, spill_dir string) error {
+	dir := filepath.Join(spill_dir, PAYLOAD_DIR)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "body-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p.file = f.Name()
+
+	// the lambda may run as another user
+	if err := f.Chmod(0644); err != nil {
+		p.Remove()
+		return err
+	}
+	if _, err := f.Write(head); err != nil {
+		p.Remove()
+		return err
+	}
+	n, err := io.Copy(f, rest)
+	if err != nil {
+		p.Remove()
+		return err
+	}
+	p.size += n
+
+	return nil
+}
+
+// Open returns a reader of the whole body.
+func (p *payload) Open() (io.ReadCloser, error) {
+	if p.file != "" {
+		return os.Open(p.file)
+	}
+	return ioutil.NopCloser(bytes.NewReader(p.data)), nil
+}
+
+// staged returns the files to share with the sandbox (see
+// handler.Handler.Share) while the payload is forwarded to it.
+func (p *payload) staged() []string {
+	if p.file == "" {
+		return p.shared
+	}
+	return append([]string{p.file}, p.shared...)
+}
+
+// Spilled tells whether the body was staged to disk.
+func (p *payload) Spilled() bool {
+	return p.file != ""
+}
+
+// sandboxPath returns the path of a staged body within the sandbox.
+func (p *payload) sandboxPath() string {
+	return path.Join("/host", PAYLOAD_DIR, filepath.Base(p.file))
+}
+
+// Remove deletes the file of a staged body, if any.
+func (p *payload) Remove() {
+	if p.file == "" {
+		return
+	}
+	if err := os.Remove(p.file); err != nil && !os.IsNotExist(err) {
+		log.Printf("could not remove %s: %v\n", p.file, err)
+	}
+	p.file = ""
+}
+
+// limitResponse makes reads of a sandbox response fail past the response
+// size limit of its lambda.  Responses known to be over it fail at once.
+func (s *Server) limitResponse(handler *handler.Handler, w2 *http.Response) *httpErr {
+	lconf, err := handler.Config()
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	limit := sizeLimit(s.config.Max_response_size, lconf.Max_response_size)
+	if limit == 0 {
+		return nil
+	}
+	if w2.ContentLength > limit {
+		return errTooLarge("Response body", limit)
+	}
+	w2.Body = &limitedBody{ReadCloser: w2.Body, left: limit}
+
+	return nil
+}
+
+// limitedBody fails reads of a response body past limit bytes.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+// errResponseTooLarge is returned when reading a sandbox response over the
+// size limit of its lambda.
+var errResponseTooLarge = errors.New("response body exceeds size limit")
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, errResponseTooLarge
+	}
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return 0, errResponseTooLarge
+	}
+	return n, err
+}
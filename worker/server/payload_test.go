@@ -0,0 +1,116 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func payloadReq(t *testing.T, body string) *http.Request {
+	r, err := http.NewRequest("POST", "http://localhost/runLambda/echo", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readAll(t *testing.T, p *payload) string {
+	body, err := p.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPayloadSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	small, herr := readPayload(payloadReq(t, "hello"), 100, 10, dir)
+	expectCode(t, herr, 0)
+	if small.Spilled() || readAll(t, small) != "hello" {
+		t.Fatalf("Expected small body in memory, got %+v", small)
+	}
+
+	text := strings.Repeat("x", 50)
+	large, herr := readPayload(payloadReq(t, text), 100, 10, dir)
+	expectCode(t, herr, 0)
+	if !large.Spilled() || large.size != 50 || readAll(t, large) != text {
+		t.Fatalf("Expected large body on disk, got %+v", large)
+	}
+	if !strings.HasPrefix(large.sandboxPath(), "/host/"+PAYLOAD_DIR+"/") {
+		t.Fatalf("Unexpected sandbox path %s", large.sandboxPath())
+	}
+
+	file := large.file
+	large.Remove()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed", file)
+	}
+}
+
+func TestPayloadLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	text := strings.Repeat("x", 101)
+
+	// in memory
+	_, herr := readPayload(payloadReq(t, text), 100, 0, dir)
+	expectCode(t, herr, http.StatusRequestEntityTooLarge)
+
+	// staged to disk, without leaving the file behind
+	_, herr = readPayload(payloadReq(t, text), 100, 10, dir)
+	expectCode(t, herr, http.StatusRequestEntityTooLarge)
+	files, _ := ioutil.ReadDir(dir + "/" + PAYLOAD_DIR)
+	if len(files) != 0 {
+		t.Fatalf("Expected no staged bodies, found %d", len(files))
+	}
+
+	_, herr = readPayload(payloadReq(t, text), 0, 0, dir)
+	expectCode(t, herr, 0)
+}
+
+func TestSizeLimit(t *testing.T) {
+	cases := []struct {
+		worker, lambda int
+		limit          int64
+	}{
+		{100, 0, 100},
+		{100, 50, 50},
+		{100, 200, 100},
+		{-1, 0, 0},
+		{-1, 50, 50},
+	}
+	for _, c := range cases {
+		if limit := sizeLimit(c.worker, c.lambda); limit != c.limit {
+			t.Errorf("sizeLimit(%d, %d) = %d, expected %d", c.worker, c.lambda, limit, c.limit)
+		}
+	}
+}
+
+func TestLimitedBody(t *testing.T) {
+	body := &limitedBody{ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789")), left: 10}
+	if data, err := ioutil.ReadAll(body); err != nil || string(data) != "0123456789" {
+		t.Fatalf("Expected whole body, got %q, %v", data, err)
+	}
+
+	body = &limitedBody{ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789")), left: 9}
+	if _, err := ioutil.ReadAll(body); err != errResponseTooLarge {
+		t.Fatalf("Expected errResponseTooLarge, got %v", err)
+	}
+}
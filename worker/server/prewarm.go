@@ -0,0 +1,101 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+// prewarmResult is the response to a /prewarm request.
+type prewarmResult struct {
+	Handler   handler.HandlerInfo `json:"handler"`
+	Instances int                 `json:"instances"` // warm, whatever was asked
+	PhasesMs  map[string]float64  `json:"phases_ms"` // empty if already warm
+}
+
+func (s *Server) PrewarmErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	if herr := s.authenticateAdmin(r); herr != nil {
+		return herr
+	}
+
+	// components represent prewarm[0]/<name_of_sandbox>[1]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of image to prewarm required",
+			http.StatusBadRequest)
+	}
+	img, _, herr := s.resolve(urlParts[1])
+	if herr != nil {
+		return herr
+	}
+
+	// a worker runs a single sandbox per lambda, which serves its
+	// concurrent requests, so more instances are warmed as one
+	if param := r.URL.Query().Get("instances"); param != "" {
+		instances, err := strconv.Atoi(param)
+		if err != nil || instances < 1 {
+			return newHttpErr(
+				"instances must be a positive number, not "+param,
+				http.StatusBadRequest)
+		}
+	}
+
+	h := s.handlers.Get(img)
+	phases := handler.NewPhases()
+	if err := h.Prewarm(phases); err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	result := prewarmResult{Handler: h.Info(), Instances: 1, PhasesMs: make(map[string]float64)}
+	for name, d := range phases.Durations() {
+		result.PhasesMs[name] = float64(d) / float64(time.Millisecond)
+	}
+	return writeJson(w, result)
+}
+
+// Prewarm pulls the code of a lambda, and creates and starts its sandbox,
+// which is left paused so the next invocation starts warm.  A worker has
+// one sandbox per lambda, so only one instance is warmed even if more are
+// asked for, as the response says:
+//
+// curl -X POST localhost:8080/prewarm/<lambda-name>?instances=1
+func (s *Server) Prewarm(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.PrewarmErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
+
+// keepWarm prewarms the lambdas with a min_warm in their lambda-config.json
+// whose sandboxes are not warm: at startup, or once they have been stopped
+// (e.g., evicted by the HandlerLRU or through /handlers, or killed past a
+// timeout).  While the HandlerLRU is full, sandboxes are not warmed, as
+// each would evict another paused sandbox (perhaps one just warmed).
+func (s *Server) keepWarm(lconfs map[string]*config.LambdaConfig) {
+	for name, lconf := range lconfs {
+		if lconf.Min_warm <= 0 {
+			continue
+		}
+		if s.handlers.Crowded() {
+			log.Printf("too many paused sandboxes to keep %s warm\n", name)
+			continue
+		}
+		if err := s.handlers.Get(name).Prewarm(nil); err != nil {
+			log.Printf("could not keep %s warm: %v\n", name, err)
+		}
+	}
+}
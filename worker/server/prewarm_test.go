@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+)
+
+func TestPrewarm(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "f", `{}`)
+
+	prewarm := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, nil)
+		w := httptest.NewRecorder()
+		s.Prewarm(w, r)
+		return w
+	}
+
+	if w := prewarm("/prewarm/f?instances=0"); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for 0 instances, got %d", w.Code)
+	}
+	if w := prewarm("/prewarm/f?instances=2"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"instances": 1`) {
+		t.Fatalf("Expected 1 instance, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := prewarm("/prewarm/f?instances=1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if info := s.handlers.Lookup("f").Info(); info.State != "paused" {
+		t.Fatalf("Expected a paused sandbox, got %+v", info)
+	}
+
+	// the invocation only unpauses the sandbox
+	r := httptest.NewRequest("POST", "/runLambda/f", strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+	s.RunLambda(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	sb := sm.sandboxes[0]
+	if len(sm.sandboxes) != 1 || sb.starts != 1 || sb.unpauses != 1 {
+		t.Fatalf("Expected the prewarmed sandbox to be unpaused, got %d sandboxes, %d starts, %d unpauses",
+			len(sm.sandboxes), sb.starts, sb.unpauses)
+	}
+
+}
+
+func TestKeepWarm(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "g", `{"min_warm": 1}`)
+
+	// room for a single paused sandbox
+	s.handlers = handler.NewHandlerSet(handler.HandlerSetOpts{
+		Sm:     sm,
+		Config: s.config,
+		Lru:    handler.NewHandlerLRU(1),
+	})
+	keepWarm := func(starts int) {
+		lconfs, err := s.lambdaConfigs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.keepWarm(lconfs)
+		if sb := sm.sandboxes[0]; sb.starts != starts {
+			t.Fatalf("Expected %d starts of g, got %d", starts, sb.starts)
+		}
+	}
+
+	keepWarm(1)
+	g := s.handlers.Lookup("g")
+
+	// pausing h after a request evicts g
+	r := httptest.NewRequest("POST", "/runLambda/h", strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+	s.RunLambda(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for tries := 0; g.Info().State != "stopped"; tries++ {
+		if tries == 500 {
+			t.Fatalf("Expected g to be evicted, got %+v", g.Info())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// warming g again would only evict h
+	keepWarm(1)
+
+	// once there is room, g is warmed again
+	if err := s.handlers.Delete("h"); err != nil {
+		t.Fatal(err)
+	}
+	keepWarm(2)
+}
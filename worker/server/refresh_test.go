@@ -0,0 +1,112 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeRefresh(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "slow" {
+			started <- true
+			<-release
+		}
+		w.Write([]byte("ok"))
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	s.config.Code_refresh = "digest"
+	s.config.Code_refresh_interval = -1
+	writeLambdaConfig(t, sm, "f", `{}`)
+	code := filepath.Join(sm.CodeDir("f"), "f.py")
+	if err := ioutil.WriteFile(code, []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	invoke := func(event string) {
+		r := httptest.NewRequest("POST", "/runLambda/f", strings.NewReader(event))
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	sandboxes := func() int {
+		sm.mutex.Lock()
+		defer sm.mutex.Unlock()
+		return len(sm.sandboxes)
+	}
+
+	invoke("a")
+	invoke("b")
+	if n := sandboxes(); n != 1 {
+		t.Fatalf("Expected 1 sandbox while the code is unchanged, got %d", n)
+	}
+
+	// a request runs on the old code while the code changes
+	done := make(chan bool)
+	go func() {
+		invoke("slow")
+		done <- true
+	}()
+	<-started
+	if err := ioutil.WriteFile(code, []byte("v2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	invoke("c")
+	if n := sandboxes(); n != 2 {
+		t.Fatalf("Expected a new sandbox for the new code, got %d sandboxes", n)
+	}
+	draining := 0
+	for _, info := range s.handlers.List() {
+		if info.Draining {
+			draining += 1
+		}
+	}
+	if draining != 1 {
+		t.Fatalf("Expected the old handler to drain, got %+v", s.handlers.List())
+	}
+
+	// the old sandbox keeps its own directory (and socket) while
+	// it drains
+	sm.mutex.Lock()
+	old, fresh := sm.sandboxes[0].dir, sm.sandboxes[1].dir
+	sm.mutex.Unlock()
+	if old == fresh {
+		t.Fatalf("Expected the sandboxes to have their own directories, both got %s", old)
+	}
+
+	close(release)
+	<-done
+	if infos := s.handlers.List(); len(infos) != 1 || infos[0].Draining {
+		t.Fatalf("Expected the old handler to be removed after its last request, got %+v", infos)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed with its sandbox, got %v", old, err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	// an explicit refresh
+	r := httptest.NewRequest("POST", "/handlers/f/refresh", nil)
+	w := httptest.NewRecorder()
+	s.Handlers(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	invoke("d")
+	if n := sandboxes(); n != 3 {
+		t.Fatalf("Expected a new sandbox after a refresh, got %d sandboxes", n)
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/open-lambda/open-lambda/worker/routes"
+)
+
+// how often the routes file is checked for changes, at most
+const ROUTES_POLL_INTERVAL = time.Second
+
+// routeReloader holds the routes of the worker's routes_file, reloaded when
+// the file changes.  A file that cannot be loaded leaves the old routes in
+// place.
+type routeReloader struct {
+	mutex    sync.Mutex
+	path     string
+	table    *routes.Table
+	mod_time time.Time
+	checked  time.Time
+}
+
+func newRouteReloader(path string) (*routeReloader, error) {
+	rr := &routeReloader{path: path}
+	if err := rr.load(); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// load reads the routes file, if it exists (no routes otherwise).  The
+// caller must hold the mutex, or be the constructor.
+func (rr *routeReloader) load() error {
+	rr.checked = time.Now()
+	info, err := os.Stat(rr.path)
+	if os.IsNotExist(err) {
+		rr.table = nil
+		rr.mod_time = time.Time{}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	table, err := routes.Load(rr.path)
+	if err != nil {
+		return err
+	}
+	rr.table = table
+	rr.mod_time = info.ModTime()
+	return nil
+}
+
+// Table returns the current routes, reloading them first if the file has
+// changed.
+func (rr *routeReloader) Table() *routes.Table {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+
+	if time.Since(rr.checked) < ROUTES_POLL_INTERVAL {
+		return rr.table
+	}
+	rr.checked = time.Now()
+
+	var mod_time time.Time
+	if info, err := os.Stat(rr.path); err == nil {
+		mod_time = info.ModTime()
+	}
+	if mod_time.Equal(rr.mod_time) {
+		return rr.table
+	}
+
+	if err := rr.load(); err != nil {
+		log.Printf("could not reload routes: %v\n", err)
+	} else {
+		log.Printf("Reloaded %d routes from %s\n", rr.table.Len(), rr.path)
+	}
+	return rr.table
+}
+
+// routedKey marks requests rewritten by Route, in their context.
+type routedKey struct{}
+
+// routeEvent is the event passed to a lambda invoked through a route.
+type routeEvent struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Params map[string]string `json:"params"`
+
+	// the body of the request: JSON, a string if it is text but not
+	// JSON, base64 (with Base64 set) if it is not text, or null if
+	// empty
+	Body   json.RawMessage `json:"body"`
+	Base64 bool            `json:"body_base64,omitempty"`
+}
+
+func (s *Server) RouteErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	var match *routes.Match
+	var allowed []string
+	if s.routes != nil {
+		match, allowed = s.routes.Table().Match(r.Host, r.Method, r.URL.Path)
+	}
+	if match == nil {
+		if len(allowed) > 0 {
+			herr := newHttpErr("Method not allowed", http.StatusMethodNotAllowed)
+			herr.headers = map[string]string{"Allow": strings.Join(allowed, ", ")}
+			return herr
+		}
+		return newHttpErr(
+			"No route for "+r.URL.Path,
+			http.StatusNotFound)
+	}
+	lambda := match.Route.Lambda
+
+	// the client authenticates the request it sent, not the event
+	if herr := s.authenticateHeaders(r, lambda); herr != nil {
+		return herr
+	}
+	input, herr := readPayload(r, sizeLimit(s.config.Max_body_size, 0), 0, "")
+	if herr != nil {
+		return herr
+	}
+	defer input.Remove()
+	if herr := s.authenticate(r, lambda, input); herr != nil {
+		return herr
+	}
+
+	// the lambda's own limit, once the request is authenticated
+	img, _, herr := s.resolve(lambda)
+	if herr != nil {
+		return herr
+	}
+	lconf, err := s.handlers.Get(img).Config()
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	if limit := sizeLimit(s.config.Max_body_size, lconf.Max_body_size); limit > 0 && input.size > limit {
+		return errTooLarge("Request body", limit)
+	}
+
+	event := routeEvent{Method: r.Method, Path: r.URL.Path, Params: match.Params}
+	switch {
+	case input.size == 0:
+		event.Body = json.RawMessage("null")
+	case json.Valid(input.data):
+		event.Body = json.RawMessage(input.data)
+	case utf8.Valid(input.data):
+		body, _ := json.Marshal(string(input.data))
+		event.Body = json.RawMessage(body)
+	default:
+		body, _ := json.Marshal(input.data)
+		event.Body = json.RawMessage(body)
+		event.Base64 = true
+	}
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	// invoke the lambda as /runLambda/<lambda> would, so the sandbox
+	// sees the path of the route
+	r2 := r.WithContext(context.WithValue(r.Context(), routedKey{}, true))
+	r2.Method = "POST"
+	r2.URL = &url.URL{Path: "/runLambda/" + lambda + r.URL.Path, RawQuery: r.URL.RawQuery}
+	r2.Header = make(http.Header, len(r.Header))
+	copyHeaders(r2.Header, r.Header)
+	r2.Header.Set("Content-Type", "application/json")
+	r2.Header.Del("Content-Length")
+	r2.ContentLength = int64(len(raw))
+	r2.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	return s.RunLambdaErr(w, r2)
+}
+
+// Route invokes the lambda that the worker's routes_file maps the host,
+// method and path of a request to, with an event holding the parameters of
+// the path and the body of the request:
+//
+// curl localhost:8080/users/42
+func (s *Server) Route(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.RouteErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
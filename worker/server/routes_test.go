@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoutes(t *testing.T) {
+	// the lambda returns the path it sees and its event
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event routeEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"path": r.URL.Path, "event": event})
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "users", `{"max_body_size": 10}`)
+	writeLambdaConfig(t, sm, "echo", `{}`)
+
+	if err := os.MkdirAll(s.config.Worker_dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	write := func(raw string, mod_time time.Time) {
+		if err := ioutil.WriteFile(s.config.Routes_file, []byte(raw), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(s.config.Routes_file, mod_time, mod_time); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"method": "GET", "path": "/users/{id}", "lambda": "users"},
+	        {"method": "POST", "path": "/users/{id}", "lambda": "users"},
+	        {"path": "/echo", "lambda": "echo"}]`, time.Now().Add(-time.Minute))
+	var err error
+	if s.routes, err = newRouteReloader(s.config.Routes_file); err != nil {
+		t.Fatal(err)
+	}
+
+	type response struct {
+		Path  string
+		Event routeEvent
+	}
+	request := func(method string, path string, body string) (*httptest.ResponseRecorder, response) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.Route(w, r)
+		var resp response
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, resp
+	}
+
+	w, resp := request("GET", "/users/42?verbose=1", "")
+	if w.Code != http.StatusOK || resp.Path != "/users/42" || resp.Event.Params["id"] != "42" ||
+		resp.Event.Method != "GET" || string(resp.Event.Body) != "null" {
+		t.Fatalf("Expected users to get id 42, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, resp := request("PUT", "/echo", "hello"); w.Code != http.StatusOK || string(resp.Event.Body) != `"hello"` {
+		t.Fatalf("Expected echo to get the body as a string, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, resp := request("POST", "/echo", `{"n": 1}`); w.Code != http.StatusOK || string(resp.Event.Body) != `{"n":1}` {
+		t.Fatalf("Expected echo to get the JSON body, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, resp := request("POST", "/echo", "\xff\x00"); w.Code != http.StatusOK || string(resp.Event.Body) != `"/wA="` || !resp.Event.Base64 {
+		t.Fatalf("Expected echo to get the binary body in base64, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := request("POST", "/users/42", strings.Repeat("x", 11)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 over the lambda's max_body_size, got %d", w.Code)
+	}
+	if w, _ := request("DELETE", "/users/42", ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, POST" {
+		t.Fatalf("Expected 405 allowing GET and POST, got %d", w.Code)
+	}
+	if w, _ := request("GET", "/nowhere", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", w.Code)
+	}
+
+	// the routes are reloaded when the file changes, but kept if the
+	// new file is invalid
+	write(`[{"path": "/people/{id}", "lambda": "users"}]`, time.Now())
+	s.routes.checked = time.Time{}
+	if w, resp := request("GET", "/people/7", ""); w.Code != http.StatusOK || resp.Event.Params["id"] != "7" {
+		t.Fatalf("Expected the new route to be used, got %d: %s", w.Code, w.Body.String())
+	}
+	write(`[{"path": "/people/{id}"}]`, time.Now().Add(time.Minute))
+	s.routes.checked = time.Time{}
+	if w, _ := request("GET", "/people/7", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the old routes to be kept, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+)
+
+// SCHEDULE_STATE_FILE (in the worker_dir) keeps the last runs of each
+// schedule entry across restarts
+const SCHEDULE_STATE_FILE = "schedule.json"
+
+// scheduleEntries collects the schedule entries of the schedule_file and of
+// the given lambda configs.
+func (s *Server) scheduleEntries(lconfs map[string]*config.LambdaConfig) ([]config.ScheduleEntry, error) {
+	entries := []config.ScheduleEntry{}
+	if s.config.Schedule_file != "" {
+		file_entries, err := config.ParseScheduleFile(s.config.Schedule_file)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, file_entries...)
+	}
+
+	for name, lconf := range lconfs {
+		for _, entry := range lconf.Schedule {
+			entry.Lambda = name
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// runScheduled invokes a lambda for the scheduler.
+func (s *Server) runScheduled(lambda string, event []byte) (int, error) {
+	code, _, err := s.invokeTriggered(lambda, "cron", event)
+	return code, err
+}
+
+func (s *Server) SchedulesErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	// components represent schedules[0]/<name_of_sandbox>[1]
+	lambda := ""
+	if urlParts := getUrlComponents(r); len(urlParts) >= 2 {
+		lambda = urlParts[1]
+	}
+
+	return writeJson(w, s.cron.List(lambda))
+}
+
+// Schedules lists the timed invocations of all lambdas (or one), with their
+// next and most recent runs:
+//
+// curl localhost:8080/schedules[/<lambda-name>]
+func (s *Server) Schedules(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.SchedulesErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
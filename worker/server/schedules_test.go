@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/cron"
+)
+
+func TestSchedules(t *testing.T) {
+	var mutex sync.Mutex
+	events := []string{}
+
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(TRIGGER_HEADER) != "cron" {
+			http.Error(w, "not triggered by cron", http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		events = append(events, string(body))
+		mutex.Unlock()
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "tick", `{"schedule": [{"cron": "@every 100ms", "event": {"n": 1}}]}`)
+	writeLambdaConfig(t, sm, "idle", `{}`)
+
+	s.cron = cron.NewScheduler(s.runScheduled, 10, filepath.Join(s.config.Worker_dir, SCHEDULE_STATE_FILE))
+	lconfs, err := s.lambdaConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.scheduleEntries(lconfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Lambda != "tick" {
+		t.Fatalf("Expected one entry for tick, got %+v", entries)
+	}
+	if err := s.cron.Update(entries); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	s.cron.Close(context.Background())
+
+	mutex.Lock()
+	if len(events) == 0 || events[0] != `{"n": 1}` {
+		t.Fatalf("Expected scheduled events, got %v", events)
+	}
+	mutex.Unlock()
+
+	r := httptest.NewRequest("GET", "/schedules/tick", nil)
+	w := httptest.NewRecorder()
+	s.Schedules(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	infos := s.cron.List("tick")
+	if len(infos) != 1 || len(infos[0].Runs) == 0 || infos[0].Runs[0].Status != http.StatusOK {
+		t.Fatalf("Expected successful runs, got %+v", infos)
+	}
+}
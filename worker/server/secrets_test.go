@@ -0,0 +1,70 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSandboxEnv(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+
+	if err := os.MkdirAll(s.config.Worker_dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	secrets := `{
+		"db-password": {"value": "hunter2", "lambdas": ["f", "billing*"]},
+		"tls-key": {"value": "KEY", "lambdas": ["f"]}}`
+	if err := ioutil.WriteFile(s.config.Secrets_file, []byte(secrets), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeLambdaConfig(t, sm, "f", `{
+		"env": {"STAGE": "prod", "DEBUG": "0"},
+		"secrets": [{"name": "db-password", "env": "DB_PASSWORD"}, {"name": "tls-key", "file": "tls.key"}]}`)
+	writeLambdaConfig(t, sm, "g", `{"secrets": [{"name": "missing", "env": "MISSING"}]}`)
+	writeLambdaConfig(t, sm, "h", `{"secrets": [{"name": "db-password", "env": "DB_PASSWORD"}]}`)
+
+	invoke := func(lambda string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/runLambda/"+lambda, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		return w
+	}
+
+	if w := invoke("f"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	opts := sm.sandboxes[0].opts
+	expected := []string{"DEBUG=0", "STAGE=prod", "DB_PASSWORD=hunter2"}
+	if !reflect.DeepEqual(opts.Env, expected) {
+		t.Fatalf("Expected env %v, got %v", expected, opts.Env)
+	}
+	if len(opts.Secret_files) != 1 || string(opts.Secret_files["tls.key"]) != "KEY" {
+		t.Fatalf("Expected tls.key as a secret file, got %v", opts.Secret_files)
+	}
+
+	w := invoke("g")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "no secret missing") {
+		t.Fatalf("Expected an error for the missing secret, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "hunter2") {
+		t.Fatalf("Expected no secret in the error, got %s", w.Body.String())
+	}
+
+	// secrets are scoped to lambdas
+	w = invoke("h")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "may not be used by h") {
+		t.Fatalf("Expected an error for a secret out of scope, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(sm.sandboxes) != 1 {
+		t.Fatalf("Expected no sandbox for a lambda with a secret out of scope, got %d", len(sm.sandboxes))
+	}
+}
@@ -2,35 +2,71 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/open-lambda/open-lambda/worker/accesslog"
+	"github.com/open-lambda/open-lambda/worker/cache"
 	"github.com/open-lambda/open-lambda/worker/config"
+	"github.com/open-lambda/open-lambda/worker/cron"
+	"github.com/open-lambda/open-lambda/worker/deadletter"
 	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/handler/state"
+	"github.com/open-lambda/open-lambda/worker/metrics"
 	pmanager "github.com/open-lambda/open-lambda/worker/pool-manager"
 	sbmanager "github.com/open-lambda/open-lambda/worker/sandbox-manager"
+	"github.com/open-lambda/open-lambda/worker/trace"
+	"github.com/open-lambda/open-lambda/worker/versions"
 )
 
 type Server struct {
-	sbmanager sbmanager.SandboxManager // why do we need this?
-	config    *config.Config
-	handlers  *handler.HandlerSet
+	sbmanager   sbmanager.SandboxManager // why do we need this?
+	pmanager    pmanager.PoolManager
+	config      *config.Config
+	handlers    *handler.HandlerSet
+	jobs        *JobQueue
+	deadLetters *deadletter.Store // nil if failed events are not kept
+	aliases     *versions.Aliases
+	routes      *routeReloader
+	sockets     socketSet     // open WebSockets, to push messages to
+	auth        Authenticator // nil if requests need no authentication
+	access      *accesslog.Logger
+	tracer      *trace.Tracer // nil if tracing is disabled
+	cache       *cache.Cache  // nil if responses are not cached
+	cron        *cron.Scheduler
+	drops       *dropBox
+	syncStop    chan bool // stops reloading schedules and watches
 }
 
 type httpErr struct {
-	msg  string
-	code int
+	msg     string
+	code    int
+	headers map[string]string // extra headers for the error response
 }
 
 func newHttpErr(msg string, code int) *httpErr {
 	return &httpErr{msg: msg, code: code}
 }
 
+// write sends the error as the response to a request.
+func (e *httpErr) write(w http.ResponseWriter) {
+	for key, value := range e.headers {
+		w.Header().Set(key, value)
+	}
+	http.Error(w, e.msg, e.code)
+}
+
 func initPManager(config *config.Config) (pm pmanager.PoolManager, err error) {
 	if config.Pool == "basic" {
 		if pm, err = pmanager.NewBasicManager(config); err != nil {
@@ -78,9 +114,73 @@ func NewServer(config *config.Config) (*Server, error) {
 	}
 	server := &Server{
 		sbmanager: sm,
+		pmanager:  pm,
 		config:    config,
 		handlers:  handler.NewHandlerSet(opts),
 	}
+	if config.Auth_file != "" {
+		auth, err := NewKeyAuthenticator(config.Auth_file)
+		if err != nil {
+			return nil, err
+		}
+		server.auth = auth
+	}
+
+	server.access, err = accesslog.Open(
+		config.Access_log,
+		int64(config.Access_log_max_size)<<20,
+		config.Access_log_backups)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Trace_export != "" {
+		exporter, err := trace.OpenExporter(config.Trace_export, map[string]interface{}{
+			"service.name": "open-lambda-worker",
+			"ol.cluster":   config.Cluster_name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		server.tracer = trace.NewTracer(exporter)
+	}
+
+	if config.Cache_size > 0 {
+		server.cache = cache.New(int64(config.Cache_size) << 20)
+	}
+
+	server.deadLetters, err = deadletter.Open(config.Dead_letter_dir, config.Dead_letter_max)
+	if err != nil {
+		return nil, err
+	}
+
+	server.aliases, err = versions.LoadAliases(config.Alias_file)
+	if err != nil {
+		return nil, err
+	}
+
+	server.routes, err = newRouteReloader(config.Routes_file)
+	if err != nil {
+		return nil, err
+	}
+
+	server.jobs = NewJobQueue(
+		config.Async_workers,
+		config.Async_queue_len,
+		time.Duration(config.Job_ttl)*time.Second,
+		server.runAsync,
+		server.finishJob)
+
+	server.cron = cron.NewScheduler(
+		server.runScheduled,
+		config.Schedule_history,
+		filepath.Join(config.Worker_dir, SCHEDULE_STATE_FILE))
+	server.drops = newDropBox(
+		config.Async_workers,
+		config.Async_queue_len,
+		server.processDrop)
+	server.syncStop = make(chan bool)
+	go server.syncTriggers()
 
 	return server, nil
 }
@@ -89,44 +189,139 @@ func (s *Server) Manager() sbmanager.SandboxManager {
 	return s.sbmanager
 }
 
-func (s *Server) ForwardToSandbox(handler *handler.Handler, r *http.Request, input []byte) ([]byte, *http.Response, *httpErr) {
-	channel, err := handler.RunStart()
-	if err != nil {
-		return nil, nil, newHttpErr(
+// ForwardToSandbox sends input to the sandbox of h and returns the
+// sandbox's response.  The body of the response is not read; the sandbox is
+// kept running until the caller closes it.
+//
+// The sandbox must respond completely within the lambda's timeout, counted
+// once the sandbox is ready.  Past it, the client gets a 504 (if nothing has
+// been sent yet) and the sandbox is killed, to be recreated by the next
+// request.
+//
+// Bodies staged to disk are not sent; the lambda gets their path in the
+// X-Ol-Body-File header.  The phases of the request are recorded in phases,
+// which may be nil.
+func (s *Server) ForwardToSandbox(h *handler.Handler, r *http.Request, input *payload, phases *handler.Phases) (*http.Response, *httpErr) {
+	if err := h.Acquire(); err != nil {
+		return nil, acquireErr(err)
+	}
+
+	channel, err := h.RunStart(phases)
+	if err == handler.ErrHandlerDeleted {
+		h.Release()
+		herr := newHttpErr(err.Error(), http.StatusServiceUnavailable)
+		herr.headers = map[string]string{"Retry-After": "1"}
+		return nil, herr
+	} else if err != nil {
+		h.Release()
+		return nil, newHttpErr(
 			err.Error(),
 			http.StatusInternalServerError)
 	}
 
-	defer handler.RunFinish()
+	// staged files are visible in the sandbox while it runs the
+	// request, as the directory of the sandbox goes with it
+	unshares := []func(){}
+	for _, file := range input.staged() {
+		unshare, err := h.Share(file)
+		if err != nil {
+			for _, unshare := range unshares {
+				unshare()
+			}
+			h.RunFinish(phases)
+			h.Release()
+			return nil, newHttpErr(
+				err.Error(),
+				http.StatusInternalServerError)
+		}
+		unshares = append(unshares, unshare)
+	}
+
+	timeout := h.Timeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	deadline, _ := ctx.Deadline()
+	endForward := phases.Begin(handler.PhaseForward)
+
+	// finish is called exactly once, when the response is done or
+	// the forward has failed
+	finish := func(complete bool) {
+		endForward()
+		if !complete && ctx.Err() == context.DeadlineExceeded {
+			log.Printf("%s did not respond within %v, killing its sandbox\n", r.URL.Path, timeout)
+			if err := h.Kill(); err != nil {
+				log.Printf("could not kill sandbox: %v\n", err)
+			}
+		}
+		cancel()
+		for _, unshare := range unshares {
+			unshare()
+		}
+		h.RunFinish(phases)
+		h.Release()
+	}
 
 	// forward request to sandbox.  r and w are the server
 	// request and response respectively.  r2 and w2 are the
 	// sandbox request and response respectively.
-	url := fmt.Sprintf("%s%s", channel.Url, r.URL.Path)
+	url := fmt.Sprintf("%s%s", channel.Url, lambdaPath(r))
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
 
 	// TODO(tyler): some sort of smarter backoff.  Or, a better
 	// way to detect a started sandbox.
 	max_tries := 10
 	errors := []error{}
 	for tries := 1; ; tries++ {
-		r2, err := http.NewRequest(r.Method, url, bytes.NewReader(input))
+		body, err := input.Open()
+		if err != nil {
+			finish(true)
+			return nil, newHttpErr(
+				err.Error(),
+				http.StatusInternalServerError)
+		}
+		if input.Spilled() {
+			body.Close()
+			body = ioutil.NopCloser(bytes.NewReader(nil))
+		}
+
+		r2, err := http.NewRequest(r.Method, url, body)
 		if err != nil {
-			return nil, nil, newHttpErr(
+			finish(true)
+			return nil, newHttpErr(
 				err.Error(),
 				http.StatusInternalServerError)
 		}
+		r2 = r2.WithContext(ctx)
 
-		r2.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		copyHeaders(r2.Header, r.Header)
+		for _, key := range credentialHeaders {
+			r2.Header.Del(key)
+		}
+		r2.Header.Del(BODY_FILE_HEADER)
+		r2.Header.Del(BODY_SIZE_HEADER)
+		if input.Spilled() {
+			r2.Header.Set(BODY_FILE_HEADER, input.sandboxPath())
+			r2.Header.Set(BODY_SIZE_HEADER, strconv.FormatInt(input.size, 10))
+		}
+		r2.Header.Set(DEADLINE_HEADER, strconv.FormatInt(deadline.UnixNano()/int64(time.Millisecond), 10))
 		client := &http.Client{Transport: &channel.Transport}
 		w2, err := client.Do(r2)
 		if err != nil {
 			errors = append(errors, err)
+			if ctx.Err() == context.DeadlineExceeded {
+				finish(false)
+				return nil, newHttpErr(
+					errSandboxTimeout.Error(),
+					http.StatusGatewayTimeout)
+			}
 			if tries == max_tries {
 				log.Printf("Forwarding request to container failed after %v tries\n", max_tries)
 				for i, item := range errors {
 					log.Printf("Attempt %v: %v\n", i, item.Error())
 				}
-				return nil, nil, newHttpErr(
+				finish(true)
+				return nil, newHttpErr(
 					err.Error(),
 					http.StatusInternalServerError)
 			}
@@ -134,18 +329,14 @@ func (s *Server) ForwardToSandbox(handler *handler.Handler, r *http.Request, inp
 			continue
 		}
 
-		defer w2.Body.Close()
-		wbody, err := ioutil.ReadAll(w2.Body)
-		if err != nil {
-			return nil, nil, newHttpErr(
-				err.Error(),
-				http.StatusInternalServerError)
-		}
-		return wbody, w2, nil
+		w2.Body = &sandboxBody{ReadCloser: w2.Body, ctx: ctx, finish: finish}
+		return w2, nil
 	}
 }
 
-func (s *Server) RunLambdaErr(w http.ResponseWriter, r *http.Request) *httpErr {
+func (s *Server) RunLambdaErr(w http.ResponseWriter, r *http.Request) (herr *httpErr) {
+	setRequestId(w, r)
+
 	// components represent runLambda[0]/<name_of_sandbox>[1]/<extra_things>...
 	// ergo we want [1] for name of sandbox
 	urlParts := getUrlComponents(r)
@@ -154,46 +345,212 @@ func (s *Server) RunLambdaErr(w http.ResponseWriter, r *http.Request) *httpErr {
 			"Name of image to run required",
 			http.StatusBadRequest)
 	}
-	img := urlParts[1]
-	i := strings.Index(img, "?")
-	if i >= 0 {
-		img = img[:i-1]
+	img, version, herr := s.resolve(urlParts[1])
+	if herr != nil {
+		return herr
 	}
+	setVersion(w, version)
+
+	t0 := time.Now()
+	code := http.StatusOK
+	phases := handler.NewPhases()
+	entry := newAccessEntry(r, img)
+	tr := s.startTrace(r, img)
+	cw := &countingWriter{ResponseWriter: w}
+	defer func() {
+		if herr != nil {
+			code = herr.code
+			entry.Error = herr.msg
+		}
+		metrics.ObserveInvocation(img, code, time.Since(t0))
+		entry.BytesOut = cw.n
+		s.logAccess(entry, code, t0, phases)
+		s.endTrace(tr, code, entry.Error, phases)
+	}()
 
 	// read request
-	rbody := []byte{}
-	if r.Body != nil {
-		defer r.Body.Close()
-		var err error
-		rbody, err = ioutil.ReadAll(r.Body)
-		if err != nil {
-			return newHttpErr(
-				err.Error(),
-				http.StatusInternalServerError)
+	handler, input, herr := s.readInput(r, img, phases)
+	if herr != nil {
+		return herr
+	}
+	defer input.Remove()
+	entry.BytesIn = input.size
+
+	// answer from the cache if possible, without starting the sandbox
+	key, ttl, herr := s.cacheKey(handler, img, r, input)
+	if herr != nil {
+		return herr
+	}
+	if key != "" {
+		if cached := s.cache.Get(img, key); cached != nil {
+			metrics.CacheHits.Inc(img)
+			entry.Cache = "hit"
+			code = cached.Status
+			if err := writeCached(cw, cached); err != nil {
+				log.Printf("could not write cached response of %s: %v\n", img, err)
+				entry.Error = err.Error()
+			}
+			return nil
 		}
+		metrics.CacheMisses.Inc(img)
+		entry.Cache = "miss"
+		cw.Header().Set(CACHE_HEADER, "miss")
 	}
 
 	// forward to sandbox
-	handler := s.handlers.Get(img)
-	wbody, w2, err := s.ForwardToSandbox(handler, r, rbody)
+	w2, err := s.ForwardToSandbox(handler, r, input, phases)
 	if err != nil {
 		return err
 	}
+	defer w2.Body.Close()
 
-	w.WriteHeader(w2.StatusCode)
+	if err := s.limitResponse(handler, w2); err != nil {
+		return err
+	}
 
-	if _, err := w.Write(wbody); err != nil {
+	var body *cacheBody
+	if key != "" && cacheable(w2) {
+		body = &cacheBody{ReadCloser: w2.Body, max: s.cache.Max()}
+		w2.Body = body
+	}
+
+	// once the status is sent, errors can only be logged
+	code = w2.StatusCode
+	if err := streamResponse(cw, w2); err != nil {
+		log.Printf("could not stream response of %s: %v\n", img, err)
+		entry.Error = err.Error()
+		if err == errResponseTooLarge {
+			// make sure the client does not take the
+			// truncated body for a complete one
+			panic(http.ErrAbortHandler)
+		}
+	} else if body != nil {
+		if cached := body.entry(w2); cached != nil {
+			s.cache.Put(img, key, cached, ttl)
+		}
+	}
+
+	return nil
+}
+
+// acquireErr translates an error from Handler.Acquire into an httpErr.
+// Requests turned away by the concurrency limits should be retried later.
+func acquireErr(err error) *httpErr {
+	if err == handler.ErrQueueFull || err == handler.ErrQueueTimeout {
+		herr := newHttpErr(err.Error(), http.StatusTooManyRequests)
+		herr.headers = map[string]string{"Retry-After": "1"}
+		return herr
+	}
+	return newHttpErr(err.Error(), http.StatusInternalServerError)
+}
+
+// authenticate checks that a request may invoke the named lambda.
+func (s *Server) authenticate(r *http.Request, lambda string, input *payload) *httpErr {
+	if s.auth == nil {
+		return nil
+	}
+
+	// routed requests were authenticated before their event was built
+	if r.Context().Value(routedKey{}) != nil {
+		return nil
+	}
+
+	body, err := input.Open()
+	if err != nil {
 		return newHttpErr(
 			err.Error(),
 			http.StatusInternalServerError)
 	}
+	defer body.Close()
 
-	return nil
+	// keys for a lambda also allow its versions and aliases
+	name, _ := versions.Split(lambda)
+	return s.auth.Authenticate(r, name, body)
+}
+
+// authenticateHeaders checks the credentials of a request to the named
+// lambda before its body is read, so the body of a request that would be
+// refused is never read or staged.  The signature of a signed request is
+// checked once it is (see authenticate).
+func (s *Server) authenticateHeaders(r *http.Request, lambda string) *httpErr {
+	if s.auth == nil || r.Context().Value(routedKey{}) != nil {
+		return nil
+	}
+
+	name, _ := versions.Split(lambda)
+	return s.auth.AuthenticateHeaders(r, name)
+}
+
+// authenticateAdmin checks that a request to a management endpoint may
+// manage the worker.  Reads need an admin key too, as they expose the
+// events (e.g., dead letters) and the state of every lambda.  The body is
+// read for the signature, and left for the caller to read again.
+func (s *Server) authenticateAdmin(r *http.Request) *httpErr {
+	if s.auth == nil {
+		return nil
+	}
+
+	if herr := s.auth.AuthenticateAdminHeaders(r); herr != nil {
+		return herr
+	}
+	input, herr := readPayload(r, sizeLimit(s.config.Max_body_size, 0), 0, "")
+	if herr != nil {
+		return herr
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(input.data))
+
+	return s.auth.AuthenticateAdmin(r, bytes.NewReader(input.data))
+}
+
+// readInput reads the body of a request to the named lambda, within the size
+// limits of the worker and of the lambda, and checks that the request may
+// invoke the lambda.  The caller must Remove the returned payload.  If the
+// code of the lambda must be pulled, the pull is recorded in phases.
+func (s *Server) readInput(r *http.Request, lambda string, phases *handler.Phases) (*handler.Handler, *payload, *httpErr) {
+	if herr := s.authenticateHeaders(r, lambda); herr != nil {
+		return nil, nil, herr
+	}
+
+	// the lambda's limit can only be lower, and is checked once
+	// the request is authenticated
+	input, herr := readPayload(r,
+		sizeLimit(s.config.Max_body_size, 0),
+		sizeLimit(s.config.Spill_threshold, 0),
+		s.handlers.StagingDir(lambda))
+	if herr != nil {
+		return nil, nil, herr
+	}
+
+	if herr := s.authenticate(r, lambda, input); herr != nil {
+		input.Remove()
+		return nil, nil, herr
+	}
+
+	handler := s.handlers.Get(lambda)
+	lconf, err := handler.Prepare(phases)
+	if err != nil {
+		input.Remove()
+		return nil, nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	// the body of a routed request was checked, not its event
+	routed := r.Context().Value(routedKey{}) != nil
+	if limit := sizeLimit(s.config.Max_body_size, lconf.Max_body_size); limit > 0 && input.size > limit && !routed {
+		input.Remove()
+		return nil, nil, errTooLarge("Request body", limit)
+	}
+
+	return handler, input, nil
 }
 
 // RunLambda expects POST requests like this:
 //
 // curl -X POST localhost:8080/runLambda/<lambda-name> -d '{}'
+//
+// Any method is accepted.  The method, the rest of the path (after the
+// lambda name), the query string and the headers are passed through to the
+// lambda, and its status code and headers are passed back.
 func (s *Server) RunLambda(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Receive request to %s\n", r.URL.Path)
 
@@ -202,14 +559,16 @@ func (s *Server) RunLambda(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods",
 		"GET, PUT, POST, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers",
-		"Content-Type, Content-Range, Content-Disposition, Content-Description, X-Requested-With")
+		"Content-Type, Content-Range, Content-Disposition, Content-Description, X-Requested-With, "+
+			strings.Join([]string{API_KEY_HEADER, KEY_ID_HEADER, TIMESTAMP_HEADER, SIGNATURE_HEADER}, ", "))
+	w.Header().Set("Access-Control-Expose-Headers", REQUEST_ID_HEADER)
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 	} else {
 		if err := s.RunLambdaErr(w, r); err != nil {
 			log.Printf("could not handle request: %s\n", err.msg)
-			http.Error(w, err.msg, err.code)
+			err.write(w)
 		}
 	}
 
@@ -218,12 +577,45 @@ func (s *Server) RunLambda(w http.ResponseWriter, r *http.Request) {
 func (s *Server) Status(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Receive request to %s\n", r.URL.Path)
 
-	wbody := []byte("ready")
+	running, queued := s.handlers.Load()
+	wbody := []byte(fmt.Sprintf("ready (%d running, %d queued)", running, queued))
 	if _, err := w.Write(wbody); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// Metrics exposes the worker's metrics in OpenMetrics text format:
+//
+// curl localhost:8080/metrics
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	// handler states are counted at scrape time
+	counts := map[string]int{}
+	for _, info := range s.handlers.List() {
+		counts[info.State] += 1
+	}
+	for _, st := range []state.HandlerState{state.Unitialized, state.Stopped, state.Running, state.Paused} {
+		metrics.Handlers.Set(float64(counts[st.String()]), st.String())
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.Default.Write(w); err != nil {
+		log.Printf("could not write metrics: %v\n", err)
+	}
+}
+
+// lambdaPath returns the part of the request path after the endpoint and
+// lambda name (e.g., "/a/b" for "/runLambda/<name>/a/b"), which is passed on
+// to the lambda.  It is kept escaped as the client sent it, so that escaped
+// slashes and the like reach the lambda as such.
+func lambdaPath(r *http.Request) string {
+	path := strings.Trim(r.URL.EscapedPath(), "/")
+	urlParts := strings.SplitN(path, "/", 3)
+	if len(urlParts) < 3 {
+		return "/"
+	}
+	return "/" + urlParts[2]
+}
+
 // Parses request URL into its "/" delimated components
 func getUrlComponents(r *http.Request) []string {
 	path := r.URL.Path
@@ -259,9 +651,88 @@ func Main(config_path string) {
 	port := fmt.Sprintf(":%s", conf.Worker_port)
 	run_path := "/runLambda/"
 	status_path := "/status"
+	handlers_path := "/handlers/"
+	metrics_path := "/metrics"
+	async_path := "/invokeAsync/"
+	jobs_path := "/jobs/"
+	batch_path := "/runBatch/"
+	ws_path := "/ws/"
+	ws_send_path := "/wsSend/"
+	workflow_path := "/runWorkflow/"
+	schedules_path := "/schedules"
+	cache_path := "/cache"
+	deadletters_path := "/deadletters"
+	versions_path := "/versions/"
+	aliases_path := "/aliases/"
+	prewarm_path := "/prewarm/"
 	http.HandleFunc(run_path, server.RunLambda)
+	http.HandleFunc("/", server.Route)
 	http.HandleFunc(status_path, server.Status)
+	http.HandleFunc(handlers_path, server.Handlers)
+	http.HandleFunc("/handlers", server.Handlers)
+	http.HandleFunc(metrics_path, server.Metrics)
+	http.HandleFunc(async_path, server.InvokeAsync)
+	http.HandleFunc(jobs_path, server.Jobs)
+	http.HandleFunc(batch_path, server.RunBatch)
+	http.HandleFunc(ws_path, server.WebSocket)
+	http.HandleFunc(ws_send_path, server.WebSocketSend)
+	http.HandleFunc(workflow_path, server.RunWorkflow)
+	http.HandleFunc(schedules_path, server.Schedules)
+	http.HandleFunc(schedules_path+"/", server.Schedules)
+	http.HandleFunc(cache_path, server.Cache)
+	http.HandleFunc(cache_path+"/", server.Cache)
+	http.HandleFunc(deadletters_path, server.DeadLetters)
+	http.HandleFunc(deadletters_path+"/", server.DeadLetters)
+	http.HandleFunc(versions_path, server.Versions)
+	http.HandleFunc(aliases_path, server.Aliases)
+	http.HandleFunc(prewarm_path, server.Prewarm)
 	log.Printf("Execute handler by POSTing to localhost%s%s%s\n", port, run_path, "<lambda>")
+	log.Printf("Execute handler through the routes of %s at localhost%s/<path>\n", conf.Routes_file, port)
+	log.Printf("Prewarm handler by POSTing to localhost%s%s%s\n", port, prewarm_path, "<lambda>")
 	log.Printf("Get status by sending request to localhost%s%s\n", port, status_path)
-	log.Fatal(http.ListenAndServe(port, nil))
+	log.Printf("Manage handlers by sending requests to localhost%s%s\n", port, handlers_path)
+	log.Printf("List scheduled invocations by sending request to localhost%s%s\n", port, schedules_path)
+	log.Printf("Inspect or purge the response cache by sending requests to localhost%s%s\n", port, cache_path)
+	log.Printf("List, inspect and redrive failed events by sending requests to localhost%s%s\n", port, deadletters_path)
+	log.Printf("Publish versions of a lambda by POSTing to localhost%s%s%s\n", port, versions_path, "<lambda>")
+	log.Printf("Manage aliases by sending requests to localhost%s%s%s, invoke them as <lambda>@<alias>\n", port, aliases_path, "<lambda>/<alias>")
+	log.Printf("Get metrics by sending request to localhost%s%s\n", port, metrics_path)
+	log.Printf("Execute handler on many events by POSTing a JSON array to localhost%s%s%s\n", port, batch_path, "<lambda>")
+	log.Printf("Run a workflow by POSTing to localhost%s%s%s\n", port, workflow_path, "<workflow>")
+	log.Printf("Open a WebSocket to handler at ws://localhost%s%s%s\n", port, ws_path, "<lambda>")
+	log.Printf("Push messages to WebSockets by POSTing to localhost%s%s%s\n", port, ws_send_path, "<lambda>[/<ws-id>]")
+	log.Printf("Queue handler by POSTing to localhost%s%s%s, poll at %s%s\n", port, async_path, "<lambda>", jobs_path, "<id>")
+
+	httpServer := &http.Server{Addr: port}
+	if conf.Tls_cert != "" {
+		certs, err := newCertReloader(conf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpServer.TLSConfig = certs.tlsConfig()
+		if conf.Tls_client_ca != "" {
+			log.Printf("Serving HTTPS, client certificates required\n")
+		} else {
+			log.Printf("Serving HTTPS\n")
+		}
+	}
+
+	go func() {
+		var err error
+		if conf.Tls_cert != "" {
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// run until asked to stop
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Printf("Received %v, shutting down\n", sig)
+	server.Shutdown(httpServer)
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Shutdown stops the worker gracefully.  It stops scheduled invocations,
+// watching directories and accepting requests, waits up to shutdown_timeout
+// for in-flight invocations (including queued asynchronous ones) to finish,
+// then removes every sandbox, stops the fork servers and flushes the access
+// log and traces.
+func (s *Server) Shutdown(httpServer *http.Server) {
+	timeout := time.Duration(s.config.Shutdown_timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Printf("Stop scheduled invocations and watching directories\n")
+	close(s.syncStop)
+	if err := s.cron.Close(ctx); err != nil {
+		log.Printf("Gave up waiting for scheduled invocations: %v\n", err)
+	}
+	if err := s.drops.Close(ctx); err != nil {
+		log.Printf("Gave up waiting for dropped files: %v\n", err)
+	}
+
+	log.Printf("Stop accepting requests, wait up to %v for in-flight requests\n", timeout)
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("Gave up waiting for requests: %v\n", err)
+	}
+	if err := s.jobs.Drain(ctx); err != nil {
+		log.Printf("Gave up waiting for jobs: %v\n", err)
+	}
+
+	log.Printf("Remove sandboxes\n")
+	s.handlers.Cleanup()
+
+	if s.pmanager != nil {
+		log.Printf("Stop fork servers\n")
+		s.pmanager.Shutdown()
+	}
+
+	if err := s.access.Close(); err != nil {
+		log.Printf("Could not close access log: %v\n", err)
+	}
+	if err := s.tracer.Close(); err != nil {
+		log.Printf("Could not export remaining spans: %v\n", err)
+	}
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/metrics"
+	"github.com/open-lambda/open-lambda/worker/trace"
+	"github.com/open-lambda/open-lambda/worker/versions"
+)
+
+const (
+	// WS_EVENT_HEADER tells the lambda why it is invoked for a WebSocket:
+	// connect, message, or disconnect
+	WS_EVENT_HEADER = "X-Ol-Ws-Event"
+
+	// WS_ID_HEADER identifies the WebSocket connection of an event
+	WS_ID_HEADER = "X-Ol-Ws-Id"
+
+	wsEventConnect    = "connect"
+	wsEventMessage    = "message"
+	wsEventDisconnect = "disconnect"
+
+	// messages read ahead of the one the lambda is handling
+	WS_QUEUE_SIZE = 16
+)
+
+// wsEvent is an event sent to the lambda of a WebSocket.
+type wsEvent struct {
+	kind   string
+	opcode byte
+	msg    []byte
+}
+
+// socket is a WebSocket connection relaying messages to and from a lambda.
+type socket struct {
+	s      *Server
+	h      *handler.Handler
+	r      *http.Request
+	conn   *wsConn
+	id     string
+	lambda string
+	phases *handler.Phases
+
+	// context of the connection's span, passed on with each event
+	traceparent string
+
+	bytesIn  int64
+	mutex    sync.Mutex
+	bytesOut int64 // also written by pushes
+}
+
+// socketSet holds the open WebSockets of a worker, by lambda (without
+// version) and ID, so that messages may be pushed to them.  The zero value
+// is an empty socketSet.
+type socketSet struct {
+	mutex   sync.Mutex
+	sockets map[string]map[string]*socket
+}
+
+func (ss *socketSet) add(sock *socket) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	name, _ := versions.Split(sock.lambda)
+	if ss.sockets == nil {
+		ss.sockets = make(map[string]map[string]*socket)
+	}
+	if ss.sockets[name] == nil {
+		ss.sockets[name] = make(map[string]*socket)
+	}
+	ss.sockets[name][sock.id] = sock
+}
+
+func (ss *socketSet) remove(sock *socket) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	name, _ := versions.Split(sock.lambda)
+	delete(ss.sockets[name], sock.id)
+	if len(ss.sockets[name]) == 0 {
+		delete(ss.sockets, name)
+	}
+}
+
+// find returns the socket of a lambda with the given ID, or all of its
+// sockets if the ID is empty.
+func (ss *socketSet) find(lambda string, id string) []*socket {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if id != "" {
+		if sock := ss.sockets[lambda][id]; sock != nil {
+			return []*socket{sock}
+		}
+		return nil
+	}
+	socks := make([]*socket, 0, len(ss.sockets[lambda]))
+	for _, sock := range ss.sockets[lambda] {
+		socks = append(socks, sock)
+	}
+	return socks
+}
+
+func (s *Server) WebSocketErr(w http.ResponseWriter, r *http.Request) (herr *httpErr) {
+	id := setRequestId(w, r)
+
+	// components represent ws[0]/<name_of_sandbox>[1]/<extra_things>...
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of image to run required",
+			http.StatusBadRequest)
+	}
+	img, version, herr := s.resolve(urlParts[1])
+	if herr != nil {
+		return herr
+	}
+	setVersion(w, version)
+
+	t0 := time.Now()
+	code := http.StatusSwitchingProtocols
+	phases := handler.NewPhases()
+	entry := newAccessEntry(r, img)
+	tr := s.startTrace(r, img)
+	sock := &socket{s: s, r: r, id: id, lambda: img, phases: phases, traceparent: tr.traceparent()}
+	defer func() {
+		if herr != nil {
+			code = herr.code
+			entry.Error = herr.msg
+		}
+		entry.BytesIn = sock.bytesIn
+		entry.BytesOut = sock.sent()
+		s.logAccess(entry, code, t0, phases)
+		s.endTrace(tr, code, entry.Error, phases)
+	}()
+
+	if herr := checkHandshake(r); herr != nil {
+		return herr
+	}
+
+	// authenticate the handshake, which has no body
+	h, input, herr := s.readInput(r, img, phases)
+	if herr != nil {
+		return herr
+	}
+	input.Remove()
+	lconf, err := h.Config()
+	if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	sock.h = h
+
+	// the sandbox stays running as long as the socket is open
+	if err := h.Attach(phases); err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	defer h.Detach(phases)
+
+	conn, herr := upgradeWebSocket(w, r)
+	if herr != nil {
+		return herr
+	}
+	conn.maxSize = sizeLimit(s.config.Max_body_size, lconf.Max_body_size)
+	sock.conn = conn
+
+	log.Printf("Open WebSocket %s to %s\n", id, img)
+	metrics.WebSockets.Add(1, img)
+	defer metrics.WebSockets.Add(-1, img)
+	s.sockets.add(sock)
+	defer s.sockets.remove(sock)
+
+	sock.serve()
+
+	log.Printf("Close WebSocket %s to %s\n", id, img)
+	return nil
+}
+
+// serve relays messages until the client closes the connection.  Events are
+// sent to the lambda one at a time, in the order they arrived, while the next
+// messages are read.
+func (sock *socket) serve() {
+	events := make(chan *wsEvent, WS_QUEUE_SIZE)
+	done := make(chan bool)
+	go func() {
+		for event := range events {
+			sock.send(event)
+		}
+		done <- true
+	}()
+
+	events <- &wsEvent{kind: wsEventConnect}
+	for {
+		opcode, msg, err := sock.conn.ReadMessage()
+		if err != nil {
+			if err != errWsClosed {
+				log.Printf("could not read from WebSocket %s: %v\n", sock.r.Header.Get(REQUEST_ID_HEADER), err)
+			}
+			break
+		}
+		sock.bytesIn += int64(len(msg))
+		events <- &wsEvent{kind: wsEventMessage, opcode: opcode, msg: msg}
+	}
+	events <- &wsEvent{kind: wsEventDisconnect}
+	close(events)
+	<-done
+
+	sock.conn.Close(wsCloseNormal, "")
+}
+
+// send forwards an event to the lambda, and relays each line of its response
+// to the client as a text message.
+func (sock *socket) send(event *wsEvent) {
+	t0 := time.Now()
+	r := sock.eventRequest(event)
+	input := &payload{data: event.msg, size: int64(len(event.msg))}
+
+	code, err := sock.relay(r, input)
+	metrics.ObserveInvocation(sock.lambda, code, time.Since(t0))
+	if err != nil {
+		log.Printf("could not handle %s event of WebSocket %s: %s\n", event.kind, r.Header.Get(WS_ID_HEADER), err.msg)
+		if event.kind != wsEventDisconnect {
+			sock.conn.Close(wsCloseError, err.msg)
+		}
+	}
+}
+
+// relay forwards a request to the sandbox and streams its response to the
+// client, one message per non-empty line.  It returns the status of the
+// response.
+func (sock *socket) relay(r *http.Request, input *payload) (int, *httpErr) {
+	w2, herr := sock.s.ForwardToSandbox(sock.h, r, input, sock.phases)
+	if herr != nil {
+		return herr.code, herr
+	}
+	defer w2.Body.Close()
+
+	if herr := sock.s.limitResponse(sock.h, w2); herr != nil {
+		return herr.code, herr
+	}
+
+	reader := bufio.NewReader(w2.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			// the client may be gone; keep reading so
+			// the lambda is not cut off mid-response
+			sock.write(wsText, line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return w2.StatusCode, newHttpErr(
+				err.Error(),
+				http.StatusInternalServerError)
+		}
+	}
+
+	// the lambda's error was relayed; only server errors end the socket
+	if w2.StatusCode >= 500 {
+		return w2.StatusCode, newHttpErr(
+			http.StatusText(w2.StatusCode),
+			w2.StatusCode)
+	}
+	return w2.StatusCode, nil
+}
+
+// write sends a message to the client, counting the bytes sent.
+func (sock *socket) write(opcode byte, msg []byte) error {
+	sock.mutex.Lock()
+	sock.bytesOut += int64(len(msg))
+	sock.mutex.Unlock()
+
+	return sock.conn.WriteMessage(opcode, msg)
+}
+
+// sent returns the bytes of the messages sent to the client.
+func (sock *socket) sent() int64 {
+	sock.mutex.Lock()
+	defer sock.mutex.Unlock()
+
+	return sock.bytesOut
+}
+
+// eventRequest returns the request for an event: a POST with the headers
+// of the handshake, the event type, and the ID of the connection.
+func (sock *socket) eventRequest(event *wsEvent) *http.Request {
+	r := new(http.Request)
+	*r = *sock.r
+	r.Method = "POST"
+	r.Header = make(http.Header, len(sock.r.Header))
+	copyHeaders(r.Header, sock.r.Header)
+
+	// hop-by-hop headers of the handshake mean nothing to the sandbox
+	for _, name := range []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions"} {
+		r.Header.Del(name)
+	}
+
+	r.Header.Set(WS_EVENT_HEADER, event.kind)
+	r.Header.Set(WS_ID_HEADER, sock.r.Header.Get(REQUEST_ID_HEADER))
+	r.Header.Set("Accept", "application/x-ndjson")
+	if event.opcode == wsBinary {
+		r.Header.Set("Content-Type", "application/octet-stream")
+	} else {
+		r.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if sock.traceparent != "" {
+		r.Header.Set(trace.TRACEPARENT_HEADER, sock.traceparent)
+	}
+
+	return r
+}
+
+// WebSocket opens a WebSocket to a lambda.  Each message from the client is
+// sent to the lambda as an event, and each line of the lambda's responses is
+// sent back to the client as a message:
+//
+// websocat ws://localhost:8080/ws/<lambda-name>
+func (s *Server) WebSocket(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.WebSocketErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
+
+func (s *Server) WebSocketSendErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	// components represent wsSend[0]/<name_of_sandbox>[1]/<ws_id>[2]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of image to send to required",
+			http.StatusBadRequest)
+	}
+	lambda, _ := versions.Split(urlParts[1])
+	id := ""
+	if len(urlParts) > 2 {
+		id = urlParts[2]
+	}
+
+	// a message is a request to the lambda, as far as keys are
+	// concerned
+	if herr := s.authenticateHeaders(r, lambda); herr != nil {
+		return herr
+	}
+	input, herr := readPayload(r, sizeLimit(s.config.Max_body_size, 0), 0, "")
+	if herr != nil {
+		return herr
+	}
+	defer input.Remove()
+	if herr := s.authenticate(r, lambda, input); herr != nil {
+		return herr
+	}
+
+	socks := s.sockets.find(lambda, id)
+	if id != "" && len(socks) == 0 {
+		return newHttpErr(
+			"No open WebSocket "+id+" to "+lambda,
+			http.StatusNotFound)
+	}
+
+	opcode := byte(wsText)
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		opcode = wsBinary
+	}
+	sent := 0
+	for _, sock := range socks {
+		if err := sock.write(opcode, input.data); err != nil {
+			log.Printf("could not send to WebSocket %s: %v\n", sock.id, err)
+			continue
+		}
+		sent += 1
+	}
+	return writeJson(w, map[string]int{"sent": sent})
+}
+
+// WebSocketSend pushes a message to the client of an open WebSocket to a
+// lambda, given its X-Ol-Ws-Id, or to every client of the lambda, without
+// waiting for a message from them:
+//
+// curl -X POST localhost:8080/wsSend/<lambda-name>/<ws-id> -d 'hello'
+// curl -X POST localhost:8080/wsSend/<lambda-name> -d 'hello, everyone'
+func (s *Server) WebSocketSend(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.WebSocketSendErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wsClient is just enough of a WebSocket client to test the worker.
+type wsClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, url string, path string) *wsClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	handshake := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept %q", accept)
+	}
+
+	return &wsClient{conn: conn, reader: reader}
+}
+
+func (c *wsClient) write(t *testing.T, opcode byte, msg string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(msg))}
+	frame = append(frame, mask...)
+	for i := 0; i < len(msg); i++ {
+		frame = append(frame, msg[i]^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *wsClient) read(t *testing.T) (byte, string) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, string(payload)
+}
+
+func TestWebSocket(t *testing.T) {
+	var mutex sync.Mutex
+	events := []string{}
+
+	// greets on connect, and echoes each message twice in upper case
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		event := r.Header.Get(WS_EVENT_HEADER)
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+
+		switch event {
+		case wsEventConnect:
+			w.Write([]byte("hello\n"))
+		case wsEventMessage:
+			msg := strings.ToUpper(string(body))
+			w.Write([]byte(msg + "\n\n" + msg + "\n"))
+		}
+	})
+
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(s.WebSocket))
+	defer srv.Close()
+
+	c := dialWebSocket(t, srv.URL, "/ws/echo")
+
+	expected := []string{"hello", "ONE", "ONE", "TWO", "TWO"}
+	c.write(t, wsText, "one")
+	c.write(t, wsText, "two")
+	for _, want := range expected {
+		if opcode, msg := c.read(t); opcode != wsText || msg != want {
+			t.Fatalf("Expected text message %q, got %d %q", want, opcode, msg)
+		}
+	}
+
+	// ping is answered, and the sandbox stays running while open
+	c.write(t, wsPing, "ping")
+	if opcode, msg := c.read(t); opcode != wsPong || msg != "ping" {
+		t.Fatalf("Expected pong, got %d %q", opcode, msg)
+	}
+	if info := s.handlers.Get("echo").Info(); info.Sockets != 1 || info.State != "running" {
+		t.Fatalf("Expected running handler with 1 socket, got %+v", info)
+	}
+	if sb := sm.sandboxes[0]; sb.pauses != 0 {
+		t.Fatalf("Expected no pauses while the socket is open, got %d", sb.pauses)
+	}
+
+	// closing sends the disconnect event, then pauses the sandbox
+	c.write(t, wsClose, "")
+	if opcode, _ := c.read(t); opcode != wsClose {
+		t.Fatalf("Expected close, got %d", opcode)
+	}
+	for i := 0; s.handlers.Get("echo").Info().Sockets != 0; i++ {
+		if i == 100 {
+			t.Fatal("Socket was not detached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	got := strings.Join(events, ",")
+	mutex.Unlock()
+	if got != "connect,message,message,disconnect" {
+		t.Fatalf("Unexpected events %s", got)
+	}
+	if info := s.handlers.Get("echo").Info(); info.State != "paused" {
+		t.Fatalf("Expected paused handler, got %+v", info)
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	s, _, cleanup := newFakeServer(t, http.NotFoundHandler())
+	defer cleanup()
+
+	r := httptest.NewRequest("GET", "/ws/echo", nil)
+	w := httptest.NewRecorder()
+	s.WebSocket(w, r)
+
+	if w.Code != http.StatusUpgradeRequired {
+		t.Fatalf("Expected 426, got %d", w.Code)
+	}
+}
+
+func TestWebSocketSend(t *testing.T) {
+	ids := make(chan string, 2)
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(WS_EVENT_HEADER) == wsEventConnect {
+			ids <- r.Header.Get(WS_ID_HEADER)
+		}
+	})
+	s, _, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(s.WebSocket))
+	defer srv.Close()
+	alice := dialWebSocket(t, srv.URL, "/ws/chat")
+	aliceId := <-ids
+	bob := dialWebSocket(t, srv.URL, "/ws/chat")
+	<-ids
+
+	send := func(path string, msg string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(msg))
+		w := httptest.NewRecorder()
+		s.WebSocketSend(w, r)
+		return w
+	}
+
+	// pushed without a message from the clients
+	if w := send("/wsSend/chat/"+aliceId, "just alice"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("/wsSend/chat", "everyone"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"sent": 2`) {
+		t.Fatalf("Expected a broadcast to 2 sockets, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, want := range []string{"just alice", "everyone"} {
+		if opcode, msg := alice.read(t); opcode != wsText || msg != want {
+			t.Fatalf("Expected alice to get %q, got %d %q", want, opcode, msg)
+		}
+	}
+	if opcode, msg := bob.read(t); opcode != wsText || msg != "everyone" {
+		t.Fatalf("Expected bob to get the broadcast only, got %d %q", opcode, msg)
+	}
+
+	if w := send("/wsSend/other/"+aliceId, "lost"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a socket of another lambda, got %d", w.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// hopHeaders are meaningful only for a single connection, so they are not
+// copied from the sandbox response to the client response.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// errSandboxTimeout is returned when reading a sandbox response past the
+// deadline of its lambda.
+var errSandboxTimeout = errors.New("lambda did not respond before its timeout")
+
+// copyHeaders copies the end-to-end headers of src to dst.
+func copyHeaders(dst http.Header, src http.Header) {
+	for key, values := range src {
+		dst[key] = append([]string{}, values...)
+	}
+	for _, key := range hopHeaders {
+		dst.Del(key)
+	}
+}
+
+// sandboxBody is the body of a sandbox response.  Closing it notifies the
+// Handler that the request has completed.
+type sandboxBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	once     sync.Once
+	complete bool // was the body read to the end?
+	finish   func(complete bool)
+}
+
+func (b *sandboxBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.complete = true
+	} else if err != nil && b.ctx.Err() == context.DeadlineExceeded {
+		err = errSandboxTimeout
+	}
+	return n, err
+}
+
+func (b *sandboxBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.finish(b.complete)
+	})
+	return err
+}
+
+// readResponse reads and closes the body of a sandbox response.
+func readResponse(w2 *http.Response) ([]byte, *httpErr) {
+	defer w2.Body.Close()
+
+	wbody, err := ioutil.ReadAll(w2.Body)
+	if err == errSandboxTimeout {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusGatewayTimeout)
+	} else if err == errResponseTooLarge {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusRequestEntityTooLarge)
+	} else if err != nil {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	return wbody, nil
+}
+
+// streamResponse copies the headers and status of a sandbox response to the
+// client, then the body, flushing as data arrives from the sandbox so that
+// slow or progressive (e.g., Server-Sent Events) output reaches the client
+// right away.
+func streamResponse(w http.ResponseWriter, w2 *http.Response) error {
+	copyHeaders(w.Header(), w2.Header)
+
+	if strings.HasPrefix(w2.Header.Get("Content-Type"), "text/event-stream") {
+		// keep caches and proxies (e.g., nginx) from holding events back
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+
+	w.WriteHeader(w2.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := w2.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
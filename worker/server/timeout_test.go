@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLambdaTimeout(t *testing.T) {
+	var mutex sync.Mutex
+	calls := 0
+	deadlines := []int64{}
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ := strconv.ParseInt(r.Header.Get(DEADLINE_HEADER), 10, 64)
+		mutex.Lock()
+		calls += 1
+		first := calls == 1
+		deadlines = append(deadlines, deadline)
+		mutex.Unlock()
+
+		// the first request blocks past the timeout (the body is
+		// read, so that the server notices the connection closing)
+		if first {
+			ioutil.ReadAll(r.Body)
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "f", `{"timeout": 1}`)
+
+	run := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/runLambda/f", strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		s.RunLambda(w, r)
+		return w
+	}
+
+	start := time.Now()
+	if w := run(); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected 504, got %d: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected a timeout after 1s, took %v", elapsed)
+	}
+	expected := start.Add(time.Second).UnixNano() / int64(time.Millisecond)
+	if d := deadlines[0] - expected; d < -100 || d > 100 {
+		t.Fatalf("Expected a deadline of %d, got %d", expected, deadlines[0])
+	}
+
+	// the stuck sandbox was killed, so the next request gets a fresh one
+	sb := sm.sandboxes[0]
+	sb.mutex.Lock()
+	removed := sb.removed
+	sb.mutex.Unlock()
+	if !removed {
+		t.Fatalf("Expected the sandbox to be killed")
+	}
+	if w := run(); w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(sm.sandboxes) != 2 {
+		t.Fatalf("Expected a fresh sandbox, got %d sandboxes", len(sm.sandboxes))
+	}
+}
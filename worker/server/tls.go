@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+)
+
+// how often certificate files are checked for changes
+const CERT_POLL_INTERVAL = 10 * time.Second
+
+// certReloader serves the worker's certificate (and client CA) for TLS
+// handshakes, reloading them when their files change.
+type certReloader struct {
+	mutex     sync.RWMutex
+	cert_file string
+	key_file  string
+	ca_file   string
+	cert      *tls.Certificate
+	client_ca *x509.CertPool
+	mod_times map[string]time.Time
+}
+
+func newCertReloader(conf *config.Config) (*certReloader, error) {
+	c := &certReloader{
+		cert_file: conf.Tls_cert,
+		key_file:  conf.Tls_key,
+		ca_file:   conf.Tls_client_ca,
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	go c.watch()
+
+	return c, nil
+}
+
+// files returns the files to watch.
+func (c *certReloader) files() []string {
+	files := []string{c.cert_file, c.key_file}
+	if c.ca_file != "" {
+		files = append(files, c.ca_file)
+	}
+	return files
+}
+
+// load reads the certificate files.
+func (c *certReloader) load() error {
+	mod_times := map[string]time.Time{}
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		mod_times[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.cert_file, c.key_file)
+	if err != nil {
+		return fmt.Errorf("could not load TLS certificate: %v", err)
+	}
+
+	var client_ca *x509.CertPool
+	if c.ca_file != "" {
+		pem, err := ioutil.ReadFile(c.ca_file)
+		if err != nil {
+			return err
+		}
+		client_ca = x509.NewCertPool()
+		if !client_ca.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", c.ca_file)
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cert = &cert
+	c.client_ca = client_ca
+	c.mod_times = mod_times
+
+	return nil
+}
+
+// changed tells whether any of the files was modified since it was loaded.
+func (c *certReloader) changed() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// probably being replaced; try again later
+			continue
+		}
+		if !info.ModTime().Equal(c.mod_times[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the certificates whenever their files change.  If the new
+// files cannot be loaded, the old certificates are kept.
+func (c *certReloader) watch() {
+	for {
+		time.Sleep(CERT_POLL_INTERVAL)
+
+		if c.changed() {
+			if err := c.load(); err != nil {
+				log.Printf("could not reload TLS certificates: %v\n", err)
+			} else {
+				log.Printf("Reloaded TLS certificates\n")
+			}
+		}
+	}
+}
+
+// tlsConfig returns a TLS config that uses the current certificates for
+// every new connection.
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+
+			conf := &tls.Config{
+				Certificates: []tls.Certificate{*c.cert},
+				MinVersion:   tls.VersionTLS12,
+			}
+			if c.client_ca != nil {
+				conf.ClientCAs = c.client_ca
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+)
+
+// writeCert writes a self-signed certificate with the given common name and
+// its key, and sets their modification time.
+func writeCert(t *testing.T, cert_file string, key_file string, name string, mtime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(cert_file, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key_file, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{cert_file, key_file} {
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedName returns the common name of the certificate served to a client.
+func servedName(t *testing.T, c *certReloader) string {
+	conf, err := c.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
+
+func TestCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &config.Config{
+		Tls_cert: filepath.Join(dir, "cert.pem"),
+		Tls_key:  filepath.Join(dir, "key.pem"),
+	}
+	t0 := time.Now().Add(-time.Minute)
+	writeCert(t, conf.Tls_cert, conf.Tls_key, "first", t0)
+
+	c, err := newCertReloader(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.changed() {
+		t.Fatalf("Expected the certificate to be unchanged")
+	}
+	if name := servedName(t, c); name != "first" {
+		t.Fatalf("Expected the first certificate, got %s", name)
+	}
+
+	// new files are picked up
+	writeCert(t, conf.Tls_cert, conf.Tls_key, "second", t0.Add(time.Second))
+	if !c.changed() {
+		t.Fatalf("Expected the certificate to be changed")
+	}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, c); name != "second" {
+		t.Fatalf("Expected the second certificate, got %s", name)
+	}
+
+	// broken files are not, and the old certificate is kept
+	if err := ioutil.WriteFile(conf.Tls_cert, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !c.changed() {
+		t.Fatalf("Expected the certificate to be changed")
+	}
+	if err := c.load(); err == nil {
+		t.Fatalf("Expected an invalid certificate to fail to load")
+	}
+	if name := servedName(t, c); name != "second" {
+		t.Fatalf("Expected the second certificate to be kept, got %s", name)
+	}
+}
+
+func TestCertReloadClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &config.Config{
+		Tls_cert:      filepath.Join(dir, "cert.pem"),
+		Tls_key:       filepath.Join(dir, "key.pem"),
+		Tls_client_ca: filepath.Join(dir, "ca.pem"),
+	}
+	writeCert(t, conf.Tls_cert, conf.Tls_key, "server", time.Now())
+
+	// the CA file must hold certificates
+	if err := ioutil.WriteFile(conf.Tls_client_ca, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCertReloader(conf); err == nil {
+		t.Fatalf("Expected a CA file without certificates to be rejected")
+	}
+
+	writeCert(t, conf.Tls_client_ca, filepath.Join(dir, "ca-key.pem"), "ca", time.Now())
+	c, err := newCertReloader(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConf, err := c.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConf.ClientAuth != tls.RequireAndVerifyClientCert || tlsConf.ClientCAs == nil {
+		t.Fatalf("Expected client certificates to be required")
+	}
+}
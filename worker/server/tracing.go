@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/trace"
+)
+
+// invocationTrace is the trace of one invocation of a lambda: a span for the
+// whole invocation, and child spans for the phases of the request.
+type invocationTrace struct {
+	span    *trace.Span
+	sampled bool
+
+	// ID of the span of the forward, the parent of any span created in
+	// the sandbox
+	forward trace.SpanId
+}
+
+// startTrace starts the span of an invocation of a lambda, continuing the
+// trace of the client if the request has a valid traceparent header.  The
+// header is replaced with one for the forward, to be passed to the sandbox.
+// It returns nil if tracing is disabled.
+func (s *Server) startTrace(r *http.Request, lambda string) *invocationTrace {
+	if s.tracer == nil {
+		return nil
+	}
+
+	ctx, ok := trace.ParseTraceparent(
+		r.Header.Get(trace.TRACEPARENT_HEADER),
+		r.Header.Get(trace.TRACESTATE_HEADER))
+	if !ok {
+		ctx = trace.SpanContext{TraceId: trace.NewTraceId(), Sampled: true}
+	}
+
+	t := &invocationTrace{
+		span: &trace.Span{
+			TraceId:  ctx.TraceId,
+			SpanId:   trace.NewSpanId(),
+			ParentId: ctx.SpanId,
+			Name:     "invoke " + lambda,
+			Kind:     trace.KindServer,
+			Start:    time.Now(),
+			Attributes: map[string]interface{}{
+				"ol.lambda":     lambda,
+				"ol.request_id": r.Header.Get(REQUEST_ID_HEADER),
+				"http.method":   r.Method,
+				"http.target":   r.URL.RequestURI(),
+			},
+		},
+		sampled: ctx.Sampled,
+		forward: trace.NewSpanId(),
+	}
+
+	ctx.SpanId = t.forward
+	r.Header.Set(trace.TRACEPARENT_HEADER, ctx.Traceparent())
+	if ctx.State != "" {
+		r.Header.Set(trace.TRACESTATE_HEADER, ctx.State)
+	}
+
+	return t
+}
+
+// traceparent returns the traceparent header for requests made on behalf of
+// the whole invocation, or "" if tracing is disabled.
+func (t *invocationTrace) traceparent() string {
+	if t == nil {
+		return ""
+	}
+
+	ctx := trace.SpanContext{TraceId: t.span.TraceId, SpanId: t.span.SpanId, Sampled: t.sampled}
+	return ctx.Traceparent()
+}
+
+// endTrace ends the span of an invocation, and records it along with a span
+// for each phase of the request.
+func (s *Server) endTrace(t *invocationTrace, status int, errmsg string, phases *handler.Phases) {
+	if t == nil || !t.sampled {
+		return
+	}
+
+	t.span.End = time.Now()
+	t.span.Attributes["http.status_code"] = status
+	t.span.Error = errmsg
+
+	// with several forwards (e.g., a batch), the sandbox was given
+	// the context of the invocation span instead
+	spans := phases.Spans()
+	forwards := 0
+	for _, phase := range spans {
+		if phase.Name == handler.PhaseForward {
+			forwards += 1
+		}
+	}
+
+	for _, phase := range spans {
+		span := &trace.Span{
+			TraceId:  t.span.TraceId,
+			SpanId:   trace.NewSpanId(),
+			ParentId: t.span.SpanId,
+			Name:     phase.Name,
+			Kind:     trace.KindInternal,
+			Start:    phase.Start,
+			End:      phase.Start.Add(phase.Duration),
+		}
+		if phase.Name == handler.PhaseForward {
+			span.Kind = trace.KindClient
+			if forwards == 1 {
+				span.SpanId = t.forward
+			}
+		}
+		s.tracer.Record(span)
+	}
+	s.tracer.Record(t.span)
+}
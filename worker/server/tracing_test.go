@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/trace"
+)
+
+// memExporter keeps exported spans in memory.
+type memExporter struct {
+	spans []*trace.Span
+}
+
+func (e *memExporter) Export(spans []*trace.Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memExporter) Close() error {
+	return nil
+}
+
+func TestTracePropagation(t *testing.T) {
+	exporter := &memExporter{}
+	s := &Server{tracer: trace.NewTracer(exporter)}
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	r, err := http.NewRequest("POST", "http://localhost/runLambda/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set(trace.TRACEPARENT_HEADER, parent)
+
+	tr := s.startTrace(r, "echo")
+
+	// the sandbox continues the trace from the forward span
+	ctx, ok := trace.ParseTraceparent(r.Header.Get(trace.TRACEPARENT_HEADER), "")
+	if !ok || ctx.TraceId.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || ctx.SpanId != tr.forward {
+		t.Fatalf("Unexpected traceparent %s", r.Header.Get(trace.TRACEPARENT_HEADER))
+	}
+
+	phases := handler.NewPhases()
+	phases.Begin(handler.PhasePull)()
+	phases.Begin(handler.PhaseForward)()
+	s.endTrace(tr, 200, "", phases)
+	s.tracer.Close()
+
+	if len(exporter.spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(exporter.spans))
+	}
+	root := exporter.spans[2]
+	if root.ParentId.String() != "00f067aa0ba902b7" || root.Kind != trace.KindServer {
+		t.Fatalf("Unexpected root span %+v", root)
+	}
+	for _, span := range exporter.spans[:2] {
+		if span.ParentId != root.SpanId || span.TraceId != root.TraceId {
+			t.Fatalf("Expected %s to be a child of the root span", span.Name)
+		}
+	}
+	if forward := exporter.spans[1]; forward.SpanId != tr.forward || forward.Kind != trace.KindClient {
+		t.Fatalf("Unexpected forward span %+v", forward)
+	}
+}
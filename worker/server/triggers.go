@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/config"
+)
+
+// how often the schedules and watched directories are reloaded from the
+// schedule_file and the lambda-config.json files
+const TRIGGER_SYNC_INTERVAL = time.Minute
+
+// TRIGGER_HEADER tells a lambda what invoked it (e.g., cron or watch), when
+// not a client
+const TRIGGER_HEADER = "X-Ol-Trigger"
+
+// lambdaConfigs returns the lambda-config.json of every lambda the worker
+// knows of: those it has handlers for and, with a local registry, those in
+// the registry.
+func (s *Server) lambdaConfigs() (map[string]*config.LambdaConfig, error) {
+	names := []string{}
+	for _, info := range s.handlers.List() {
+		names = append(names, info.Name)
+	}
+	if s.config.Registry == "local" {
+		files, err := ioutil.ReadDir(s.config.Reg_dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				names = append(names, file.Name())
+			}
+		}
+	}
+
+	lconfs := make(map[string]*config.LambdaConfig)
+	for _, name := range names {
+		if _, ok := lconfs[name]; ok {
+			continue
+		}
+
+		// triggers invoke the current code, so versions (and
+		// versions being published) do not have their own
+		if strings.Contains(name, "@") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		var lconf *config.LambdaConfig
+		var err error
+		if h := s.handlers.Lookup(name); h != nil {
+			lconf, err = h.Config()
+		} else {
+			lconf, err = config.ParseLambdaConfig(s.sbmanager.CodeDir(name))
+		}
+		if err != nil {
+			log.Printf("could not read config of %s: %v\n", name, err)
+			continue
+		}
+		lconfs[name] = lconf
+	}
+
+	return lconfs, nil
+}
+
+// syncTriggers reloads the schedules and watched directories, and warms the
+// lambdas that are kept warm, now and then, until syncStop is closed.
+func (s *Server) syncTriggers() {
+	recovered := false
+	for {
+		lconfs, err := s.lambdaConfigs()
+		if err != nil {
+			log.Printf("could not load lambda configs: %v\n", err)
+		} else {
+			entries, err := s.scheduleEntries(lconfs)
+			if err != nil {
+				log.Printf("could not load schedules: %v\n", err)
+			} else if err := s.cron.Update(entries); err != nil {
+				log.Printf("%v\n", err)
+			}
+
+			targets := s.dropTargets(lconfs)
+			if !recovered {
+				s.recoverDrops(targets)
+				recovered = true
+			}
+			s.drops.Update(targets)
+			s.keepWarm(lconfs)
+		}
+
+		select {
+		case <-s.syncStop:
+			return
+		case <-time.After(TRIGGER_SYNC_INTERVAL):
+		}
+	}
+}
+
+// invokeTriggered invokes a lambda on behalf of the worker (e.g., for the
+// scheduler), as an asynchronous job would be run, and returns the status
+// and body of the response.  Server errors of the lambda are returned as
+// errors too.  The event may refer to files in the staging directory of the
+// lambda, listed in shared, which are visible in the sandbox during the
+// invocation.
+func (s *Server) invokeTriggered(lambda string, trigger string, event []byte, shared ...string) (int, []byte, error) {
+	lambda, _, herr := s.resolve(lambda)
+	if herr != nil {
+		return herr.code, nil, fmt.Errorf("%s", herr.msg)
+	}
+
+	r, err := http.NewRequest("POST", "/runLambda/"+lambda, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	id, err := newId()
+	if err != nil {
+		return 0, nil, err
+	}
+	r.Header.Set(REQUEST_ID_HEADER, id)
+	r.Header.Set(TRIGGER_HEADER, trigger)
+	r.Header.Set("Content-Type", "application/json")
+
+	job := &Job{
+		ID:      id,
+		Lambda:  lambda,
+		Created: time.Now(),
+		req:     r,
+		input:   &payload{data: event, size: int64(len(event)), shared: shared},
+	}
+	s.runJob(job)
+
+	if job.Error != "" {
+		return job.Code, job.Result, fmt.Errorf("%s", job.Error)
+	} else if job.Code >= 500 {
+		return job.Code, job.Result, fmt.Errorf("lambda failed: %s", bytes.TrimSpace(job.Result))
+	}
+	return job.Code, job.Result, nil
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/open-lambda/open-lambda/worker/versions"
+)
+
+// VERSION_HEADER tells the client which version of a lambda ran, for
+// invocations of a version or an alias
+const VERSION_HEADER = "X-Ol-Version"
+
+// resolve returns the lambda (and its handler) an invocation runs: name@N
+// for a version or an alias, or the lambda itself.  It also returns the
+// version (0 for the current code).
+func (s *Server) resolve(lambda string) (string, int, *httpErr) {
+	resolved, version, err := s.aliases.Resolve(lambda)
+	if err == versions.ErrNoAlias {
+		return "", 0, newHttpErr(
+			"No alias for "+lambda,
+			http.StatusNotFound)
+	} else if err != nil {
+		return "", 0, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	return resolved, version, nil
+}
+
+// setVersion tells the client which version of a lambda ran.
+func setVersion(w http.ResponseWriter, version int) {
+	if version > 0 {
+		w.Header().Set(VERSION_HEADER, strconv.Itoa(version))
+	}
+}
+
+// localVersions returns the versions of a lambda, which must be in a local
+// registry.
+func (s *Server) localVersions(name string) ([]int, *httpErr) {
+	if s.config.Registry != "local" {
+		return nil, newHttpErr(
+			fmt.Sprintf("Versions are only managed by the worker with a local registry; with %s, push them as <name>@<N>", s.config.Registry),
+			http.StatusNotImplemented)
+	}
+	list, err := versions.List(s.config.Reg_dir, name)
+	if err != nil {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+	return list, nil
+}
+
+func (s *Server) VersionsErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	if herr := s.authenticateAdmin(r); herr != nil {
+		return herr
+	}
+
+	// components represent versions[0]/<name_of_sandbox>[1]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of lambda required",
+			http.StatusBadRequest)
+	}
+	name := urlParts[1]
+	if _, qualifier := versions.Split(name); qualifier != "" || name == "." || name == ".." {
+		return newHttpErr(
+			"Invalid lambda name "+name,
+			http.StatusBadRequest)
+	}
+
+	list, herr := s.localVersions(name)
+	if herr != nil {
+		return herr
+	}
+
+	switch r.Method {
+	case "GET":
+		return writeJson(w, map[string]interface{}{"name": name, "versions": list})
+	case "POST":
+		version, err := versions.Publish(s.config.Reg_dir, name)
+		if os.IsNotExist(err) {
+			return newHttpErr(
+				"No code for lambda "+name,
+				http.StatusNotFound)
+		} else if err != nil {
+			return newHttpErr(
+				err.Error(),
+				http.StatusInternalServerError)
+		}
+		log.Printf("published version %d of %s\n", version, name)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		return writeJson(w, map[string]interface{}{"name": name, "version": version})
+	default:
+		return newHttpErr(
+			"Method not allowed",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// Versions lists the versions of a lambda, or publishes its current code as
+// a new version (with a local registry):
+//
+// curl localhost:8080/versions/<lambda-name>
+// curl -X POST localhost:8080/versions/<lambda-name>
+func (s *Server) Versions(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.VersionsErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
+
+func (s *Server) AliasesErr(w http.ResponseWriter, r *http.Request) *httpErr {
+	if herr := s.authenticateAdmin(r); herr != nil {
+		return herr
+	}
+
+	// components represent aliases[0]/<name_of_sandbox>[1]/<alias>[2]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of lambda required",
+			http.StatusBadRequest)
+	}
+	name := urlParts[1]
+
+	if len(urlParts) < 3 {
+		if r.Method != "GET" {
+			return newHttpErr(
+				"Method not allowed",
+				http.StatusMethodNotAllowed)
+		}
+		return writeJson(w, s.aliases.List(name))
+	}
+	alias := urlParts[2]
+
+	switch r.Method {
+	case "GET":
+		target, err := s.aliases.Get(name, alias)
+		if err == versions.ErrNoAlias {
+			return newHttpErr(
+				fmt.Sprintf("No alias %s of %s", alias, name),
+				http.StatusNotFound)
+		}
+		return writeJson(w, target)
+	case "PUT":
+		if !versions.ValidAliasName(alias) {
+			return newHttpErr(
+				"Invalid alias name "+alias,
+				http.StatusBadRequest)
+		}
+
+		var target versions.Alias
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			return newHttpErr(
+				"Could not parse alias: "+err.Error(),
+				http.StatusBadRequest)
+		}
+		if err := target.Validate(); err != nil {
+			return newHttpErr(
+				err.Error(),
+				http.StatusBadRequest)
+		}
+
+		// with a local registry, aliases may only point to
+		// published versions
+		if s.config.Registry == "local" {
+			list, herr := s.localVersions(name)
+			if herr != nil {
+				return herr
+			}
+			for _, version := range []int{target.Version, target.Canary} {
+				if version > 0 && !containsInt(list, version) {
+					return newHttpErr(
+						fmt.Sprintf("No version %d of %s", version, name),
+						http.StatusBadRequest)
+				}
+			}
+		}
+
+		if err := s.aliases.Set(name, alias, target); err != nil {
+			return newHttpErr(
+				err.Error(),
+				http.StatusInternalServerError)
+		}
+		log.Printf("alias %s of %s now points to %+v\n", alias, name, target)
+		return writeJson(w, target)
+	case "DELETE":
+		err := s.aliases.Delete(name, alias)
+		if err == versions.ErrNoAlias {
+			return newHttpErr(
+				fmt.Sprintf("No alias %s of %s", alias, name),
+				http.StatusNotFound)
+		} else if err != nil {
+			return newHttpErr(
+				err.Error(),
+				http.StatusInternalServerError)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	default:
+		return newHttpErr(
+			"Method not allowed",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// Aliases lists, sets and deletes the aliases of a lambda, invoked as
+// <lambda-name>@<alias>:
+//
+// curl localhost:8080/aliases/<lambda-name>
+// curl -X PUT localhost:8080/aliases/<lambda-name>/<alias> -d '{"version": 3, "canary": 4, "weight": 0.1}'
+// curl -X DELETE localhost:8080/aliases/<lambda-name>/<alias>
+func (s *Server) Aliases(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if err := s.AliasesErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
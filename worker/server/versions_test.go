@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	s, sm, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+	writeLambdaConfig(t, sm, "f", `{}`)
+
+	request := func(method string, path string, body string, handle http.HandlerFunc) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handle(w, r)
+		return w
+	}
+
+	for expected := 1; expected <= 2; expected++ {
+		w := request("POST", "/versions/f", "", s.Versions)
+		var published struct{ Version int }
+		if err := json.Unmarshal(w.Body.Bytes(), &published); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusCreated || published.Version != expected {
+			t.Fatalf("Expected version %d to be published, got %d: %s", expected, w.Code, w.Body.String())
+		}
+	}
+	w := request("GET", "/versions/f", "", s.Versions)
+	var list struct{ Versions []int }
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %s", w.Body.String())
+	}
+
+	if w := request("PUT", "/aliases/f/prod", `{"version": 3}`, s.Aliases); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an alias to a missing version, got %d", w.Code)
+	}
+	if w := request("PUT", "/aliases/f/prod", `{"version": 1, "canary": 2, "weight": 0.5}`, s.Aliases); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// invokes a lambda, and returns the version that ran
+	invoke := func(lambda string) string {
+		w := request("POST", "/runLambda/"+lambda, "{}", s.RunLambda)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from %s, got %d: %s", lambda, w.Code, w.Body.String())
+		}
+		return w.Header().Get(VERSION_HEADER)
+	}
+
+	if version := invoke("f"); version != "" {
+		t.Fatalf("Expected no version for the current code, got %s", version)
+	}
+	if version := invoke("f@2"); version != "2" {
+		t.Fatalf("Expected version 2, got %q", version)
+	}
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		counts[invoke("f@prod")] += 1
+	}
+	if counts["1"] == 0 || counts["2"] == 0 || counts["1"]+counts["2"] != 100 {
+		t.Fatalf("Expected invocations of f@prod to be split between versions 1 and 2, got %v", counts)
+	}
+	if s.handlers.Lookup("f@1") == nil || s.handlers.Lookup("f@2") == nil {
+		t.Fatalf("Expected a handler for each version")
+	}
+
+	if w := request("DELETE", "/aliases/f/prod", "", s.Aliases); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w := request("POST", "/runLambda/f@prod", "{}", s.RunLambda); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a deleted alias, got %d", w.Code)
+	}
+}
+
+func TestAliasesNeedAdmin(t *testing.T) {
+	s, sm, cleanup := newFakeServer(t, http.NotFoundHandler())
+	defer cleanup()
+	writeLambdaConfig(t, sm, "echo", `{}`)
+	s.auth = newTestAuthenticator(t)
+
+	put := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PUT", "/aliases/echo/prod", strings.NewReader(`{"version": 1}`))
+		r.Header.Set(API_KEY_HEADER, key)
+		w := httptest.NewRecorder()
+		s.Aliases(w, r)
+		return w
+	}
+
+	// a key that may invoke the lambda may not redirect its traffic
+	if w := put("s3cret"); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 without an admin key, got %d", w.Code)
+	}
+	if w := put("4dmin"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "version") {
+		t.Fatalf("Expected the body to be checked for an admin key, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal WebSocket (RFC 6455) server connection, enough to relay
+// messages between clients and lambdas.
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// WebSocket close codes
+const (
+	wsCloseNormal   = 1000
+	wsCloseProtocol = 1002
+	wsCloseTooLarge = 1009
+	wsCloseError    = 1011
+)
+
+const wsGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// how long writing a frame may take, so a client that stops reading
+// cannot hold up the lambda's responses forever
+const WS_WRITE_TIMEOUT = 10 * time.Second
+
+var (
+	// errWsClosed is returned by ReadMessage once the connection is
+	// closed by the client
+	errWsClosed = errors.New("websocket closed")
+
+	errWsTooLarge = errors.New("websocket message too large")
+	errWsProtocol = errors.New("websocket protocol error")
+)
+
+// wsConn is a server-side WebSocket connection.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	wmutex sync.Mutex
+	closed bool
+
+	// largest message accepted from the client (0 means unlimited)
+	maxSize int64
+}
+
+// headerHasToken tells whether a comma-separated header contains a token.
+func headerHasToken(h http.Header, name string, token string) bool {
+	for _, value := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkHandshake tells whether a request is a valid WebSocket handshake.
+func checkHandshake(r *http.Request) *httpErr {
+	if r.Method != "GET" {
+		return newHttpErr(
+			"WebSocket handshake must be a GET",
+			http.StatusMethodNotAllowed)
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return newHttpErr(
+			"WebSocket upgrade required",
+			http.StatusUpgradeRequired)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		herr := newHttpErr(
+			"Unsupported WebSocket version",
+			http.StatusUpgradeRequired)
+		herr.headers = map[string]string{"Sec-WebSocket-Version": "13"}
+		return herr
+	}
+	if r.Header.Get("Sec-WebSocket-Key") == "" {
+		return newHttpErr(
+			"Missing Sec-WebSocket-Key",
+			http.StatusBadRequest)
+	}
+	return nil
+}
+
+// upgradeWebSocket completes the WebSocket handshake of a request and takes
+// over its connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, *httpErr) {
+	if herr := checkHandshake(r); herr != nil {
+		return nil, herr
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, newHttpErr(
+			"Connection cannot be upgraded",
+			http.StatusInternalServerError)
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	hash := sha1.Sum([]byte(key + wsGuid))
+	accept := base64.StdEncoding.EncodeToString(hash[:])
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n"
+	for _, name := range []string{REQUEST_ID_HEADER} {
+		if value := w.Header().Get(name); value != "" {
+			response += name + ": " + value + "\r\n"
+		}
+	}
+	response += "\r\n"
+
+	if _, err := rw.WriteString(response); err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// readFrame reads one frame from the client.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+
+	// clients must mask their frames, and use no extensions
+	if !masked || head[0]&0x70 != 0 {
+		return false, 0, nil, errWsProtocol
+	}
+
+	length := int64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return false, 0, nil, errWsProtocol
+		}
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, errWsProtocol
+	}
+	if c.maxSize > 0 && length > c.maxSize {
+		return false, 0, nil, errWsTooLarge
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// ReadMessage returns the next text or binary message from the client,
+// answering pings along the way.  It returns errWsClosed once the client
+// closes the connection.
+func (c *wsConn) ReadMessage() (opcode byte, msg []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err == errWsTooLarge {
+			c.Close(wsCloseTooLarge, err.Error())
+			return 0, nil, err
+		} else if err == errWsProtocol {
+			c.Close(wsCloseProtocol, err.Error())
+			return 0, nil, err
+		} else if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.Close(wsCloseNormal, "")
+			return 0, nil, errWsClosed
+		case wsText, wsBinary:
+			if msg != nil {
+				c.Close(wsCloseProtocol, "expected continuation")
+				return 0, nil, errWsProtocol
+			}
+			opcode = op
+			msg = payload
+		case wsContinuation:
+			if msg == nil {
+				c.Close(wsCloseProtocol, "unexpected continuation")
+				return 0, nil, errWsProtocol
+			}
+			msg = append(msg, payload...)
+		default:
+			c.Close(wsCloseProtocol, "unknown opcode")
+			return 0, nil, errWsProtocol
+		}
+
+		if c.maxSize > 0 && int64(len(msg)) > c.maxSize {
+			c.Close(wsCloseTooLarge, errWsTooLarge.Error())
+			return 0, nil, errWsTooLarge
+		}
+		if fin {
+			return opcode, msg, nil
+		}
+	}
+}
+
+// writeFrame sends one unfragmented frame to the client.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+
+	if c.closed {
+		return errWsClosed
+	}
+
+	head := []byte{0x80 | opcode}
+	length := len(payload)
+	switch {
+	case length < 126:
+		head = append(head, byte(length))
+	case length <= 0xFFFF:
+		head = append(head, 126, 0, 0)
+		binary.BigEndian.PutUint16(head[2:], uint16(length))
+	default:
+		head = append(head, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(length))
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT)); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(append(head, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteMessage sends a text or binary message to the client.
+func (c *wsConn) WriteMessage(opcode byte, msg []byte) error {
+	return c.writeFrame(opcode, msg)
+}
+
+// Close sends a close frame (if not sent yet) and closes the connection.
+func (c *wsConn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+
+	// best effort; the client may be gone already
+	c.writeFrame(wsClose, payload)
+
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+func (c *wsConn) String() string {
+	return fmt.Sprintf("websocket %s", c.conn.RemoteAddr())
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-lambda/open-lambda/worker/handler"
+	"github.com/open-lambda/open-lambda/worker/metrics"
+	"github.com/open-lambda/open-lambda/worker/workflow"
+)
+
+func (s *Server) RunWorkflowErr(w http.ResponseWriter, r *http.Request) (herr *httpErr) {
+	setRequestId(w, r)
+
+	// components represent runWorkflow[0]/<name_of_workflow>[1]
+	urlParts := getUrlComponents(r)
+	if len(urlParts) < 2 {
+		return newHttpErr(
+			"Name of workflow to run required",
+			http.StatusBadRequest)
+	}
+	name := urlParts[1]
+	if name == "." || name == ".." {
+		return newHttpErr(
+			"Invalid workflow name",
+			http.StatusBadRequest)
+	}
+
+	t0 := time.Now()
+	code := http.StatusOK
+	phases := handler.NewPhases()
+	entry := newAccessEntry(r, name)
+	tr := s.startTrace(r, name)
+	if tr != nil {
+		tr.span.Name = "workflow " + name
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	defer func() {
+		if herr != nil {
+			code = herr.code
+			entry.Error = herr.msg
+		}
+		entry.BytesOut = cw.n
+		s.logAccess(entry, code, t0, phases)
+		s.endTrace(tr, code, entry.Error, phases)
+	}()
+
+	wf, err := workflow.Load(filepath.Join(s.config.Workflow_dir, name+".json"))
+	if os.IsNotExist(err) {
+		return newHttpErr(
+			"No workflow named "+name,
+			http.StatusNotFound)
+	} else if err != nil {
+		return newHttpErr(
+			err.Error(),
+			http.StatusInternalServerError)
+	}
+
+	// the client must be allowed to invoke every lambda of the workflow
+	for _, lambda := range wf.Lambdas() {
+		if herr := s.authenticateHeaders(r, lambda); herr != nil {
+			return herr
+		}
+	}
+
+	// the input is passed on to steps as JSON, so it is never staged
+	input, herr := readPayload(r, sizeLimit(s.config.Max_body_size, 0), 0, "")
+	if herr != nil {
+		return herr
+	}
+	entry.BytesIn = input.size
+
+	// the client must be allowed to invoke every lambda of the workflow
+	for _, lambda := range wf.Lambdas() {
+		if herr := s.authenticate(r, lambda, input); herr != nil {
+			return herr
+		}
+	}
+
+	traceparent := tr.traceparent()
+	invoke := func(step string, lambda string, event []byte) (int, []byte, error) {
+		t1 := time.Now()
+		lambda, _, herr := s.resolve(lambda)
+		if herr != nil {
+			return herr.code, nil, errors.New(herr.msg)
+		}
+		req := subRequest(r, step, traceparent)
+		req.Method = "POST"
+		req.URL = &url.URL{Path: "/runLambda/" + lambda}
+
+		result := s.forwardEvent(s.handlers.Get(lambda), req, json.RawMessage(event), phases)
+		metrics.ObserveInvocation(lambda, result.Status, time.Since(t1))
+		if result.Error != "" {
+			return result.Status, nil, errors.New(result.Error)
+		}
+		return result.Status, result.Result, nil
+	}
+
+	result := wf.Run(input.data, invoke, s.config.Batch_concurrency)
+	if result.Status != workflow.Succeeded {
+		code = http.StatusInternalServerError
+		entry.Error = result.Error
+	}
+
+	cw.Header().Set("Content-Type", "application/json")
+	cw.WriteHeader(code)
+	return writeJson(cw, result)
+}
+
+// RunWorkflow runs a workflow (a DAG of lambda invocations, defined in
+// <workflow_dir>/<name>.json) on an input, and returns its output and how
+// each step went:
+//
+// curl -X POST localhost:8080/runWorkflow/<workflow-name> -d '{"text": "..."}'
+func (s *Server) RunWorkflow(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Receive request to %s\n", r.URL.Path)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.RunWorkflowErr(w, r); err != nil {
+		log.Printf("could not handle request: %s\n", err.msg)
+		err.write(w)
+	}
+}
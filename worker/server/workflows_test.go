@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-lambda/open-lambda/worker/workflow"
+)
+
+func TestRunWorkflow(t *testing.T) {
+	// every lambda runs this: an object with text is split in words, a
+	// word is replaced with its length, and an array of numbers is summed
+	lambda := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event interface{}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &event)
+		switch e := event.(type) {
+		case map[string]interface{}:
+			text, _ := e["text"].(string)
+			json.NewEncoder(w).Encode(map[string]interface{}{"words": strings.Fields(text)})
+		case string:
+			json.NewEncoder(w).Encode(len(e))
+		case []interface{}:
+			sum := 0.0
+			for _, n := range e {
+				sum += n.(float64)
+			}
+			json.NewEncoder(w).Encode(sum)
+		default:
+			http.Error(w, "unexpected event", http.StatusBadRequest)
+		}
+	})
+
+	s, _, cleanup := newFakeServer(t, lambda)
+	defer cleanup()
+
+	wf := `{"steps": {
+		"split": {"lambda": "split", "input": {"text": "$.input.text"}},
+		"len": {"lambda": "len", "after": ["split"], "for_each": "$.steps.split.words"},
+		"sum": {"lambda": "sum", "after": ["len"]}},
+	 "output": {"letters": "$.steps.sum"}}`
+	if err := os.MkdirAll(s.config.Workflow_dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(s.config.Workflow_dir, "letters.json")
+	if err := ioutil.WriteFile(path, []byte(wf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/runWorkflow/letters", strings.NewReader(`{"text": "a bb ccc"}`))
+	w := httptest.NewRecorder()
+	s.RunWorkflow(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result workflow.Result
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := json.Marshal(result.Output); string(out) != `{"letters":6}` {
+		t.Fatalf("Expected 6 letters, got %s", out)
+	}
+	if len(result.Steps) != 3 || result.Steps[1].Step != "len" || result.Steps[1].Attempts != 3 {
+		t.Fatalf("Expected len invoked on 3 words, got %+v", result.Steps)
+	}
+
+	// without text, the input of split cannot be mapped
+	r = httptest.NewRequest("POST", "/runWorkflow/letters", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	s.RunWorkflow(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/runWorkflow/missing", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	s.RunWorkflow(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", w.Code)
+	}
+}
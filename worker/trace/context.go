@@ -0,0 +1,116 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// headers of the W3C Trace Context
+const (
+	TRACEPARENT_HEADER = "Traceparent"
+	TRACESTATE_HEADER  = "Tracestate"
+)
+
+// TraceId identifies a trace.
+type TraceId [16]byte
+
+// SpanId identifies a span within a trace.
+type SpanId [8]byte
+
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid tells whether the ID is set (not all zeros).
+func (id TraceId) IsValid() bool {
+	return id != TraceId{}
+}
+
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid tells whether the ID is set (not all zeros).
+func (id SpanId) IsValid() bool {
+	return id != SpanId{}
+}
+
+// NewTraceId returns a random TraceId.
+func NewTraceId() TraceId {
+	var id TraceId
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// NewSpanId returns a random SpanId.
+func NewSpanId() SpanId {
+	var id SpanId
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// SpanContext is the part of a span that is propagated to other services.
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Sampled bool
+	State   string // tracestate, passed on as is
+}
+
+// ParseTraceparent parses the traceparent (and tracestate) headers of a
+// request.  It returns false if traceparent is missing or invalid.
+func ParseTraceparent(traceparent string, tracestate string) (SpanContext, bool) {
+	var ctx SpanContext
+
+	// version-traceid-spanid-flags; later versions may add fields
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return ctx, false
+	}
+
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return ctx, false
+	}
+	if !decodeHex(parts[1], ctx.TraceId[:]) || !ctx.TraceId.IsValid() {
+		return ctx, false
+	}
+	if !decodeHex(parts[2], ctx.SpanId[:]) || !ctx.SpanId.IsValid() {
+		return ctx, false
+	}
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) {
+		return ctx, false
+	}
+
+	ctx.Sampled = flags[0]&1 == 1
+	ctx.State = tracestate
+	return ctx, true
+}
+
+// decodeHex decodes lowercase hex of exactly len(dst) bytes.
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Traceparent formats the traceparent header for the context.
+func (c SpanContext) Traceparent() string {
+	flags := 0
+	if c.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", c.TraceId, c.SpanId, flags)
+}
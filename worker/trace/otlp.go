@@ -0,0 +1,202 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP/JSON encoding of spans (see opentelemetry-proto), as accepted by
+// OpenTelemetry collectors on /v1/traces.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 means error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// EncodeOTLP encodes spans as an OTLP/JSON export request, with the given
+// attributes (e.g., service.name) for the resource that produced them.
+func EncodeOTLP(spans []*Span, resource map[string]interface{}) ([]byte, error) {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceId:           span.TraceId.String(),
+			SpanId:            span.SpanId.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.ParentId.IsValid() {
+			s.ParentSpanId = span.ParentId.String()
+		}
+		if span.Error != "" {
+			s.Status = &otlpStatus{Code: 2, Message: span.Error}
+		}
+		encoded = append(encoded, s)
+	}
+
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: otlpAttributes(resource)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "open-lambda"},
+				Spans: encoded,
+			}},
+		}},
+	}
+	return json.Marshal(req)
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attrs[key].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: value})
+	}
+	return kvs
+}
+
+// OpenExporter creates an Exporter of OTLP/JSON for a destination named in
+// the worker config: the URL of a collector (e.g.,
+// http://localhost:4318/v1/traces), or else the path of a file, to which one
+// export request is appended per line.
+func OpenExporter(dest string, resource map[string]interface{}) (Exporter, error) {
+	if strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://") {
+		return &HttpExporter{
+			url:      dest,
+			resource: resource,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open trace file (%v): %v", dest, err)
+	}
+	return &FileExporter{file: f, resource: resource}, nil
+}
+
+// FileExporter appends OTLP/JSON export requests to a file, one per line.
+type FileExporter struct {
+	mutex    sync.Mutex
+	file     *os.File
+	resource map[string]interface{}
+}
+
+func (e *FileExporter) Export(spans []*Span) error {
+	line, err := EncodeOTLP(spans, e.resource)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.file.Write(line)
+	return err
+}
+
+func (e *FileExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.file.Close()
+}
+
+// HttpExporter POSTs OTLP/JSON export requests to a collector.
+type HttpExporter struct {
+	url      string
+	resource map[string]interface{}
+	client   *http.Client
+}
+
+func (e *HttpExporter) Export(spans []*Span) error {
+	body, err := EncodeOTLP(spans, e.resource)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("collector returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (e *HttpExporter) Close() error {
+	return nil
+}
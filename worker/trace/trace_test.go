@@ -0,0 +1,161 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx, ok := ParseTraceparent(header, "vendor=1")
+	if !ok {
+		t.Fatalf("Could not parse %s", header)
+	}
+	if ctx.TraceId.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || ctx.SpanId.String() != "00f067aa0ba902b7" {
+		t.Fatalf("Unexpected context %+v", ctx)
+	}
+	if !ctx.Sampled || ctx.State != "vendor=1" {
+		t.Fatalf("Unexpected context %+v", ctx)
+	}
+	if ctx.Traceparent() != header {
+		t.Fatalf("Expected %s, got %s", header, ctx.Traceparent())
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, header := range invalid {
+		if _, ok := ParseTraceparent(header, ""); ok {
+			t.Errorf("Expected %q to be invalid", header)
+		}
+	}
+
+	// later versions may have more fields
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", ""); !ok {
+		t.Errorf("Expected future version to be accepted")
+	}
+}
+
+func TestFileExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spans.json")
+	exporter, err := OpenExporter(path, map[string]interface{}{"service.name": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewTracer(exporter)
+
+	root := &Span{TraceId: NewTraceId(), SpanId: NewSpanId(), Name: "invoke", Kind: KindServer,
+		Start: time.Now(), End: time.Now(), Attributes: map[string]interface{}{"http.status_code": 500}}
+	child := &Span{TraceId: root.TraceId, SpanId: NewSpanId(), ParentId: root.SpanId, Name: "pull",
+		Kind: KindInternal, Start: time.Now(), End: time.Now(), Error: "failed"}
+	tracer.Record(root)
+	tracer.Record(child)
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatalf("Expected an export request in %s", path)
+	}
+	var req otlpRequest
+	if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].ParentSpanId != "" || spans[1].ParentSpanId != root.SpanId.String() {
+		t.Fatalf("Unexpected parents in %+v", spans)
+	}
+	if spans[0].Attributes[0].Value["intValue"] != "500" {
+		t.Fatalf("Unexpected attributes %+v", spans[0].Attributes)
+	}
+	if spans[1].Status == nil || spans[1].Status.Code != 2 {
+		t.Fatalf("Expected error status, got %+v", spans[1].Status)
+	}
+}
+
+// countingExporter counts the spans it exports.
+type countingExporter struct {
+	mutex sync.Mutex
+	spans int
+}
+
+func (e *countingExporter) Export(spans []*Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans += len(spans)
+	return nil
+}
+
+func (e *countingExporter) Close() error {
+	return nil
+}
+
+func TestRecordWhileClosing(t *testing.T) {
+	exporter := &countingExporter{}
+	tracer := NewTracer(exporter)
+
+	// requests still running at shutdown record spans during and
+	// after Close
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					tracer.Record(&Span{Name: "invoke"})
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	exporter.mutex.Lock()
+	exported := exporter.spans
+	exporter.mutex.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if exported == 0 || exporter.spans != exported {
+		t.Fatalf("Expected spans recorded after Close to be dropped, got %d then %d", exported, exporter.spans)
+	}
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
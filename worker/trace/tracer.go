@@ -0,0 +1,160 @@
+package trace
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// SpanKind tells the role of a span, as in OpenTelemetry.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span is a finished operation of a trace.
+type Span struct {
+	TraceId    TraceId
+	SpanId     SpanId
+	ParentId   SpanId // not valid for the root of a trace
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{} // string, int, int64, float64 or bool
+	Error      string                 // the span failed if not empty
+}
+
+// Exporter sends spans somewhere, e.g., to a collector.
+type Exporter interface {
+	Export(spans []*Span) error
+	Close() error
+}
+
+const (
+	// spans waiting to be exported; more are dropped
+	MAX_QUEUED_SPANS = 4096
+
+	// spans are exported in batches of up to this many, or after this
+	// long, whichever comes first
+	EXPORT_BATCH_SIZE = 512
+	EXPORT_INTERVAL   = 5 * time.Second
+)
+
+// Tracer exports spans in batches, in the background.  A nil *Tracer drops
+// them.
+type Tracer struct {
+	exporter Exporter
+	queue    chan *Span
+	stop     chan bool
+	done     sync.WaitGroup
+	mutex    sync.Mutex
+	dropped  int
+	closed   bool // spans are dropped once closed
+}
+
+// NewTracer creates a Tracer that sends spans to an Exporter.
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		queue:    make(chan *Span, MAX_QUEUED_SPANS),
+		stop:     make(chan bool),
+	}
+
+	t.done.Add(1)
+	go t.run()
+
+	return t
+}
+
+// Record queues a finished span for export.  It never blocks; spans are
+// dropped if the exporter cannot keep up, or once the Tracer is closed.
+func (t *Tracer) Record(span *Span) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		t.dropped += 1
+	}
+}
+
+// Close exports the queued spans and closes the exporter.  Spans recorded
+// after Close are dropped.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+
+	// the queue is never closed, as requests may still be recording
+	// spans
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.stop)
+	t.mutex.Unlock()
+
+	t.done.Wait()
+	return t.exporter.Close()
+}
+
+func (t *Tracer) run() {
+	defer t.done.Done()
+
+	ticker := time.NewTicker(EXPORT_INTERVAL)
+	defer ticker.Stop()
+
+	batch := []*Span{}
+	for {
+		select {
+		case <-t.stop:
+			// nothing is queued once stopped
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+			}
+			t.export(batch)
+			return
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) < EXPORT_BATCH_SIZE {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		t.export(batch)
+		batch = []*Span{}
+	}
+}
+
+func (t *Tracer) export(batch []*Span) {
+	t.mutex.Lock()
+	dropped := t.dropped
+	t.dropped = 0
+	t.mutex.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Dropped %d spans, as the exporter could not keep up\n", dropped)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.exporter.Export(batch); err != nil {
+		log.Printf("could not export %d spans: %v\n", len(batch), err)
+	}
+}
@@ -0,0 +1,195 @@
+package versions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNoAlias is returned for aliases that do not exist.
+var ErrNoAlias = errors.New("no such alias")
+
+// Alias points to a version of a lambda, or splits invocations between two
+// versions:
+//
+//	{"version": 3, "canary": 4, "weight": 0.1}
+//
+// sends 10% of the invocations to version 4, and the rest to version 3.
+type Alias struct {
+	Version int `json:"version"`
+
+	// another version, and the fraction of invocations (0 to 1) it gets
+	Canary int     `json:"canary,omitempty"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// Validate checks the versions and weight of an alias.
+func (a *Alias) Validate() error {
+	if a.Version <= 0 {
+		return fmt.Errorf("alias needs a version")
+	}
+	if a.Canary < 0 || (a.Canary == 0 && a.Weight != 0) {
+		return fmt.Errorf("alias has a weight but no canary version")
+	}
+	if a.Weight < 0 || a.Weight > 1 {
+		return fmt.Errorf("weight of alias must be between 0 and 1, not %v", a.Weight)
+	}
+	return nil
+}
+
+// Pick returns the version an invocation goes to, given x uniformly drawn in
+// [0, 1).
+func (a *Alias) Pick(x float64) int {
+	if a.Canary > 0 && x < a.Weight {
+		return a.Canary
+	}
+	return a.Version
+}
+
+// ValidAliasName tells whether a string may name an alias: it must not be a
+// version number, or contain "/" or "@".
+func ValidAliasName(alias string) bool {
+	return alias != "" && strings.Trim(alias, "0123456789") != "" && !strings.ContainsAny(alias, "/@")
+}
+
+// Aliases holds the aliases of every lambda, saved in a JSON file that maps
+// lambda names to their aliases.
+type Aliases struct {
+	mutex   sync.Mutex
+	path    string
+	aliases map[string]map[string]Alias
+}
+
+// LoadAliases reads the aliases saved in a file (none if the file does not
+// exist yet).
+func LoadAliases(path string) (*Aliases, error) {
+	a := &Aliases{path: path, aliases: make(map[string]map[string]Alias)}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &a.aliases); err != nil {
+		return nil, fmt.Errorf("could not parse aliases (%v): %v", path, err)
+	}
+	return a, nil
+}
+
+// save writes the aliases to their file.  The caller must hold the mutex.
+func (a *Aliases) save() error {
+	raw, err := json.MarshalIndent(a.aliases, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// Get returns an alias of a lambda.
+func (a *Aliases) Get(name string, alias string) (Alias, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if target, ok := a.aliases[name][alias]; ok {
+		return target, nil
+	}
+	return Alias{}, ErrNoAlias
+}
+
+// List returns the aliases of a lambda.
+func (a *Aliases) List(name string) map[string]Alias {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	list := make(map[string]Alias, len(a.aliases[name]))
+	for alias, target := range a.aliases[name] {
+		list[alias] = target
+	}
+	return list
+}
+
+// Set creates or changes an alias of a lambda, and saves the aliases.
+func (a *Aliases) Set(name string, alias string, target Alias) error {
+	if !ValidAliasName(alias) {
+		return fmt.Errorf("invalid alias name %q", alias)
+	}
+	if err := target.Validate(); err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	old, existed := a.aliases[name][alias]
+	if a.aliases[name] == nil {
+		a.aliases[name] = make(map[string]Alias)
+	}
+	a.aliases[name][alias] = target
+	if err := a.save(); err != nil {
+		if existed {
+			a.aliases[name][alias] = old
+		} else {
+			delete(a.aliases[name], alias)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes an alias of a lambda, and saves the aliases.
+func (a *Aliases) Delete(name string, alias string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	old, ok := a.aliases[name][alias]
+	if !ok {
+		return ErrNoAlias
+	}
+	delete(a.aliases[name], alias)
+	if len(a.aliases[name]) == 0 {
+		delete(a.aliases, name)
+	}
+	if err := a.save(); err != nil {
+		if a.aliases[name] == nil {
+			a.aliases[name] = make(map[string]Alias)
+		}
+		a.aliases[name][alias] = old
+		return err
+	}
+	return nil
+}
+
+// Resolve returns the lambda an invocation of another one runs: the same
+// lambda if it is unqualified or names a version, or else the version its
+// alias points to (picked at random by weight, for split aliases).  It also
+// returns the version (0 for the current code).
+func (a *Aliases) Resolve(lambda string) (string, int, error) {
+	name, qualifier := Split(lambda)
+	if name == lambda {
+		return lambda, 0, nil
+	}
+	if version, ok := Version(qualifier); ok {
+		return Qualified(name, version), version, nil
+	}
+
+	target, err := a.Get(name, qualifier)
+	if err != nil {
+		return "", 0, err
+	}
+	version := target.Pick(rand.Float64())
+	return Qualified(name, version), version, nil
+}
@@ -0,0 +1,153 @@
+package versions
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lambdas are invoked as <name> (the current code), <name>@<version> (a
+// numbered version, whose code never changes) or <name>@<alias> (the
+// version, or one of the two versions, an alias points to).
+
+// Split splits a lambda like "f@prod" into its name ("f") and its qualifier
+// ("prod", or "" if there is none).
+func Split(lambda string) (name string, qualifier string) {
+	if i := strings.IndexByte(lambda, '@'); i >= 0 {
+		return lambda[:i], lambda[i+1:]
+	}
+	return lambda, ""
+}
+
+// Qualified returns the lambda for a version of a name, e.g., "f@3".
+func Qualified(name string, version int) string {
+	return fmt.Sprintf("%s@%d", name, version)
+}
+
+// Version parses a qualifier that is a version number.
+func Version(qualifier string) (int, bool) {
+	if qualifier == "" || strings.Trim(qualifier, "0123456789") != "" {
+		return 0, false
+	}
+	version, err := strconv.Atoi(qualifier)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// List returns the versions of a lambda whose code is in <dir>/<name>@<N>
+// directories (as with a local registry), in order.
+func List(dir string, name string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []int{}
+	for _, file := range files {
+		base, qualifier := Split(file.Name())
+		if version, ok := Version(qualifier); ok && base == name && file.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Publish copies the current code of a lambda, in <dir>/<name>, to a new
+// version, <dir>/<name>@<N>, and returns N.  The files of the copy are
+// read-only.
+func Publish(dir string, name string) (int, error) {
+	src := filepath.Join(dir, name)
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	} else if !info.IsDir() {
+		return 0, fmt.Errorf("%s is not a directory", src)
+	}
+
+	versions, err := List(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1] + 1
+	}
+
+	// copy to a temporary directory first, so a version is never seen
+	// half copied
+	dst := filepath.Join(dir, Qualified(name, version))
+	tmp, err := ioutil.TempDir(dir, "."+name+"@")
+	if err != nil {
+		return 0, err
+	}
+	if err := copyTree(src, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return 0, err
+	}
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		os.RemoveAll(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.RemoveAll(tmp)
+		return 0, err
+	}
+	return version, nil
+}
+
+// copyTree copies a directory recursively, without write permissions on the
+// files.
+func copyTree(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm()&^0222)
+		default:
+			return nil // sockets, devices, etc.
+		}
+	})
+}
+
+// copyFile copies a regular file.
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode|0400)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
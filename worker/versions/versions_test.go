@@ -0,0 +1,126 @@
+package versions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	for lambda, expected := range map[string][2]string{
+		"f":      {"f", ""},
+		"f@3":    {"f", "3"},
+		"f@prod": {"f", "prod"},
+	} {
+		if name, qualifier := Split(lambda); name != expected[0] || qualifier != expected[1] {
+			t.Fatalf("Expected %v for %s, got %s %s", expected, lambda, name, qualifier)
+		}
+	}
+
+	for qualifier, expected := range map[string]int{"3": 3, "12": 12, "0": 0, "prod": 0, "": 0, "-1": 0} {
+		if version, _ := Version(qualifier); version != expected {
+			t.Fatalf("Expected version %d for %q, got %d", expected, qualifier, version)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	code := filepath.Join(dir, "f")
+	os.MkdirAll(filepath.Join(code, "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(code, "lambda_func.py"), []byte("v1"), 0644)
+	ioutil.WriteFile(filepath.Join(code, "lib", "util.py"), []byte("util"), 0644)
+
+	if version, err := Publish(dir, "f"); err != nil || version != 1 {
+		t.Fatalf("Expected version 1, got %d (%v)", version, err)
+	}
+	ioutil.WriteFile(filepath.Join(code, "lambda_func.py"), []byte("v2"), 0644)
+	if version, err := Publish(dir, "f"); err != nil || version != 2 {
+		t.Fatalf("Expected version 2, got %d (%v)", version, err)
+	}
+
+	if versions, err := List(dir, "f"); err != nil || len(versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %v (%v)", versions, err)
+	}
+	if raw, _ := ioutil.ReadFile(filepath.Join(dir, "f@1", "lambda_func.py")); string(raw) != "v1" {
+		t.Fatalf("Expected version 1 to keep its code, got %q", raw)
+	}
+	if raw, _ := ioutil.ReadFile(filepath.Join(dir, "f@2", "lib", "util.py")); string(raw) != "util" {
+		t.Fatalf("Expected subdirectories to be copied, got %q", raw)
+	}
+	info, err := os.Stat(filepath.Join(dir, "f@2", "lambda_func.py"))
+	if err != nil || info.Mode().Perm()&0222 != 0 {
+		t.Fatalf("Expected read-only code, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "aliases.json")
+
+	a, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Set("f", "3", Alias{Version: 1}); err == nil {
+		t.Fatalf("Expected numeric alias names to be rejected")
+	}
+	if err := a.Set("f", "prod", Alias{Version: 1, Weight: 0.5}); err == nil {
+		t.Fatalf("Expected a weight without canary to be rejected")
+	}
+	if err := a.Set("f", "prod", Alias{Version: 1, Canary: 2, Weight: 0.25}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the aliases survive a reload
+	a, err = LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := a.Get("f", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Pick(0.1) != 2 || target.Pick(0.5) != 1 {
+		t.Fatalf("Expected 25%% of invocations to go to version 2")
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		lambda, _, err := a.Resolve("f@prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[lambda] += 1
+	}
+	if counts["f@2"] < 150 || counts["f@2"] > 350 || counts["f@1"]+counts["f@2"] != 1000 {
+		t.Fatalf("Expected about 250 invocations of f@2, got %v", counts)
+	}
+
+	if lambda, version, _ := a.Resolve("f@7"); lambda != "f@7" || version != 7 {
+		t.Fatalf("Expected f@7, got %s %d", lambda, version)
+	}
+	if lambda, version, _ := a.Resolve("f"); lambda != "f" || version != 0 {
+		t.Fatalf("Expected f, got %s %d", lambda, version)
+	}
+	if _, _, err := a.Resolve("f@dev"); err != ErrNoAlias {
+		t.Fatalf("Expected ErrNoAlias, got %v", err)
+	}
+
+	if err := a.Delete("f", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.List("f")) != 0 {
+		t.Fatalf("Expected no aliases left")
+	}
+}
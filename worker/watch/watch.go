@@ -0,0 +1,177 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// files are reported once written and closed, or moved in whole
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// Watcher reports files landing in directories, using inotify.
+type Watcher struct {
+	mutex  sync.Mutex
+	fd     int
+	file   *os.File         // of fd, read through the runtime poller
+	dirs   map[int32]string // by watch descriptor
+	wds    map[string]int32 // by directory
+	onFile func(dir string, name string)
+	closed bool
+	done   chan bool
+}
+
+// NewWatcher creates a Watcher that calls onFile for each file written to or
+// moved into a watched directory.  onFile should return quickly, and may be
+// called more than once for a file.  Hidden files (whose name starts with a
+// '.') are ignored.
+func NewWatcher(onFile func(dir string, name string)) (*Watcher, error) {
+	// non-blocking, so Close interrupts a pending read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("could not init inotify: %v", err)
+	}
+
+	w := &Watcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int32]string),
+		wds:    make(map[string]int32),
+		onFile: onFile,
+		done:   make(chan bool),
+	}
+	go w.loop()
+
+	return w, nil
+}
+
+// Add starts watching a directory, creating it if needed.  Files already in
+// the directory are reported right away.
+func (w *Watcher) Add(dir string) error {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	if _, ok := w.wds[dir]; ok {
+		w.mutex.Unlock()
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		w.mutex.Unlock()
+		return fmt.Errorf("could not watch %s: %v", dir, err)
+	}
+	w.dirs[int32(wd)] = dir
+	w.wds[dir] = int32(wd)
+	w.mutex.Unlock()
+
+	// files dropped before the watch started (e.g., while the
+	// worker was down)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Mode().IsRegular() && !hidden(file.Name()) {
+			w.onFile(dir, file.Name())
+		}
+	}
+
+	return nil
+}
+
+// Remove stops watching a directory.
+func (w *Watcher) Remove(dir string) error {
+	dir = filepath.Clean(dir)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	wd, ok := w.wds[dir]
+	if !ok {
+		return nil
+	}
+	delete(w.wds, dir)
+	delete(w.dirs, wd)
+
+	if _, err := syscall.InotifyRmWatch(w.fd, uint32(wd)); err != nil {
+		return fmt.Errorf("could not stop watching %s: %v", dir, err)
+	}
+	return nil
+}
+
+// Dirs returns the watched directories.
+func (w *Watcher) Dirs() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	dirs := make([]string, 0, len(w.wds))
+	for dir := range w.wds {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// Close stops watching every directory.
+func (w *Watcher) Close() error {
+	w.mutex.Lock()
+	w.closed = true
+	w.mutex.Unlock()
+
+	err := w.file.Close()
+	<-w.done
+	return err
+}
+
+// loop reads inotify events until the Watcher is closed.
+func (w *Watcher) loop() {
+	defer close(w.done)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			w.mutex.Lock()
+			closed := w.closed
+			w.mutex.Unlock()
+			if !closed {
+				log.Printf("could not read inotify events: %v\n", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				log.Printf("inotify queue overflowed, some files may not be reported until restart\n")
+				continue
+			}
+			if event.Mask&syscall.IN_ISDIR != 0 || event.Len == 0 {
+				continue
+			}
+
+			name := string(bytes.TrimRight(buf[start:offset], "\x00"))
+			w.mutex.Lock()
+			dir, ok := w.dirs[event.Wd]
+			w.mutex.Unlock()
+			if ok && !hidden(name) {
+				w.onFile(dir, name)
+			}
+		}
+	}
+}
+
+func hidden(name string) bool {
+	return len(name) > 0 && name[0] == '.'
+}
@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ol-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := make(chan string, 10)
+	w, err := NewWatcher(func(dir string, name string) {
+		files <- name
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// files already there are reported, hidden ones are not
+	watched := filepath.Join(dir, "in")
+	os.MkdirAll(watched, 0755)
+	ioutil.WriteFile(filepath.Join(watched, "old"), []byte("x"), 0644)
+	ioutil.WriteFile(filepath.Join(watched, ".hidden"), []byte("x"), 0644)
+	if err := w.Add(watched); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(watched, "new"), []byte("x"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "moved"), []byte("x"), 0644)
+	os.Rename(filepath.Join(dir, "moved"), filepath.Join(watched, "moved"))
+	os.Mkdir(filepath.Join(watched, "subdir"), 0755)
+
+	for _, expected := range []string{"old", "new", "moved"} {
+		select {
+		case name := <-files:
+			if name != expected {
+				t.Fatalf("expected %s, got %s", expected, name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not reported", expected)
+		}
+	}
+
+	// nothing is reported once the directory is removed
+	if err := w.Remove(watched); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(watched, "late"), []byte("x"), 0644)
+	select {
+	case name := <-files:
+		t.Fatalf("unexpected file %s", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,134 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isPath tells whether a string of a template is a path into the context.
+func isPath(s string) bool {
+	return s == "$" || strings.HasPrefix(s, "$.") || strings.HasPrefix(s, "$[")
+}
+
+// decode parses JSON, keeping numbers as they are.
+func decode(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// outputValue returns the value of the body of a lambda response: as is if
+// it is JSON, or else as a string.
+func outputValue(body []byte) interface{} {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if v, err := decode(body); err == nil {
+		return v
+	}
+	return string(body)
+}
+
+// render replaces the paths in a template with values from the context.
+// Strings starting with "$$" stand for themselves, minus a "$".
+func render(template interface{}, ctx map[string]interface{}) (interface{}, error) {
+	switch t := template.(type) {
+	case string:
+		if strings.HasPrefix(t, "$$") {
+			return t[1:], nil
+		}
+		if isPath(t) {
+			return lookup(t, ctx)
+		}
+		return t, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			v, err := render(value, ctx)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, value := range t {
+			v, err := render(value, ctx)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	default:
+		return t, nil
+	}
+}
+
+// renderRaw renders a template in JSON.
+func renderRaw(template json.RawMessage, ctx map[string]interface{}) (interface{}, error) {
+	t, err := decode(template)
+	if err != nil {
+		return nil, fmt.Errorf("bad template: %v", err)
+	}
+	return render(t, ctx)
+}
+
+// lookup returns the value at a path like $.steps.split.parts[0] in the
+// context.
+func lookup(path string, ctx map[string]interface{}) (interface{}, error) {
+	var v interface{} = ctx
+	rest := path[1:]
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: .%s of a non-object", path, key)
+			}
+			if v, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("%s: no field %s", path, key)
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: missing ]", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad index %s", path, rest[1:end])
+			}
+			rest = rest[end+1:]
+
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: [%d] of a non-array", path, i)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("%s: index %d out of range", path, i)
+			}
+			v = arr[i]
+		default:
+			return nil, fmt.Errorf("%s: bad path", path)
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,295 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Statuses of a step, and of a workflow
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	Skipped   = "skipped" // a previous step failed
+)
+
+// Invoker invokes the lambda of a step on an event, and returns the status
+// and body of the response.  An error means the lambda could not be invoked.
+type Invoker func(step string, lambda string, event []byte) (int, []byte, error)
+
+// StepRecord tells how a step of a workflow went.
+type StepRecord struct {
+	Step       string     `json:"step"`
+	Lambda     string     `json:"lambda"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`        // over all items
+	Items      *int       `json:"items,omitempty"` // with for_each
+	Code       int        `json:"code,omitempty"`  // of the last attempt
+	Error      string     `json:"error,omitempty"`
+	Started    *time.Time `json:"started,omitempty"`
+	DurationMs float64    `json:"duration_ms"`
+}
+
+// Result is the outcome of a run of a workflow.
+type Result struct {
+	Status string       `json:"status"`
+	Output interface{}  `json:"output"`
+	Error  string       `json:"error,omitempty"`
+	Steps  []StepRecord `json:"steps"`
+}
+
+// run is the state of a run of a workflow.
+type run struct {
+	w      *Workflow
+	invoke Invoker
+	input  interface{}
+	slots  chan bool // bounds the invocations at once
+
+	mutex   sync.Mutex
+	outputs map[string]interface{}
+	records map[string]*StepRecord
+	done    map[string]chan bool
+}
+
+// Run runs the workflow on an input, with up to concurrency invocations at
+// once.
+func (w *Workflow) Run(input []byte, invoke Invoker, concurrency int) *Result {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	r := &run{
+		w:       w,
+		invoke:  invoke,
+		input:   outputValue(input),
+		slots:   make(chan bool, concurrency),
+		outputs: make(map[string]interface{}),
+		records: make(map[string]*StepRecord),
+		done:    make(map[string]chan bool),
+	}
+	for _, name := range w.order {
+		r.records[name] = &StepRecord{Step: name, Lambda: w.Steps[name].Lambda}
+		r.done[name] = make(chan bool)
+	}
+
+	for _, name := range w.order {
+		go r.runStep(name)
+	}
+	for _, name := range w.order {
+		<-r.done[name]
+	}
+
+	result := &Result{Status: Succeeded, Steps: []StepRecord{}}
+	for _, name := range w.order {
+		record := r.records[name]
+		result.Steps = append(result.Steps, *record)
+		if record.Status != Succeeded && result.Status == Succeeded {
+			result.Status = Failed
+			result.Error = fmt.Sprintf("step %s failed: %s", name, record.Error)
+		}
+	}
+	if result.Status != Succeeded {
+		return result
+	}
+
+	output, err := r.output()
+	if err != nil {
+		result.Status = Failed
+		result.Error = fmt.Sprintf("could not map output: %v", err)
+		return result
+	}
+	result.Output = output
+	return result
+}
+
+// context returns the context for templates, with the outputs of the steps
+// done so far.
+func (r *run) context() map[string]interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	steps := make(map[string]interface{}, len(r.outputs))
+	for name, output := range r.outputs {
+		steps[name] = output
+	}
+	return map[string]interface{}{"input": r.input, "steps": steps}
+}
+
+// output returns the output of the workflow.
+func (r *run) output() (interface{}, error) {
+	ctx := r.context()
+	if len(r.w.Output) > 0 {
+		return renderRaw(r.w.Output, ctx)
+	}
+
+	steps := ctx["steps"].(map[string]interface{})
+	sinks := r.w.sinks()
+	if len(sinks) == 1 {
+		return steps[sinks[0]], nil
+	}
+	out := make(map[string]interface{}, len(sinks))
+	for _, name := range sinks {
+		out[name] = steps[name]
+	}
+	return out, nil
+}
+
+// runStep runs a step once the steps before it are done.
+func (r *run) runStep(name string) {
+	step := r.w.Steps[name]
+	record := r.records[name]
+	defer close(r.done[name])
+
+	for _, dep := range step.After {
+		<-r.done[dep]
+		r.mutex.Lock()
+		status := r.records[dep].Status
+		r.mutex.Unlock()
+		if status != Succeeded {
+			r.mutex.Lock()
+			record.Status = Skipped
+			record.Error = fmt.Sprintf("step %s did not succeed", dep)
+			r.mutex.Unlock()
+			return
+		}
+	}
+
+	t0 := time.Now()
+	output, err := r.execute(name, step, record)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	record.Started = &t0
+	record.DurationMs = float64(time.Since(t0)) / float64(time.Millisecond)
+	if err != nil {
+		record.Status = Failed
+		record.Error = err.Error()
+		return
+	}
+	record.Status = Succeeded
+	r.outputs[name] = output
+}
+
+// execute invokes the lambda of a step, once per item with for_each, and
+// returns the output of the step.
+func (r *run) execute(name string, step *Step, record *StepRecord) (interface{}, error) {
+	ctx := r.context()
+
+	if step.For_each == "" {
+		event, err := r.event(step, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return r.attempt(name, step, record, event)
+	}
+
+	value, err := lookup(step.For_each, ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("for_each %s is not an array", step.For_each)
+	}
+	n := len(items)
+	r.mutex.Lock()
+	record.Items = &n
+	r.mutex.Unlock()
+
+	outputs := make([]interface{}, len(items))
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		item_ctx := map[string]interface{}{"input": ctx["input"], "steps": ctx["steps"], "item": item, "index": i}
+		event, err := r.event(step, item_ctx)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+
+		wg.Add(1)
+		go func(i int, event []byte) {
+			defer wg.Done()
+			outputs[i], errs[i] = r.attempt(name, step, record, event)
+		}(i, event)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+	}
+	return outputs, nil
+}
+
+// event returns the event of a step, in JSON.
+func (r *run) event(step *Step, ctx map[string]interface{}) ([]byte, error) {
+	var value interface{}
+	var err error
+
+	steps := ctx["steps"].(map[string]interface{})
+	switch {
+	case len(step.Input) > 0:
+		value, err = renderRaw(step.Input, ctx)
+	case step.For_each != "":
+		value = ctx["item"]
+	case len(step.After) == 0:
+		value = ctx["input"]
+	case len(step.After) == 1:
+		value = steps[step.After[0]]
+	default:
+		deps := make(map[string]interface{}, len(step.After))
+		for _, dep := range step.After {
+			deps[dep] = steps[dep]
+		}
+		value = deps
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not map input: %v", err)
+	}
+
+	return json.Marshal(value)
+}
+
+// attempt invokes the lambda of a step, retrying after errors and server
+// errors, and returns its output.
+func (r *run) attempt(name string, step *Step, record *StepRecord, event []byte) (interface{}, error) {
+	delay := time.Duration(step.Retry_delay * float64(time.Second))
+
+	for attempt := 0; ; attempt++ {
+		r.slots <- true
+		code, body, err := r.invoke(name, step.Lambda, event)
+		<-r.slots
+
+		r.mutex.Lock()
+		record.Attempts += 1
+		record.Code = code
+		r.mutex.Unlock()
+
+		if err == nil && code >= 500 {
+			err = fmt.Errorf("status %d: %s", code, excerpt(body))
+		} else if err == nil && code >= 400 {
+			// the event is bad; trying again will not help
+			return nil, fmt.Errorf("status %d: %s", code, excerpt(body))
+		}
+		if err == nil {
+			return outputValue(body), nil
+		}
+		if attempt == step.Retries {
+			return nil, err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// excerpt returns the start of a response body, for error messages.
+func excerpt(body []byte) string {
+	const max = 200
+	if len(body) > max {
+		return string(body[:max]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,173 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Workflow is a DAG of steps, each invoking a lambda, defined in JSON:
+//
+//	{"steps": {
+//	    "split": {"lambda": "split", "input": {"text": "$.input.text"}},
+//	    "count": {"lambda": "count", "after": ["split"], "for_each": "$.steps.split.parts",
+//	              "input": "$.item", "retries": 2},
+//	    "sum":   {"lambda": "sum", "after": ["count"]}},
+//	 "output": "$.steps.sum"}
+//
+// Steps run as soon as the steps they come after have succeeded.  The input
+// of a step and the output of the workflow are JSON templates, in which
+// strings starting with "$." are replaced with values from the context: the
+// workflow's "input", the outputs of "steps" so far and, in steps run
+// for_each item of an array, the "item" and its "index".
+type Workflow struct {
+	Steps map[string]*Step `json:"steps"`
+
+	// the output of the workflow (by default, the output of its last
+	// step, or an object with the outputs of its last steps if several)
+	Output json.RawMessage `json:"output,omitempty"`
+
+	order []string // of the steps, each after those it depends on
+}
+
+// Step is a step of a Workflow.
+type Step struct {
+	Lambda string `json:"lambda"`
+
+	// steps whose outputs this step needs
+	After []string `json:"after,omitempty"`
+
+	// the event passed to the lambda (by default, the input of the
+	// workflow for first steps, the output of the previous step, or an
+	// object with the outputs of the previous steps if several)
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// a path to an array; the lambda is invoked on each item at once,
+	// and the output of the step is the array of their outputs
+	For_each string `json:"for_each,omitempty"`
+
+	// more attempts after a failure (an error, or a 5xx status),
+	// starting Retry_delay seconds later and doubling each time
+	Retries     int     `json:"retries"`
+	Retry_delay float64 `json:"retry_delay"`
+}
+
+// Load reads a Workflow from a JSON file.
+func Load(path string) (*Workflow, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(raw)
+}
+
+// Parse parses and validates a Workflow.
+func Parse(raw []byte) (*Workflow, error) {
+	var w Workflow
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("could not parse workflow: %v", err)
+	}
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// validate checks the steps and their dependencies, and orders the steps.
+func (w *Workflow) validate() error {
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("workflow has no steps")
+	}
+
+	names := make([]string, 0, len(w.Steps))
+	for name, step := range w.Steps {
+		if step == nil || step.Lambda == "" {
+			return fmt.Errorf("step %s has no lambda", name)
+		}
+		if step.Retries < 0 || step.Retry_delay < 0 {
+			return fmt.Errorf("step %s has negative retries or retry_delay", name)
+		}
+		if step.For_each != "" && !isPath(step.For_each) {
+			return fmt.Errorf("for_each of step %s is not a path: %q", name, step.For_each)
+		}
+		for _, dep := range step.After {
+			if _, ok := w.Steps[dep]; !ok {
+				return fmt.Errorf("step %s comes after unknown step %s", name, dep)
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// depth-first topological sort, in name order for stable output
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int)
+	w.order = nil
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("workflow has a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		deps := append([]string{}, w.Steps[name].After...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		w.order = append(w.order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lambdas returns the names of the lambdas the workflow invokes.
+func (w *Workflow) Lambdas() []string {
+	seen := make(map[string]bool)
+	lambdas := []string{}
+	for _, name := range w.order {
+		if lambda := w.Steps[name].Lambda; !seen[lambda] {
+			seen[lambda] = true
+			lambdas = append(lambdas, lambda)
+		}
+	}
+	return lambdas
+}
+
+// sinks returns the steps no other step comes after.
+func (w *Workflow) sinks() []string {
+	needed := make(map[string]bool)
+	for _, step := range w.Steps {
+		for _, dep := range step.After {
+			needed[dep] = true
+		}
+	}
+
+	sinks := []string{}
+	for _, name := range w.order {
+		if !needed[name] {
+			sinks = append(sinks, name)
+		}
+	}
+	return sinks
+}
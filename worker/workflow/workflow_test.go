@@ -0,0 +1,146 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lambdas is an Invoker running lambdas written in Go.
+type lambdas struct {
+	mutex sync.Mutex
+	calls map[string]int
+	funcs map[string]func(event interface{}) (int, interface{})
+}
+
+func (l *lambdas) invoke(step string, lambda string, event []byte) (int, []byte, error) {
+	l.mutex.Lock()
+	l.calls[lambda] += 1
+	calls := l.calls[lambda]
+	l.mutex.Unlock()
+
+	if lambda == "flaky" && calls == 1 {
+		return http.StatusServiceUnavailable, []byte("try again"), nil
+	}
+	f, ok := l.funcs[lambda]
+	if !ok {
+		return 0, nil, fmt.Errorf("no lambda %s", lambda)
+	}
+
+	var v interface{}
+	json.Unmarshal(event, &v)
+	code, out := f(v)
+	body, _ := json.Marshal(out)
+	return code, body, nil
+}
+
+func newLambdas() *lambdas {
+	return &lambdas{
+		calls: make(map[string]int),
+		funcs: map[string]func(event interface{}) (int, interface{}){
+			"split": func(event interface{}) (int, interface{}) {
+				text := event.(map[string]interface{})["text"].(string)
+				return 200, map[string]interface{}{"parts": strings.Fields(text)}
+			},
+			"len": func(event interface{}) (int, interface{}) {
+				return 200, len(event.(string))
+			},
+			"sum": func(event interface{}) (int, interface{}) {
+				total := 0.0
+				for _, n := range event.([]interface{}) {
+					total += n.(float64)
+				}
+				return 200, total
+			},
+			"flaky": func(event interface{}) (int, interface{}) {
+				return 200, event
+			},
+			"reject": func(event interface{}) (int, interface{}) {
+				return 400, "bad event"
+			},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	w, err := Parse([]byte(`{
+		"steps": {
+			"split": {"lambda": "split", "input": {"text": "$.input.text"}},
+			"count": {"lambda": "len", "after": ["split"], "for_each": "$.steps.split.parts"},
+			"sum":   {"lambda": "sum", "after": ["count"]},
+			"echo":  {"lambda": "flaky", "after": ["split"], "input": "$.steps.split.parts[1]", "retries": 1}
+		},
+		"output": {"total": "$.steps.sum", "second": "$.steps.echo", "literal": "$$.x"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := newLambdas()
+	result := w.Run([]byte(`{"text": "a bb ccc"}`), l.invoke, 2)
+	if result.Status != Succeeded {
+		t.Fatalf("expected success, got %+v", result)
+	}
+
+	out, _ := json.Marshal(result.Output)
+	if string(out) != `{"literal":"$.x","second":"bb","total":6}` {
+		t.Fatalf("unexpected output %s", out)
+	}
+
+	names := []string{}
+	for _, record := range result.Steps {
+		names = append(names, record.Step)
+		switch record.Step {
+		case "count":
+			if *record.Items != 3 || record.Attempts != 3 {
+				t.Fatalf("expected 3 items, got %+v", record)
+			}
+		case "echo":
+			if record.Attempts != 2 {
+				t.Fatalf("expected a retry, got %+v", record)
+			}
+		}
+	}
+	if strings.Join(names, ",") != "split,count,echo,sum" {
+		t.Fatalf("unexpected order %v", names)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	w, err := Parse([]byte(`{"steps": {
+		"a": {"lambda": "reject", "retries": 3},
+		"b": {"lambda": "flaky", "after": ["a"]}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := w.Run(nil, newLambdas().invoke, 1)
+	if result.Status != Failed {
+		t.Fatalf("expected failure, got %+v", result)
+	}
+	if a := result.Steps[0]; a.Status != Failed || a.Attempts != 1 || a.Code != 400 {
+		t.Fatalf("expected a to fail without retries, got %+v", a)
+	}
+	if b := result.Steps[1]; b.Status != Skipped || b.Attempts != 0 {
+		t.Fatalf("expected b to be skipped, got %+v", b)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, def := range []string{
+		`{"steps": {}}`,
+		`{"steps": {"a": {}}}`,
+		`{"steps": {"a": {"lambda": "x", "after": ["b"]}}}`,
+		`{"steps": {"a": {"lambda": "x", "after": ["b"]}, "b": {"lambda": "x", "after": ["a"]}}}`,
+		`{"steps": {"a": {"lambda": "x", "for_each": "items"}}}`,
+		`{"steps": {"a": {"lambda": "x", "retry": 2}}}`,
+	} {
+		if _, err := Parse([]byte(def)); err == nil {
+			t.Errorf("expected error for %s", def)
+		}
+	}
+}